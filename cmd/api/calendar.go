@@ -0,0 +1,417 @@
+// Filename: cmd/api/calendar.go
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"appletree.miguelavila.net/internal/data"
+	"appletree.miguelavila.net/internal/ical"
+	"appletree.miguelavila.net/internal/validator"
+)
+
+// calendarUIDDomain makes the UIDs of feed events globally unique
+const calendarUIDDomain = "appletree.miguelavila.net"
+
+// showHoursHandler for GET /v1/schools/:id/hours endpoint
+func (app *application) showHoursHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	hours, err := app.models.Calendar.GetHours(school.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"hours": hours}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateHoursHandler for PUT /v1/schools/:id/hours endpoint
+// replaces the whole week, days left out are closed
+func (app *application) updateHoursHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Hours []data.OpeningHours `json:"hours"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badResquestReponse(w, r, err)
+		return
+	}
+	if input.Hours == nil {
+		input.Hours = []data.OpeningHours{}
+	}
+
+	v := validator.New()
+	if data.ValidateHours(v, input.Hours); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Calendar.ReplaceHours(school.ID, input.Hours)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// read them back in weekday order
+	hours, err := app.models.Calendar.GetHours(school.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"hours": hours}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readEventFilter() reads ?from=&to=&kind= of a calendar listing
+func (app *application) readEventFilter(qs url.Values, v *validator.Validator) data.EventFilter {
+	var f data.EventFilter
+	f.From = app.readString(qs, "from", "")
+	f.To = app.readString(qs, "to", "")
+	f.Kind = app.readString(qs, "kind", "")
+
+	if f.From != "" {
+		v.CheckCode(data.ValidDate(f.From), "from", validator.CodePattern, validator.Params{"format": "date"}, "must be a date such as 2024-09-02")
+	}
+	if f.To != "" {
+		v.CheckCode(data.ValidDate(f.To), "to", validator.CodePattern, validator.Params{"format": "date"}, "must be a date such as 2024-09-02")
+	}
+	if f.Kind != "" {
+		v.CheckCode(validator.In(f.Kind, data.EventKinds...), "kind", validator.CodeOneOf, validator.Params{"values": data.EventKinds}, "must be a known kind of event")
+	}
+	return f
+}
+
+// listEventsHandler for GET /v1/schools/:id/calendar endpoint
+func (app *application) listEventsHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	v := validator.New()
+	filter := app.readEventFilter(r.URL.Query(), v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	events, err := app.models.Calendar.GetEvents(school.ID, filter)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"events": events}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createEventHandler for POST /v1/schools/:id/calendar endpoint
+func (app *application) createEventHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Kind        string `json:"kind"`
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		StartsOn    string `json:"starts_on"`
+		EndsOn      string `json:"ends_on"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badResquestReponse(w, r, err)
+		return
+	}
+
+	event := &data.Event{
+		SchoolID:    school.ID,
+		Kind:        input.Kind,
+		Title:       input.Title,
+		Description: input.Description,
+		StartsOn:    input.StartsOn,
+		EndsOn:      input.EndsOn,
+	}
+
+	v := validator.New()
+	if data.ValidateEvent(v, event); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Calendar.InsertEvent(event)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/schools/%d/calendar/%d", school.ID, event.ID))
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"event": event}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// eventFromPath() loads the event named by :event_id of the school
+func (app *application) eventFromPath(w http.ResponseWriter, r *http.Request, school *data.School) (*data.Event, bool) {
+	id, err := app.readNamedIDParam(r, "event_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	event, err := app.models.Calendar.GetEvent(school.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return event, true
+}
+
+// showEventHandler for GET /v1/schools/:id/calendar/:event_id endpoint
+func (app *application) showEventHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+	event, ok := app.eventFromPath(w, r, school)
+	if !ok {
+		return
+	}
+
+	err := app.writeResponse(w, r, http.StatusOK, envelope{"event": event}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateEventHandler for PATCH /v1/schools/:id/calendar/:event_id endpoint
+func (app *application) updateEventHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+	event, ok := app.eventFromPath(w, r, school)
+	if !ok {
+		return
+	}
+
+	// pointers tell us which fields the client wants to change
+	var input struct {
+		Kind        *string `json:"kind"`
+		Title       *string `json:"title"`
+		Description *string `json:"description"`
+		StartsOn    *string `json:"starts_on"`
+		EndsOn      *string `json:"ends_on"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badResquestReponse(w, r, err)
+		return
+	}
+
+	if input.Kind != nil {
+		event.Kind = *input.Kind
+	}
+	if input.Title != nil {
+		event.Title = *input.Title
+	}
+	if input.Description != nil {
+		event.Description = *input.Description
+	}
+	if input.StartsOn != nil {
+		event.StartsOn = *input.StartsOn
+	}
+	if input.EndsOn != nil {
+		event.EndsOn = *input.EndsOn
+	}
+
+	v := validator.New()
+	if data.ValidateEvent(v, event); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Calendar.UpdateEvent(event)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"event": event}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteEventHandler for DELETE /v1/schools/:id/calendar/:event_id endpoint
+func (app *application) deleteEventHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+	id, err := app.readNamedIDParam(r, "event_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Calendar.DeleteEvent(school.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "event successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// schoolCalendarFeedHandler for GET /v1/schools/:id/calendar.ics endpoint
+// lets families subscribe to the calendar of a school
+func (app *application) schoolCalendarFeedHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	events, err := app.models.Calendar.GetEvents(school.ID, app.feedWindow())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	cal := &ical.Calendar{Name: school.Name}
+	for _, event := range events {
+		entry := feedEvent(event)
+		entry.Location = school.Address
+		cal.Events = append(cal.Events, entry)
+	}
+	app.writeCalendar(w, r, fmt.Sprintf("school-%d.ics", school.ID), cal)
+}
+
+// calendarFeedHandler for GET /v1/calendar.ics endpoint
+// combines the calendars of the schools in a district or of a level
+func (app *application) calendarFeedHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+	filter := app.feedWindow()
+	filter.District = app.readString(qs, "district", "")
+	filter.Level = app.readString(qs, "level", "")
+	filter.Kind = app.readString(qs, "kind", "")
+	if filter.Kind != "" {
+		v.CheckCode(validator.In(filter.Kind, data.EventKinds...), "kind", validator.CodeOneOf, validator.Params{"values": data.EventKinds}, "must be a known kind of event")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	// the district and level filters accept codes or aliases
+	vocab, err := app.vocabularies()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	name := []string{"Schools"}
+	if code, ok := vocab.Districts.Resolve(filter.District); ok {
+		filter.District = code
+		name = append(name, vocab.Districts.Name(code))
+	}
+	if code, ok := vocab.Levels.Resolve(filter.Level); ok {
+		filter.Level = code
+		name = append(name, vocab.Levels.Name(code))
+	}
+
+	events, err := app.models.Calendar.GetEvents(0, filter)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	cal := &ical.Calendar{Name: strings.Join(name, " - ")}
+	for _, event := range events {
+		entry := feedEvent(event)
+		entry.Summary = event.School.Name + ": " + event.Title
+		cal.Events = append(cal.Events, entry)
+	}
+	app.writeCalendar(w, r, "schools.ics", cal)
+}
+
+// feedWindow() limits feeds to events that ended in the last year or are still to come
+func (app *application) feedWindow() data.EventFilter {
+	return data.EventFilter{From: time.Now().AddDate(-1, 0, 0).Format(data.DateLayout)}
+}
+
+// feedEvent() converts a calendar event for an iCalendar feed
+func feedEvent(event *data.Event) ical.Event {
+	// the dates were validated when the event was saved
+	start, _ := time.Parse(data.DateLayout, event.StartsOn)
+	end, _ := time.Parse(data.DateLayout, event.EndsOn)
+	return ical.Event{
+		UID:         fmt.Sprintf("event-%d@%s", event.ID, calendarUIDDomain),
+		Stamp:       event.UpdatedAt,
+		Sequence:    int(event.Version) - 1,
+		Start:       start,
+		End:         end,
+		Summary:     event.Title,
+		Description: event.Description,
+		Categories:  []string{strings.ReplaceAll(event.Kind, "_", " ")},
+	}
+}
+
+// writeCalendar() sends an iCalendar document
+func (app *application) writeCalendar(w http.ResponseWriter, r *http.Request, filename string, cal *ical.Calendar) {
+	var buf bytes.Buffer
+	if err := cal.Write(&buf); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
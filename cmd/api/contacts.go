@@ -0,0 +1,239 @@
+// Filename: cmd/api/contacts.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"appletree.miguelavila.net/internal/data"
+	"appletree.miguelavila.net/internal/validator"
+)
+
+// schoolFromPath() loads the school named by :id for the nested routes, it
+// writes the error response itself and reports whether the handler can go on
+func (app *application) schoolFromPath(w http.ResponseWriter, r *http.Request) (*data.School, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	school, err := app.models.Schools.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return school, true
+}
+
+// listContactsHandler for GET /v1/schools/:id/contacts endpoint
+func (app *application) listContactsHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	contacts, err := app.models.Contacts.GetAllForSchool(school.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"contacts": contacts}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createContactHandler for POST /v1/schools/:id/contacts endpoint
+func (app *application) createContactHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Role    string `json:"role"`
+		Name    string `json:"name"`
+		Phone   string `json:"phone"`
+		Email   string `json:"email"`
+		Primary bool   `json:"primary"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badResquestReponse(w, r, err)
+		return
+	}
+
+	contact := &data.Contact{
+		SchoolID: school.ID,
+		Role:     input.Role,
+		Name:     input.Name,
+		Phone:    input.Phone,
+		Email:    input.Email,
+		Primary:  input.Primary,
+	}
+
+	v := validator.New()
+	if data.ValidateContact(v, contact); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Contacts.Insert(contact)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/schools/%d/contacts/%d", school.ID, contact.ID))
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"contact": contact}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// contactFromPath() loads the contact named by :contact_id of the school
+func (app *application) contactFromPath(w http.ResponseWriter, r *http.Request, school *data.School) (*data.Contact, bool) {
+	id, err := app.readNamedIDParam(r, "contact_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	contact, err := app.models.Contacts.Get(school.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return contact, true
+}
+
+// showContactHandler for GET /v1/schools/:id/contacts/:contact_id endpoint
+func (app *application) showContactHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+	contact, ok := app.contactFromPath(w, r, school)
+	if !ok {
+		return
+	}
+
+	err := app.writeResponse(w, r, http.StatusOK, envelope{"contact": contact}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateContactHandler for PATCH /v1/schools/:id/contacts/:contact_id endpoint
+func (app *application) updateContactHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+	contact, ok := app.contactFromPath(w, r, school)
+	if !ok {
+		return
+	}
+
+	// pointers tell us which fields the client wants to change
+	var input struct {
+		Role    *string `json:"role"`
+		Name    *string `json:"name"`
+		Phone   *string `json:"phone"`
+		Email   *string `json:"email"`
+		Primary *bool   `json:"primary"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badResquestReponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	// a school always has a primary contact, it moves by promoting another one
+	wasPrimary := contact.Primary
+	if input.Role != nil {
+		contact.Role = *input.Role
+	}
+	if input.Name != nil {
+		contact.Name = *input.Name
+	}
+	if input.Phone != nil {
+		contact.Phone = *input.Phone
+	}
+	if input.Email != nil {
+		contact.Email = *input.Email
+	}
+	if input.Primary != nil {
+		contact.Primary = *input.Primary
+	}
+	v.CheckCode(!wasPrimary || contact.Primary, "primary", validator.CodePrimary, nil, "cannot be unset, make another contact primary instead")
+
+	if data.ValidateContact(v, contact); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Contacts.Update(contact)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"contact": contact}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteContactHandler for DELETE /v1/schools/:id/contacts/:contact_id endpoint
+func (app *application) deleteContactHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+	id, err := app.readNamedIDParam(r, "contact_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Contacts.Delete(school.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		// the primary contact is the school's own contact
+		case errors.Is(err, data.ErrRecordInUse):
+			app.recordInUseResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "contact successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,66 @@
+// Filename: cmd/api/context.go
+
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"appletree.miguelavila.net/internal/data"
+	"appletree.miguelavila.net/internal/i18n"
+)
+
+type contextKey string
+
+const (
+	responseFormatContextKey = contextKey("responseFormat")
+	languageContextKey       = contextKey("language")
+	userContextKey           = contextKey("user")
+)
+
+// contextSetFormat() returns a copy of the request with the negotiated format stored in its context
+func (app *application) contextSetFormat(r *http.Request, format responseFormat) *http.Request {
+	ctx := context.WithValue(r.Context(), responseFormatContextKey, format)
+	return r.WithContext(ctx)
+}
+
+// contextGetFormat() returns the negotiated format, falling back to JSON
+// when the request never went through the negotiation middleware
+func (app *application) contextGetFormat(r *http.Request) responseFormat {
+	format, ok := r.Context().Value(responseFormatContextKey).(responseFormat)
+	if !ok {
+		return formatJSON
+	}
+	return format
+}
+
+// contextSetLanguage() returns a copy of the request with the negotiated language stored in its context
+func (app *application) contextSetLanguage(r *http.Request, lang string) *http.Request {
+	ctx := context.WithValue(r.Context(), languageContextKey, lang)
+	return r.WithContext(ctx)
+}
+
+// contextGetLanguage() returns the negotiated language, falling back to the default language
+func (app *application) contextGetLanguage(r *http.Request) string {
+	lang, ok := r.Context().Value(languageContextKey).(string)
+	if !ok {
+		return i18n.DefaultLanguage
+	}
+	return lang
+}
+
+// contextSetUser() returns a copy of the request with the authenticated user stored in its context
+func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	return r.WithContext(ctx)
+}
+
+// contextGetUser() returns the authenticated user, falling back to the
+// anonymous user when the request sent no token
+func (app *application) contextGetUser(r *http.Request) *data.User {
+	user, ok := r.Context().Value(userContextKey).(*data.User)
+	if !ok {
+		return data.AnonymousUser
+	}
+	return user
+}
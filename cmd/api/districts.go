@@ -0,0 +1,61 @@
+// Filename: cmd/api/districts.go
+
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"appletree.miguelavila.net/internal/data"
+	"appletree.miguelavila.net/internal/validator"
+)
+
+// districtSchoolsHandler for GET /v1/districts/:id/schools, it takes the same
+// query parameters as GET /v1/schools with the district fixed by the path
+func (app *application) districtSchoolsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	district, err := app.models.Districts.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	v := validator.New()
+	vocab, err := app.vocabularies()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	filter, filters := app.readSchoolFilter(r, v, vocab)
+	includes := app.readIncludes(r.URL.Query(), v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+	filter.District = district.Code
+
+	schools, metadata, err := app.models.Schools.GetAll(filter, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.loadIncludes(includes, schools...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"district": district, "schools": schools, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,338 @@
+// Filename: cmd/api/documents.go
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"appletree.miguelavila.net/internal/data"
+	"appletree.miguelavila.net/internal/validator"
+)
+
+// scanDocument() runs the scanner over a pending document. An infected file
+// is removed right away, its row stays to tell the uploader why. When the
+// scanner fails the document stays pending and is retried on the next start
+func (app *application) scanDocument(document *data.Document) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	file, err := app.blobs.Open(ctx, document.Key)
+	if err != nil {
+		app.logger.Printf("scanning document %d: %v", document.ID, err)
+		return
+	}
+	result, err := app.scanner.Scan(ctx, file)
+	file.Close()
+	if err != nil {
+		app.logger.Printf("scanning document %d: %v", document.ID, err)
+		return
+	}
+
+	document.ScanStatus = data.ScanClean
+	if !result.Clean {
+		document.ScanStatus = data.ScanInfected
+		document.ScanSignature = result.Signature
+	}
+	err = app.models.Documents.SetScanResult(document)
+	if err != nil {
+		// a document deleted while it was scanned has nothing left to update
+		if !errors.Is(err, data.ErrRecordNotFound) {
+			app.logger.Printf("scanning document %d: %v", document.ID, err)
+		}
+		return
+	}
+	if !result.Clean {
+		app.logger.Printf("document %d of school %d is infected with %s", document.ID, document.SchoolID, result.Signature)
+		app.deleteDocumentBlobs(document)
+	}
+}
+
+// scanPendingDocuments() scans the documents uploaded while the scanner was
+// unavailable or the server stopped
+func (app *application) scanPendingDocuments() {
+	documents, err := app.models.Documents.GetPending()
+	if err != nil {
+		app.logger.Printf("listing pending documents: %v", err)
+		return
+	}
+	for _, document := range documents {
+		app.scanDocument(document)
+	}
+}
+
+// deleteDocumentBlobs() removes the stored files of documents whose rows are
+// gone. Failures are only logged, the documents are already unreachable
+func (app *application) deleteDocumentBlobs(documents ...*data.Document) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, document := range documents {
+		if err := app.blobs.Delete(ctx, document.Key); err != nil {
+			app.logger.Printf("deleting blob %s: %v", document.Key, err)
+		}
+	}
+}
+
+// listDocumentsHandler for GET /v1/schools/:id/documents endpoint
+// lists the documents that passed the scan
+func (app *application) listDocumentsHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	documents, err := app.models.Documents.GetAllForSchool(school.ID, data.ScanClean)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"documents": documents}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// uploadDocumentHandler for POST /v1/schools/:id/documents endpoint
+// takes a multipart/form-data body with the file in the "file" field next to
+// its type, title, valid_from and valid_until. The document is accepted as
+// pending and becomes visible once the scanner passes it
+func (app *application) uploadDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	content, header, err := app.readFile(w, r, "file", app.config.documents.maxBytes)
+	if err != nil {
+		app.badResquestReponse(w, r, err)
+		return
+	}
+
+	checksum := sha256.Sum256(content)
+	document := &data.Document{
+		SchoolID:    school.ID,
+		Type:        r.FormValue("type"),
+		Title:       r.FormValue("title"),
+		ValidFrom:   r.FormValue("valid_from"),
+		ValidUntil:  r.FormValue("valid_until"),
+		Filename:    path.Base(strings.ReplaceAll(header.Filename, "\\", "/")),
+		ContentType: http.DetectContentType(content),
+		Size:        int64(len(content)),
+		SHA256:      hex.EncodeToString(checksum[:]),
+	}
+	if document.Filename == "." || document.Filename == "/" {
+		document.Filename = "document"
+	}
+	// the declared type is never trusted, only what the content looks like
+	if mediaType, _, err := mime.ParseMediaType(document.ContentType); err == nil {
+		document.ContentType = mediaType
+	}
+
+	v := validator.New()
+	if data.ValidateDocument(v, document); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	document.Key, err = newBlobKey("documents")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.blobs.Put(r.Context(), document.Key, bytes.NewReader(content))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Documents.Insert(document)
+	if err != nil {
+		app.deleteDocumentBlobs(document)
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	scanned := *document
+	app.background(func() {
+		app.scanDocument(&scanned)
+	})
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/schools/%d/documents/%d", school.ID, document.ID))
+	err = app.writeResponse(w, r, http.StatusAccepted, envelope{"document": document}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// documentFromPath() loads the document named by :document_id of the school
+func (app *application) documentFromPath(w http.ResponseWriter, r *http.Request, school *data.School) (*data.Document, bool) {
+	id, err := app.readNamedIDParam(r, "document_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	document, err := app.models.Documents.Get(school.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return document, true
+}
+
+// showDocumentHandler for GET /v1/schools/:id/documents/:document_id endpoint
+// also answers for documents that are pending or infected, so the uploader
+// can follow the scan
+func (app *application) showDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+	document, ok := app.documentFromPath(w, r, school)
+	if !ok {
+		return
+	}
+
+	err := app.writeResponse(w, r, http.StatusOK, envelope{"document": document}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// downloadDocumentHandler for GET /v1/schools/:id/documents/:document_id/download endpoint
+// serves the file of a clean document, with support for range requests
+func (app *application) downloadDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+	document, ok := app.documentFromPath(w, r, school)
+	if !ok {
+		return
+	}
+	if document.ScanStatus != data.ScanClean {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	file, err := app.blobs.Open(r.Context(), document.Key)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	defer file.Close()
+
+	// the checksum identifies the content, ServeContent answers If-None-Match and If-Range with it
+	w.Header().Set("ETag", `"`+document.SHA256+`"`)
+	w.Header().Set("Content-Type", document.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": document.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, document.Filename, document.CreatedAt, file)
+}
+
+// updateDocumentHandler for PATCH /v1/schools/:id/documents/:document_id endpoint
+// changes the metadata, a new file is a new document
+func (app *application) updateDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+	document, ok := app.documentFromPath(w, r, school)
+	if !ok {
+		return
+	}
+
+	// pointers tell us which fields the client wants to change
+	var input struct {
+		Type       *string `json:"type"`
+		Title      *string `json:"title"`
+		ValidFrom  *string `json:"valid_from"`
+		ValidUntil *string `json:"valid_until"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badResquestReponse(w, r, err)
+		return
+	}
+
+	if input.Type != nil {
+		document.Type = *input.Type
+	}
+	if input.Title != nil {
+		document.Title = *input.Title
+	}
+	if input.ValidFrom != nil {
+		document.ValidFrom = *input.ValidFrom
+	}
+	if input.ValidUntil != nil {
+		document.ValidUntil = *input.ValidUntil
+	}
+
+	v := validator.New()
+	if data.ValidateDocument(v, document); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Documents.Update(document)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"document": document}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteDocumentHandler for DELETE /v1/schools/:id/documents/:document_id endpoint
+func (app *application) deleteDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+	id, err := app.readNamedIDParam(r, "document_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	document, err := app.models.Documents.Delete(school.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.deleteDocumentBlobs(document)
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "document successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,166 @@
+// Filename: cmd/api/duplicates.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"appletree.miguelavila.net/internal/data"
+	"appletree.miguelavila.net/internal/validator"
+)
+
+// schoolDuplicatesHandler for GET /v1/schools/:id/duplicates endpoint
+// lists the schools that look like the same school, best match first
+func (app *application) schoolDuplicatesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	school, err := app.models.Schools.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	duplicates, err := app.models.Schools.FindDuplicates(school, data.DuplicateListScore)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"duplicates": duplicates}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// mergeSchoolsHandler for POST /v1/schools/merge endpoint
+// folds the source schools into the target, see data.MergeSchools() for the rules
+func (app *application) mergeSchoolsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TargetID  int64            `json:"target_id"`
+		SourceIDs []int64          `json:"source_ids"`
+		Prefer    map[string]int64 `json:"prefer"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badResquestReponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.CheckCode(input.TargetID > 0, "target_id", validator.CodeRequired, nil, "must be provided")
+	v.CheckCode(len(input.SourceIDs) > 0, "source_ids", validator.CodeMinItems, validator.Params{"min": 1}, "must contain at least 1 entries")
+	v.CheckCode(len(input.SourceIDs) <= 20, "source_ids", validator.CodeMaxItems, validator.Params{"max": 20}, "must contain at most 20 entries")
+	seen := map[int64]bool{input.TargetID: true}
+	for i, id := range input.SourceIDs {
+		key := validator.Index("source_ids", i)
+		v.CheckCode(id != input.TargetID, key, validator.CodeNeField, validator.Params{"field": "target_id"}, "must not be equal to target_id")
+		v.CheckCode(id == input.TargetID || !seen[id], key, validator.CodeUnique, nil, "must not contain duplicates")
+		seen[id] = true
+	}
+	fields := data.MergeFields()
+	schoolIDs := append([]int64{input.TargetID}, input.SourceIDs...)
+	for field, id := range input.Prefer {
+		key := validator.Path("prefer", field)
+		v.CheckCode(validator.In(field, fields...), key, validator.CodeOneOf, validator.Params{"values": fields}, "must be a field that can be merged")
+		v.CheckCode(seen[id], key, validator.CodeOneOf, validator.Params{"values": schoolIDs}, "must be the target or one of the sources")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	// every school has to exist before anything changes
+	target, err := app.models.Schools.Get(input.TargetID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	v.CheckCode(target != nil, "target_id", validator.CodeNotFound, nil, "must refer to an existing record")
+	sources := make([]*data.School, 0, len(input.SourceIDs))
+	for i, id := range input.SourceIDs {
+		source, err := app.models.Schools.Get(id)
+		if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		v.CheckCode(source != nil, validator.Index("source_ids", i), validator.CodeNotFound, nil, "must refer to an existing record")
+		sources = append(sources, source)
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	data.MergeSchools(target, sources, input.Prefer)
+
+	vocab, err := app.vocabularies()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if data.ValidateSchool(v, target, vocab); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Schools.Merge(target, sources)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// names changed, cached suggestions may be stale
+	app.suggestions.Purge()
+	// embed the logo
+	err = app.loadIncludes(nil, target)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/schools/%d", target.ID))
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"school": target, "merged_ids": input.SourceIDs}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// mergedSchoolRedirect() sends a 301 to the school an id was merged into,
+// ids that never existed or were deleted get a 404
+func (app *application) mergedSchoolRedirect(w http.ResponseWriter, r *http.Request, id int64) {
+	target, err := app.models.Schools.RedirectTarget(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/schools/%d", target))
+	err = app.writeResponse(w, r, http.StatusMovedPermanently, envelope{"message": "school was merged into another school"}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,193 @@
+// Filename: cmd/api/enrollments.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"appletree.miguelavila.net/internal/data"
+	"appletree.miguelavila.net/internal/validator"
+)
+
+// listEnrollmentsHandler for GET /v1/schools/:id/enrollments endpoint
+func (app *application) listEnrollmentsHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	enrollments, err := app.models.Enrollments.GetAllForSchool(school.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"enrollments": enrollments}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// upsertEnrollmentHandler for PUT /v1/schools/:id/enrollments/:year endpoint
+// records or replaces the figures of an academic year. A client that read the
+// year sends its version, in the body or as If-Match, so that a concurrent
+// change is not overwritten
+func (app *application) upsertEnrollmentHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	// pointers tell us which figures the client left out, a PUT replaces all of them
+	var input struct {
+		Enrollment   *int32 `json:"enrollment"`
+		Capacity     *int32 `json:"capacity"`
+		Teachers     *int32 `json:"teachers"`
+		OverCapacity bool   `json:"over_capacity"`
+		Version      *int32 `json:"version"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badResquestReponse(w, r, err)
+		return
+	}
+	if input.Version == nil {
+		version, ok, err := app.readIfMatch(r)
+		if err != nil {
+			app.badResquestReponse(w, r, err)
+			return
+		}
+		if ok {
+			input.Version = &version
+		}
+	}
+
+	v := validator.New()
+	v.CheckCode(input.Enrollment != nil, "enrollment", validator.CodeRequired, nil, "must be provided")
+	v.CheckCode(input.Capacity != nil, "capacity", validator.CodeRequired, nil, "must be provided")
+	v.CheckCode(input.Teachers != nil, "teachers", validator.CodeRequired, nil, "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	enrollment := &data.Enrollment{
+		SchoolID:     school.ID,
+		AcademicYear: app.readParam(r, "year"),
+		Enrollment:   *input.Enrollment,
+		Capacity:     *input.Capacity,
+		Teachers:     *input.Teachers,
+		OverCapacity: input.OverCapacity,
+	}
+
+	if data.ValidateEnrollment(v, enrollment); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	// without a version the figures are recorded whatever is stored
+	inserted := false
+	if input.Version != nil {
+		enrollment.Version = *input.Version
+		err = app.models.Enrollments.Update(enrollment)
+	} else {
+		inserted, err = app.models.Enrollments.Upsert(enrollment)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	status := http.StatusOK
+	if inserted {
+		status = http.StatusCreated
+	}
+	headers := make(http.Header)
+	headers.Set("ETag", fmt.Sprintf(`"%d"`, enrollment.Version))
+	err = app.writeResponse(w, r, status, envelope{"enrollment": enrollment}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteEnrollmentHandler for DELETE /v1/schools/:id/enrollments/:year endpoint
+func (app *application) deleteEnrollmentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	year := app.readParam(r, "year")
+	if !data.ValidAcademicYear(year) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Enrollments.Delete(id, year)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "enrollment successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// enrollmentSummaryHandler for GET /v1/enrollments/summary endpoint
+// totals the yearly figures for reporting
+func (app *application) enrollmentSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	var input data.EnrollmentFilter
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Year = app.readString(qs, "year", "")
+	input.District = app.readString(qs, "district", "")
+	input.Level = app.readString(qs, "level", "")
+
+	if input.Year != "" {
+		v.CheckCode(data.ValidAcademicYear(input.Year), "year", validator.CodePattern, validator.Params{"format": "academic_year"}, "must be an academic year such as 2023-2024")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	// the district and level filters accept codes or aliases
+	vocab, err := app.vocabularies()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if code, ok := vocab.Districts.Resolve(input.District); ok {
+		input.District = code
+	}
+	if code, ok := vocab.Levels.Resolve(input.Level); ok {
+		input.Level = code
+	}
+
+	summary, err := app.models.Enrollments.Summary(input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"summary": summary}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
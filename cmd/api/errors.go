@@ -3,20 +3,101 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+
+	"appletree.miguelavila.net/internal/data"
+	"appletree.miguelavila.net/internal/validator"
+)
+
+// Base URI for the problem types; the code is appended to build the type
+const problemTypeBase = "https://appletree.miguelavila.net/problems/"
+
+// Stable machine-readable error codes, clients should branch on these
+// instead of the English detail text
+const (
+	codeServerError      = "server_error"
+	codeNotFound         = "not_found"
+	codeMethodNotAllowed = "method_not_allowed"
+	codeBadRequest       = "bad_request"
+	codeValidationFailed = "validation_failed"
+	codeEditConflict     = "edit_conflict"
+	codeNotAcceptable    = "not_acceptable"
+	codeRecordInUse      = "record_in_use"
+	codePossibleDupe     = "possible_duplicate"
+	codeInvalidToken     = "invalid_token"
+	codeAuthRequired     = "authentication_required"
+	codeNotPermitted     = "not_permitted"
 )
 
+// problem is an RFC 7807 problem details object
+type problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     string       `json:"code"`
+	Errors   []fieldError `json:"errors,omitempty"`
+
+	// detailKey and params select the localized detail message
+	detailKey string
+	params    map[string]interface{}
+	// extensions are extra members specific to the problem type
+	extensions envelope
+}
+
+// fieldError describes a single validation failure
+type fieldError struct {
+	Field   string                 `json:"field"`
+	Code    string                 `json:"code"`
+	Params  map[string]interface{} `json:"params,omitempty"`
+	Message string                 `json:"message"`
+}
+
 // Log errors
 func (app *application) logError(r *http.Request, err error) {
 	app.logger.Println(err)
 }
 
-// Send JSON-formatted error message
-func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message interface{}) {
-	// create the json response
-	env := envelope{"error": message}
-	err := app.writeJSON(w, status, env, nil)
+// Send a problem details error message
+func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, p problem) {
+	p.Type = problemTypeBase + p.Code
+	p.Instance = r.URL.RequestURI()
+
+	// render the title and detail in the negotiated language
+	lang := app.contextGetLanguage(r)
+	p.Title = app.translate(lang, "problem."+p.Code+".title", nil, p.Title)
+	if p.detailKey != "" {
+		p.Detail = app.translate(lang, p.detailKey, p.params, p.Detail)
+	}
+
+	env := envelope{
+		"type":     p.Type,
+		"title":    p.Title,
+		"status":   p.Status,
+		"detail":   p.Detail,
+		"instance": p.Instance,
+		"code":     p.Code,
+	}
+	if len(p.Errors) > 0 {
+		env["errors"] = p.Errors
+	}
+	for key, value := range p.extensions {
+		env[key] = value
+	}
+
+	headers := make(http.Header)
+	headers.Set("Content-Type", app.contextGetFormat(r).problemContentType())
+
+	// clients that have not migrated yet still get the old {"error": ...} shape
+	if app.config.legacyErrors {
+		env = envelope{"error": p.legacyMessage()}
+		headers = nil
+	}
+
+	err := app.writeResponse(w, r, p.Status, env, headers)
 
 	if err != nil {
 		app.logError(r, err)
@@ -25,42 +106,195 @@ func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, st
 
 }
 
+// translate() renders a catalog message, keeping the fallback text when the key is unknown
+func (app *application) translate(lang, key string, params map[string]interface{}, fallback string) string {
+	message, ok := app.catalog.Translate(lang, key, params)
+	if !ok {
+		return fallback
+	}
+	return message
+}
+
+// legacyMessage() returns the value of the pre-RFC 7807 "error" member
+func (p problem) legacyMessage() interface{} {
+	if len(p.Errors) == 0 {
+		return p.Detail
+	}
+	messages := make(map[string]string, len(p.Errors))
+	for _, fe := range p.Errors {
+		if _, exists := messages[fe.Field]; !exists {
+			messages[fe.Field] = fe.Message
+		}
+	}
+	return messages
+}
+
 // Server error message
 func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
 	//log the error
 	app.logError(r, err)
-	//prepare a message with error
-	message := "the server encountered an problem and could not process the request"
-	app.errorResponse(w, r, http.StatusInternalServerError, message)
+	app.errorResponse(w, r, problem{
+		Title:     "Internal server error",
+		Status:    http.StatusInternalServerError,
+		Detail:    "the server encountered an problem and could not process the request",
+		Code:      codeServerError,
+		detailKey: "problem.server_error.detail",
+	})
 }
 
 // Method not found response
 func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request) {
-	//prepare a message with error
-	message := "the requested resources could not be found."
-	app.errorResponse(w, r, http.StatusNotFound, message)
+	app.errorResponse(w, r, problem{
+		Title:     "Resource not found",
+		Status:    http.StatusNotFound,
+		Detail:    "the requested resources could not be found.",
+		Code:      codeNotFound,
+		detailKey: "problem.not_found.detail",
+	})
 }
 
 // Method not Allowed response
 func (app *application) MethodNotAllowedReponse(w http.ResponseWriter, r *http.Request) {
-	//prepare a message with error
-	message := fmt.Sprintf("The %s method is not supported for this resource", r.Method)
-	app.errorResponse(w, r, http.StatusInternalServerError, message)
+	app.errorResponse(w, r, problem{
+		Title:     "Method not allowed",
+		Status:    http.StatusMethodNotAllowed,
+		Detail:    fmt.Sprintf("The %s method is not supported for this resource", r.Method),
+		Code:      codeMethodNotAllowed,
+		detailKey: "problem.method_not_allowed.detail",
+		params:    map[string]interface{}{"method": r.Method},
+	})
 }
 
 // User passed a bad request
 func (app *application) badResquestReponse(w http.ResponseWriter, r *http.Request, err error) {
-	app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+	p := problem{
+		Title:  "Bad request",
+		Status: http.StatusBadRequest,
+		Detail: err.Error(),
+		Code:   codeBadRequest,
+	}
+	// errors from readJSON() know their message key
+	var bodyErr *bodyError
+	if errors.As(err, &bodyErr) {
+		p.detailKey = bodyErr.key
+		p.params = bodyErr.params
+	}
+	app.errorResponse(w, r, p)
 }
 
-// Edit Conflict validation errors
-func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
-	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
+// User provided validation errors
+func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, v *validator.Validator) {
+	lang := app.contextGetLanguage(r)
+	// keep every failure, a field may report more than one problem
+	fieldErrors := make([]fieldError, 0, len(v.Failures))
+	for _, failure := range v.Failures {
+		fieldErrors = append(fieldErrors, fieldError{
+			Field:   failure.Field,
+			Code:    failure.Code,
+			Params:  failure.Params,
+			Message: app.validationMessage(lang, failure),
+		})
+	}
+
+	app.errorResponse(w, r, problem{
+		Title:     "Validation failed",
+		Status:    http.StatusUnprocessableEntity,
+		Detail:    "one or more fields failed validation",
+		Code:      codeValidationFailed,
+		detailKey: "problem.validation_failed.detail",
+		Errors:    fieldErrors,
+	})
 }
 
-// User provided validation errors
+// validationMessage() renders a validation failure in the given language. A
+// format specific message such as validation.pattern.email is preferred,
+// failures without a catalog entry keep the message they were recorded with
+func (app *application) validationMessage(lang string, failure validator.FieldError) string {
+	if format, ok := failure.Params["format"].(string); ok {
+		if message, ok := app.catalog.Translate(lang, "validation."+failure.Code+"."+format, failure.Params); ok {
+			return message
+		}
+	}
+	return app.translate(lang, "validation."+failure.Code, failure.Params, failure.Message)
+}
+
+// Edit Conflict validation errors
 func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request) {
-	//prepare a message with error
-	message := "unable to update the record due to an edit conflict, please try again"
-	app.errorResponse(w, r, http.StatusConflict, message)
+	app.errorResponse(w, r, problem{
+		Title:     "Edit conflict",
+		Status:    http.StatusConflict,
+		Detail:    "unable to update the record due to an edit conflict, please try again",
+		Code:      codeEditConflict,
+		detailKey: "problem.edit_conflict.detail",
+	})
+}
+
+// Client asked for a representation we cannot produce
+func (app *application) notAcceptableResponse(w http.ResponseWriter, r *http.Request) {
+	app.errorResponse(w, r, problem{
+		Title:     "Not acceptable",
+		Status:    http.StatusNotAcceptable,
+		Detail:    fmt.Sprintf("unable to produce a response matching %q, supported types are application/json and application/xml", r.Header.Get("Accept")),
+		Code:      codeNotAcceptable,
+		detailKey: "problem.not_acceptable.detail",
+		params:    map[string]interface{}{"accept": r.Header.Get("Accept")},
+	})
+}
+
+// Record is still referenced by other records
+func (app *application) recordInUseResponse(w http.ResponseWriter, r *http.Request) {
+	app.errorResponse(w, r, problem{
+		Title:     "Record in use",
+		Status:    http.StatusConflict,
+		Detail:    "the record is still referenced by other records and cannot be deleted",
+		Code:      codeRecordInUse,
+		detailKey: "problem.record_in_use.detail",
+	})
+}
+
+// The new school looks like schools that already exist
+func (app *application) possibleDuplicateResponse(w http.ResponseWriter, r *http.Request, duplicates []*data.DuplicateCandidate) {
+	app.errorResponse(w, r, problem{
+		Title:      "Possible duplicate",
+		Status:     http.StatusConflict,
+		Detail:     "the school looks like one that already exists, review the duplicates or retry with ?force=true",
+		Code:       codePossibleDupe,
+		detailKey:  "problem.possible_duplicate.detail",
+		extensions: envelope{"duplicates": duplicates},
+	})
+}
+
+// The bearer token is malformed or belongs to no user
+func (app *application) invalidTokenResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	app.errorResponse(w, r, problem{
+		Title:     "Invalid token",
+		Status:    http.StatusUnauthorized,
+		Detail:    "invalid or missing authentication token",
+		Code:      codeInvalidToken,
+		detailKey: "problem.invalid_token.detail",
+	})
+}
+
+// The resource needs a user but the request sent no token
+func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	app.errorResponse(w, r, problem{
+		Title:     "Authentication required",
+		Status:    http.StatusUnauthorized,
+		Detail:    "you must be authenticated to access this resource",
+		Code:      codeAuthRequired,
+		detailKey: "problem.authentication_required.detail",
+	})
+}
+
+// The user is known but may not do this
+func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
+	app.errorResponse(w, r, problem{
+		Title:     "Not permitted",
+		Status:    http.StatusForbidden,
+		Detail:    "your user account does not have the necessary permissions to access this resource",
+		Code:      codeNotPermitted,
+		detailKey: "problem.not_permitted.detail",
+	})
 }
@@ -0,0 +1,120 @@
+// Filename: cmd/api/favorites.go
+
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"appletree.miguelavila.net/internal/data"
+	"appletree.miguelavila.net/internal/validator"
+)
+
+// listFavoritesHandler for GET /v1/users/me/favorites endpoint
+// the schools the user starred, most recent first
+func (app *application) listFavoritesHandler(w http.ResponseWriter, r *http.Request) {
+	var filters data.Filters
+	v := validator.New()
+	qs := r.URL.Query()
+
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	filters.Sort = app.readString(qs, "sort", "-favorited_at")
+	filters.SortList = []string{"id", "name", "favorited_at", "-id", "-name", "-favorited_at"}
+	data.ValidateFilters(v, filters)
+	includes := app.readIncludes(qs, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	schools, metadata, err := app.models.Favorites.GetAll(app.contextGetUser(r).ID, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.loadIncludes(includes, schools...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"schools": schools, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// addFavoriteHandler for PUT /v1/users/me/favorites/:school_id endpoint
+// starring a school twice is harmless, the first time answers 201
+func (app *application) addFavoriteHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readNamedIDParam(r, "school_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	school, err := app.models.Schools.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	inserted, err := app.models.Favorites.Insert(app.contextGetUser(r).ID, school.ID)
+	if err != nil {
+		switch {
+		// the school was deleted in the meantime
+		case errors.Is(err, data.ErrRecordInUse):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	favorite := true
+	school.IsFavorite = &favorite
+	// embed the logo
+	err = app.loadIncludes(nil, school)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	status := http.StatusOK
+	if inserted {
+		status = http.StatusCreated
+	}
+	err = app.writeResponse(w, r, status, envelope{"school": school}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// removeFavoriteHandler for DELETE /v1/users/me/favorites/:school_id endpoint
+func (app *application) removeFavoriteHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readNamedIDParam(r, "school_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Favorites.Delete(app.contextGetUser(r).ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "school successfully removed from favorites"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,102 @@
+// Filename: cmd/api/geo.go
+
+package main
+
+import (
+	"net/http"
+
+	"appletree.miguelavila.net/internal/data"
+	"appletree.miguelavila.net/internal/validator"
+)
+
+// nearbySchoolsHandler for GET /v1/schools/nearby endpoint
+// lists the schools around a point, closest first
+func (app *application) nearbySchoolsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.NearbyFilter
+		data.Filters
+	}
+	// initialize a validator
+	v := validator.New()
+	// get the URL values in a map
+	qs := r.URL.Query()
+
+	v.CheckCode(qs.Get("lat") != "", "lat", validator.CodeRequired, nil, "must be provided")
+	v.CheckCode(qs.Get("lng") != "", "lng", validator.CodeRequired, nil, "must be provided")
+	input.Latitude = app.readFloat(qs, "lat", 0, v)
+	input.Longitude = app.readFloat(qs, "lng", 0, v)
+	input.RadiusKM = app.readFloat(qs, "radius_km", 10, v)
+	input.ViewerID = app.contextGetUser(r).ID
+	// get the page information, results are always ordered by distance
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = "distance"
+	input.Filters.SortList = []string{"distance"}
+
+	data.ValidateNearbyFilter(v, input.NearbyFilter)
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	schools, metadata, err := app.models.Schools.Nearby(input.NearbyFilter, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// embed the logo
+	embedded := make([]*data.School, len(schools))
+	for i, school := range schools {
+		embedded[i] = school.School
+	}
+	err = app.loadIncludes(nil, embedded...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"schools": schools, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// schoolsGeoJSONHandler for GET /v1/schools.geojson endpoint
+// returns the located schools as a GeoJSON FeatureCollection
+func (app *application) schoolsGeoJSONHandler(w http.ResponseWriter, r *http.Request) {
+	schools, err := app.models.Schools.GetAllLocated()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	features := make([]envelope, 0, len(schools))
+	for _, school := range schools {
+		features = append(features, envelope{
+			"type": "Feature",
+			"id":   school.ID,
+			"geometry": envelope{
+				"type": "Point",
+				// GeoJSON positions are longitude first
+				"coordinates": []float64{*school.Longitude, *school.Latitude},
+			},
+			"properties": envelope{
+				"name":    school.Name,
+				"level":   school.Level,
+				"mode":    school.Mode,
+				"address": school.Address,
+				"phone":   school.Phone,
+				"email":   school.Email,
+				"website": school.Website,
+			},
+		})
+	}
+
+	// GeoJSON is always JSON, whatever representation was negotiated
+	r = app.contextSetFormat(r, formatJSON)
+	headers := make(http.Header)
+	headers.Set("Content-Type", "application/geo+json")
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"type": "FeatureCollection", "features": features}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"mime/multipart"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -20,11 +22,16 @@ type envelope map[string]interface{}
 
 // Utility function for reading ID in Endpoint
 func (app *application) readIDParam(r *http.Request) (int64, error) {
+	return app.readNamedIDParam(r, "id")
+}
+
+// readNamedIDParam() reads the id in another segment of nested routes, such as :contact_id
+func (app *application) readNamedIDParam(r *http.Request, name string) (int64, error) {
 	// Use the param
 	// Use the ParamsFormContext
 	params := httprouter.ParamsFromContext(r.Context())
 
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
 	if err != nil || id < 1 {
 		return 0, errors.New("invalid ID parameter")
 	}
@@ -33,32 +40,73 @@ func (app *application) readIDParam(r *http.Request) (int64, error) {
 
 }
 
-func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
-	// Convert our map into a JSON object
-	// js, err := json.Marshal(data)
-	// Format the JSON object for cmd -- Takes more resources than printing it normally
-	js, err := json.MarshalIndent(data, "", "\t")
+// readParam() reads a path segment that is not an id, such as :year
+func (app *application) readParam(r *http.Request, name string) string {
+	return httprouter.ParamsFromContext(r.Context()).ByName(name)
+}
+
+// readIfMatch() reads the version a client expects from the If-Match header,
+// written as "3" or 3. ok is false when the header is missing
+func (app *application) readIfMatch(r *http.Request) (int32, bool, error) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	if value == "" {
+		return 0, false, nil
+	}
+	version, err := strconv.ParseInt(strings.Trim(value, `"`), 10, 32)
+	if err != nil || version < 1 {
+		return 0, false, newBodyError("header.if_match", nil, "the If-Match header must hold a record version")
+	}
+	return int32(version), true, nil
+}
+
+// writeResponse() renders the envelope in the format negotiated from the
+// Accept header and writes it to the client
+func (app *application) writeResponse(w http.ResponseWriter, r *http.Request, status int, data envelope, headers http.Header) error {
+	format := app.contextGetFormat(r)
+	// Compact output saves bandwidth in production, indented output is easier to read in the terminal
+	body, err := encodeResponse(format, data, app.wantsPretty(r))
 
 	if err != nil {
 		return err
 	}
 
 	// Add a newline to make viewing on the terminal easier
-	js = append(js, '\n')
+	body = append(body, '\n')
 
 	// Add the headers
 	for key, value := range headers {
 		w.Header()[key] = value
 	}
 
-	// Specify that we will serve our responses using JSON
-	w.Header().Set("Content-Type", "application/json")
+	// Specify the representation we are serving unless the caller picked a more
+	// specific media type, and let caches know it depends on Accept
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", format.contentType())
+	}
+	w.Header().Add("Vary", "Accept")
 	w.WriteHeader(status)
-	// Write the I I byte slice containing the JSON response body
-	w.Write(js)
+	// Write the byte slice containing the response body
+	w.Write(body)
 	return nil
 }
 
+// bodyError is returned by readJSON() for a badly-formed request body and by
+// readIfMatch() for a bad header. It carries a message key so the response
+// can be localized
+type bodyError struct {
+	key     string
+	params  map[string]interface{}
+	message string
+}
+
+func newBodyError(key string, params map[string]interface{}, message string) *bodyError {
+	return &bodyError{key: key, params: params, message: message}
+}
+
+func (e *bodyError) Error() string {
+	return e.message
+}
+
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
 	// use http.MaxBytesReader() to limit size of response body
 	maxBytes := 1_048_576
@@ -80,27 +128,27 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst int
 		switch {
 		// Check for syntaxError
 		case errors.As(err, &syntaxError):
-			return fmt.Errorf("body contains badly-formed JSON body (at character %d)", syntaxError.Offset)
+			return newBodyError("body.malformed_at", envelope{"offset": syntaxError.Offset}, fmt.Sprintf("body contains badly-formed JSON body (at character %d)", syntaxError.Offset))
 		// Check for wrong body passed by client
 		case errors.Is(err, io.ErrUnexpectedEOF):
-			return errors.New("body contains badly-formed JSON body")
+			return newBodyError("body.malformed", nil, "body contains badly-formed JSON body")
 		// Check for wrong types passed by client
 		case errors.As(err, &unmarshalTypeError):
 			if unmarshalTypeError.Field != "" {
-				return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+				return newBodyError("body.wrong_type_field", envelope{"field": unmarshalTypeError.Field}, fmt.Sprintf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field))
 			}
-			return fmt.Errorf("body contains incorrect JSON type (at character %q)", unmarshalTypeError.Offset)
+			return newBodyError("body.wrong_type_at", envelope{"offset": unmarshalTypeError.Offset}, fmt.Sprintf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset))
 		case errors.Is(err, io.EOF):
-			return errors.New("body must not be empty")
+			return newBodyError("body.empty", nil, "body must not be empty")
 
 		// Check for unmappable fields
 		case strings.HasPrefix(err.Error(), "json: unknown field "):
-			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field")
-			return fmt.Errorf("body contains unknown key %s", fieldName)
+			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
+			return newBodyError("body.unknown_key", envelope{"key": fieldName}, fmt.Sprintf("body contains unknown key %s", fieldName))
 
 		// Body size to large
 		case err.Error() == "http: request body too large":
-			return fmt.Errorf("body must not exceed %d bytes", maxBytes)
+			return newBodyError("body.too_large", envelope{"max": maxBytes}, fmt.Sprintf("body must not exceed %d bytes", maxBytes))
 		// Pass non-nil error
 		case errors.As(err, &invalidUnmarshalError):
 			panic(err)
@@ -111,12 +159,64 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst int
 	// Call Decode() again
 	err = dec.Decode(&struct{}{})
 	if err != io.EOF {
-		return errors.New("body must only contain a single JSON value")
+		return newBodyError("body.multiple_values", nil, "body must only contain a single JSON value")
 	}
 
 	return nil
 }
 
+// background() runs fn in its own goroutine, a panic is logged instead of
+// taking the server down
+func (app *application) background(fn func()) {
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Printf("background task panicked: %v", err)
+			}
+		}()
+		fn()
+	}()
+}
+
+// multipartMemory is how much of a multipart body is kept in memory, the
+// rest is spooled to temporary files that are removed after the request
+const multipartMemory = 1 << 20
+
+// readFile() reads the file sent in a field of a multipart/form-data body
+// together with the other form fields. Files larger than maxBytes are refused
+func (app *application) readFile(w http.ResponseWriter, r *http.Request, field string, maxBytes int64) ([]byte, *multipart.FileHeader, error) {
+	// leave room for the form fields and the multipart framing
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+multipartMemory)
+
+	err := r.ParseMultipartForm(multipartMemory)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesError):
+			return nil, nil, newBodyError("body.too_large", envelope{"max": maxBytes}, fmt.Sprintf("body must not exceed %d bytes", maxBytes))
+		case errors.Is(err, http.ErrNotMultipart):
+			return nil, nil, newBodyError("body.not_multipart", nil, "body must be multipart/form-data")
+		default:
+			return nil, nil, newBodyError("body.malformed_multipart", nil, "body contains a badly-formed multipart/form-data body")
+		}
+	}
+
+	file, header, err := r.FormFile(field)
+	if err != nil {
+		return nil, nil, newBodyError("body.missing_file", envelope{"field": field}, fmt.Sprintf("body must contain a file in the %q field", field))
+	}
+	defer file.Close()
+
+	if header.Size > maxBytes {
+		return nil, nil, newBodyError("body.too_large", envelope{"max": maxBytes}, fmt.Sprintf("body must not exceed %d bytes", maxBytes))
+	}
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	return content, header, nil
+}
+
 // readString() method returns a string value from the query string
 // or returns an default value if no matching value is found
 func (app *application) readString(qs url.Values, key string, defaultValue string) string {
@@ -152,9 +252,45 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	// convert the string value to an integer
 	valueInt, err := strconv.Atoi(value)
 	if err != nil {
-		v.AddError(key, fmt.Sprintf("must be an integer value"))
+		v.AddFailure(key, validator.CodeInteger, nil, "must be an integer value")
 		return defaultValue
 	}
 	return valueInt
 
 }
+
+// readBool() method converts a string value from the query to a boolean value
+// if the value cannot be converted then a validation error is added
+// to the validation error map
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	// Get the value
+	value := qs.Get(key)
+	if value == "" {
+		return defaultValue
+	}
+	// convert the string value to a boolean
+	valueBool, err := strconv.ParseBool(value)
+	if err != nil {
+		v.AddFailure(key, validator.CodeBoolean, nil, "must be a boolean value")
+		return defaultValue
+	}
+	return valueBool
+}
+
+// readFloat() method converts a string value from the query to a float value
+// if the value cannot be converted then a validation error is added
+// to the validation error map
+func (app *application) readFloat(qs url.Values, key string, defaultValue float64, v *validator.Validator) float64 {
+	// Get the value
+	value := qs.Get(key)
+	if value == "" {
+		return defaultValue
+	}
+	// convert the string value to a float
+	valueFloat, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(valueFloat) || math.IsInf(valueFloat, 0) {
+		v.AddFailure(key, validator.CodeNumber, nil, "must be a number")
+		return defaultValue
+	}
+	return valueFloat
+}
@@ -0,0 +1,62 @@
+// Filename: cmd/api/helpers_test.go
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"appletree.miguelavila.net/internal/i18n"
+)
+
+func TestReadIfMatch(t *testing.T) {
+	catalog, err := i18n.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &application{catalog: catalog}
+
+	tests := []struct {
+		header  string
+		version int32
+		ok      bool
+		wantErr bool
+	}{
+		{"", 0, false, false},
+		{`"3"`, 3, true, false},
+		{"3", 3, true, false},
+		{` "12" `, 12, true, false},
+		{"*", 0, false, true},
+		{`"0"`, 0, false, true},
+		{`"-1"`, 0, false, true},
+		{`W/"3"`, 0, false, true},
+		{`"99999999999"`, 0, false, true},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPut, "/v1/schools/1/enrollments/2023-2024", nil)
+		if tt.header != "" {
+			r.Header.Set("If-Match", tt.header)
+		}
+		version, ok, err := app.readIfMatch(r)
+		if tt.wantErr {
+			var bodyErr *bodyError
+			if !errors.As(err, &bodyErr) {
+				t.Errorf("readIfMatch(%q) error = %v, want a bodyError", tt.header, err)
+				continue
+			}
+			// the message is localized rather than falling back to English
+			en, found := catalog.Translate("en", bodyErr.key, bodyErr.params)
+			es, _ := catalog.Translate("es", bodyErr.key, bodyErr.params)
+			if !found || en == es {
+				t.Errorf("readIfMatch(%q): %q is not translated", tt.header, bodyErr.key)
+			}
+			continue
+		}
+		if err != nil || version != tt.version || ok != tt.ok {
+			t.Errorf("readIfMatch(%q) = %d, %v, %v, want %d, %v, nil", tt.header, version, ok, err, tt.version, tt.ok)
+		}
+	}
+}
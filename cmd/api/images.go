@@ -0,0 +1,268 @@
+// Filename: cmd/api/images.go
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"appletree.miguelavila.net/internal/blob"
+	"appletree.miguelavila.net/internal/data"
+	"appletree.miguelavila.net/internal/imaging"
+	"appletree.miguelavila.net/internal/validator"
+)
+
+// newBlobKey() returns an unguessable key below prefix, e.g. images/9f86d081...
+func newBlobKey(prefix string) (string, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return prefix + "/" + hex.EncodeToString(token), nil
+}
+
+// setImageURLs() fills in where the blobs of the images are downloaded from
+func (app *application) setImageURLs(images ...*data.Image) {
+	for _, image := range images {
+		image.URL = app.blobs.URL(image.OriginalKey())
+		image.Thumbnails = make(map[string]string, len(data.ThumbnailSizes))
+		for _, size := range data.ThumbnailSizes {
+			image.Thumbnails[strconv.Itoa(size)] = app.blobs.URL(image.ThumbnailKey(size))
+		}
+	}
+}
+
+// deleteImageBlobs() removes the stored files of images whose rows are gone.
+// Failures are only logged, the images are already unreachable
+func (app *application) deleteImageBlobs(images ...*data.Image) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, image := range images {
+		for _, key := range image.BlobKeys() {
+			if err := app.blobs.Delete(ctx, key); err != nil {
+				app.logger.Printf("deleting blob %s: %v", key, err)
+			}
+		}
+	}
+}
+
+// listImagesHandler for GET /v1/schools/:id/images endpoint
+func (app *application) listImagesHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	images, err := app.models.Images.GetAllForSchools([]int64{school.ID})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	list := images[school.ID]
+	if list == nil {
+		list = []*data.Image{}
+	}
+	app.setImageURLs(list...)
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"images": list}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// uploadImageHandler for POST /v1/schools/:id/images endpoint
+// takes a multipart/form-data body with the image in the "file" field and
+// its "kind", logo or photo. Only the pixels are kept, metadata such as EXIF
+// is dropped when the image is encoded again
+func (app *application) uploadImageHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	content, _, err := app.readFile(w, r, "file", app.config.images.maxBytes)
+	if err != nil {
+		app.badResquestReponse(w, r, err)
+		return
+	}
+	kind := r.FormValue("kind")
+	if kind == "" {
+		kind = "photo"
+	}
+
+	v := validator.New()
+	v.CheckCode(validator.In(kind, data.ImageKinds...), "kind", validator.CodeOneOf, validator.Params{"values": data.ImageKinds}, "must be logo or photo")
+
+	img, err := imaging.Decode(content, app.config.images.maxDimension)
+	if err != nil {
+		switch {
+		case errors.Is(err, imaging.ErrUnsupportedFormat):
+			v.AddFailure("file", validator.CodeOneOf, validator.Params{"values": imaging.ContentTypes}, "must be a JPEG, PNG or GIF image")
+		case errors.Is(err, imaging.ErrTooLarge):
+			v.AddFailure("file", validator.CodeMax, validator.Params{"max": app.config.images.maxDimension}, fmt.Sprintf("must not be wider or taller than %d pixels", app.config.images.maxDimension))
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	key, err := newBlobKey("images")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	image := &data.Image{
+		SchoolID: school.ID,
+		Kind:     kind,
+		Key:      key,
+		Ext:      img.Ext(),
+		Width:    img.Width(),
+		Height:   img.Height(),
+	}
+
+	// store the original and every thumbnail before the row points at them
+	var buf bytes.Buffer
+	if err := img.Encode(&buf); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	image.Size = int64(buf.Len())
+	err = app.blobs.Put(r.Context(), image.OriginalKey(), &buf)
+	for _, size := range data.ThumbnailSizes {
+		if err != nil {
+			break
+		}
+		buf.Reset()
+		if err = img.Thumbnail(size).Encode(&buf); err == nil {
+			err = app.blobs.Put(r.Context(), image.ThumbnailKey(size), &buf)
+		}
+	}
+	if err != nil {
+		app.deleteImageBlobs(image)
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	replaced, err := app.models.Images.Insert(image)
+	if err != nil {
+		app.deleteImageBlobs(image)
+		switch {
+		case errors.Is(err, data.ErrImageLimit):
+			v.AddFailure("kind", validator.CodeMaxItems, validator.Params{"max": data.MaxPhotos}, fmt.Sprintf("must not exceed %d photos per school", data.MaxPhotos))
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// the previous logo is gone
+	app.deleteImageBlobs(replaced...)
+
+	app.setImageURLs(image)
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/schools/%d/images/%d", school.ID, image.ID))
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"image": image}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showImageHandler for GET /v1/schools/:id/images/:image_id endpoint
+func (app *application) showImageHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+	id, err := app.readNamedIDParam(r, "image_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	image, err := app.models.Images.Get(school.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.setImageURLs(image)
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"image": image}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteImageHandler for DELETE /v1/schools/:id/images/:image_id endpoint
+func (app *application) deleteImageHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+	id, err := app.readNamedIDParam(r, "image_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	image, err := app.models.Images.Delete(school.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.deleteImageBlobs(image)
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "image successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// serveFileHandler for GET /v1/files/*key endpoint
+// serves the stored images, other blobs have endpoints of their own
+func (app *application) serveFileHandler(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(app.readParam(r, "key"), "/")
+	if !strings.HasPrefix(key, "images/") {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	file, err := app.blobs.Open(r.Context(), key)
+	if err != nil {
+		switch {
+		case errors.Is(err, blob.ErrNotFound), errors.Is(err, blob.ErrInvalidKey):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	defer file.Close()
+
+	// a key is never reused, so the file never changes
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, path.Base(key), time.Time{}, file)
+}
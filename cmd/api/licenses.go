@@ -0,0 +1,277 @@
+// Filename: cmd/api/licenses.go
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"appletree.miguelavila.net/internal/data"
+	"appletree.miguelavila.net/internal/notify"
+	"appletree.miguelavila.net/internal/validator"
+)
+
+// watchLicenses() flags the licenses about to expire now and then every
+// checkInterval for as long as the server runs
+func (app *application) watchLicenses() {
+	ticker := time.NewTicker(app.config.licenses.checkInterval)
+	defer ticker.Stop()
+	for {
+		app.checkExpiringLicenses()
+		<-ticker.C
+	}
+}
+
+// checkExpiringLicenses() sends an alert for every license expiring within
+// expiringDays. A license is only marked once its alert went out, so a
+// failed notification is retried on the next check
+func (app *application) checkExpiringLicenses() {
+	licenses, err := app.models.Licenses.GetExpiring(app.config.licenses.expiringDays)
+	if err != nil {
+		app.logger.Printf("listing expiring licenses: %v", err)
+		return
+	}
+	for _, license := range licenses {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := app.notifier.Notify(ctx, notify.Message{
+			Kind:    "license_expiring",
+			Subject: fmt.Sprintf("License %s of %s expires on %s", license.Number, license.SchoolName, license.ExpiresOn),
+			Fields: map[string]string{
+				"school_id":    fmt.Sprint(license.SchoolID),
+				"license_id":   fmt.Sprint(license.ID),
+				"issuing_body": license.IssuingBody,
+				"expires_on":   license.ExpiresOn,
+			},
+		})
+		cancel()
+		if err != nil {
+			app.logger.Printf("notifying expiry of license %d: %v", license.ID, err)
+			continue
+		}
+		if err := app.models.Licenses.MarkNotified(license.ID); err != nil {
+			app.logger.Printf("flagging license %d: %v", license.ID, err)
+		}
+	}
+}
+
+// listLicensesHandler for GET /v1/schools/:id/licenses endpoint
+func (app *application) listLicensesHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	licenses, err := app.models.Licenses.GetAllForSchool(school.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	now := time.Now()
+	for _, license := range licenses {
+		license.SetState(now, app.config.licenses.expiringDays)
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"licenses": licenses}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createLicenseHandler for POST /v1/schools/:id/licenses endpoint
+func (app *application) createLicenseHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		IssuingBody string `json:"issuing_body"`
+		Number      string `json:"number"`
+		Status      string `json:"status"`
+		IssuedOn    string `json:"issued_on"`
+		ExpiresOn   string `json:"expires_on"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badResquestReponse(w, r, err)
+		return
+	}
+
+	license := &data.License{
+		SchoolID:    school.ID,
+		IssuingBody: input.IssuingBody,
+		Number:      input.Number,
+		Status:      input.Status,
+		IssuedOn:    input.IssuedOn,
+		ExpiresOn:   input.ExpiresOn,
+	}
+	if license.Status == "" {
+		license.Status = "active"
+	}
+
+	v := validator.New()
+	if data.ValidateLicense(v, license); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Licenses.Insert(license)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateRecord):
+			v.AddFailure("number", validator.CodeUnique, nil, "is already registered for this issuing body")
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	license.SetState(time.Now(), app.config.licenses.expiringDays)
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/schools/%d/licenses/%d", school.ID, license.ID))
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"license": license}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// licenseFromPath() loads the license named by :license_id of the school
+func (app *application) licenseFromPath(w http.ResponseWriter, r *http.Request, school *data.School) (*data.License, bool) {
+	id, err := app.readNamedIDParam(r, "license_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	license, err := app.models.Licenses.Get(school.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	license.SetState(time.Now(), app.config.licenses.expiringDays)
+	return license, true
+}
+
+// showLicenseHandler for GET /v1/schools/:id/licenses/:license_id endpoint
+func (app *application) showLicenseHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+	license, ok := app.licenseFromPath(w, r, school)
+	if !ok {
+		return
+	}
+
+	err := app.writeResponse(w, r, http.StatusOK, envelope{"license": license}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateLicenseHandler for PATCH /v1/schools/:id/licenses/:license_id endpoint
+func (app *application) updateLicenseHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+	license, ok := app.licenseFromPath(w, r, school)
+	if !ok {
+		return
+	}
+
+	// pointers tell us which fields the client wants to change
+	var input struct {
+		IssuingBody *string `json:"issuing_body"`
+		Number      *string `json:"number"`
+		Status      *string `json:"status"`
+		IssuedOn    *string `json:"issued_on"`
+		ExpiresOn   *string `json:"expires_on"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badResquestReponse(w, r, err)
+		return
+	}
+
+	if input.IssuingBody != nil {
+		license.IssuingBody = *input.IssuingBody
+	}
+	if input.Number != nil {
+		license.Number = *input.Number
+	}
+	if input.Status != nil {
+		license.Status = *input.Status
+	}
+	if input.IssuedOn != nil {
+		license.IssuedOn = *input.IssuedOn
+	}
+	if input.ExpiresOn != nil {
+		license.ExpiresOn = *input.ExpiresOn
+	}
+
+	v := validator.New()
+	if data.ValidateLicense(v, license); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Licenses.Update(license)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateRecord):
+			v.AddFailure("number", validator.CodeUnique, nil, "is already registered for this issuing body")
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	license.SetState(time.Now(), app.config.licenses.expiringDays)
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"license": license}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteLicenseHandler for DELETE /v1/schools/:id/licenses/:license_id endpoint
+func (app *application) deleteLicenseHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+	id, err := app.readNamedIDParam(r, "license_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Licenses.Delete(school.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "license successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
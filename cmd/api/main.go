@@ -12,7 +12,15 @@ import (
 	"os"
 	"time"
 
+	"appletree.miguelavila.net/internal/blob"
+	"appletree.miguelavila.net/internal/cache"
 	"appletree.miguelavila.net/internal/data"
+	"appletree.miguelavila.net/internal/geocode"
+	"appletree.miguelavila.net/internal/i18n"
+	"appletree.miguelavila.net/internal/moderation"
+	"appletree.miguelavila.net/internal/notify"
+	"appletree.miguelavila.net/internal/scan"
+	"appletree.miguelavila.net/internal/validator"
 	_ "github.com/lib/pq"
 )
 
@@ -29,13 +37,68 @@ type config struct {
 		maxIdleConns int
 		maxIdleTime  string
 	}
+	// legacyErrors keeps the old {"error": ...} body while clients migrate to problem+json
+	legacyErrors bool
+	// gazetteer is the CSV of places used to geocode addresses offline
+	gazetteer string
+	// suggest sizes the in-memory cache of the typeahead endpoint
+	suggest struct {
+		cacheSize int
+		cacheTTL  time.Duration
+	}
+	// statsTTL is how long an aggregate of /v1/schools/stats is reused
+	statsTTL time.Duration
+	// vocabTTL is how long the levels, modes and districts are reused
+	vocabTTL time.Duration
+	// blob is where uploaded files are stored and served from
+	blob struct {
+		dir string
+		url string
+	}
+	// images limits the logos and photos schools upload
+	images struct {
+		maxBytes     int64
+		maxDimension int
+	}
+	// licenses configures the expiry alerts, a license expiring within
+	// expiringDays is flagged every checkInterval
+	licenses struct {
+		expiringDays  int
+		checkInterval time.Duration
+	}
+	// documents limits the files schools attach and where they are scanned
+	documents struct {
+		maxBytes  int64
+		clamdAddr string
+	}
+	// profanityWords is the word list reviews are screened with
+	profanityWords string
 }
 
 // dependencies injections
 type application struct {
-	config config
-	logger *log.Logger
-	models data.Models
+	config  config
+	logger  *log.Logger
+	models  data.Models
+	catalog *i18n.Catalog
+	// websites is used by ?check=true to probe school websites
+	websites *validator.WebsiteChecker
+	// gazetteer geocodes school addresses, nil when geocoding is disabled
+	gazetteer *geocode.Gazetteer
+	// suggestions caches typeahead answers by limit and query
+	suggestions *cache.LRU[string, []*data.Suggestion]
+	// stats caches the aggregates by filter
+	stats *cache.LRU[string, *data.SchoolStats]
+	// vocab caches the levels, modes and districts, purged when a term changes
+	vocab *cache.LRU[string, data.Vocabularies]
+	// blobs stores the uploaded files
+	blobs blob.Store
+	// scanner checks documents before they are served
+	scanner scan.Scanner
+	// notifier delivers the license expiry alerts
+	notifier notify.Notifier
+	// profanity flags reviews for the moderators
+	profanity moderation.Filter
 }
 
 func main() {
@@ -47,6 +110,21 @@ func main() {
 	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
 	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-open-conns", 25, "PostgreSQL max idle open connections")
 	flag.StringVar(&cfg.db.maxIdleTime, "db-max-idle-open-time", "15m", "PostgreSQL max connections idle time")
+	flag.BoolVar(&cfg.legacyErrors, "legacy-errors", false, "Send errors in the legacy {\"error\": ...} shape instead of problem+json")
+	flag.StringVar(&cfg.gazetteer, "gazetteer", "./geodata/gazetteer.csv", "Gazetteer CSV used to geocode addresses, empty to disable")
+	flag.IntVar(&cfg.suggest.cacheSize, "suggest-cache-size", 1000, "Typeahead answers kept in memory, 0 to disable")
+	flag.DurationVar(&cfg.suggest.cacheTTL, "suggest-cache-ttl", time.Minute, "How long a typeahead answer is kept in memory")
+	flag.DurationVar(&cfg.statsTTL, "stats-cache-ttl", 5*time.Minute, "How long school statistics are cached, 0 to disable")
+	flag.DurationVar(&cfg.vocabTTL, "vocab-cache-ttl", 10*time.Minute, "How long levels, modes and districts are cached, 0 to keep them until a term changes")
+	flag.StringVar(&cfg.blob.dir, "blob-dir", "./uploads", "Directory uploaded files are stored in")
+	flag.StringVar(&cfg.blob.url, "blob-url", "/v1/files", "Base URL uploaded files are served from")
+	flag.Int64Var(&cfg.images.maxBytes, "image-max-bytes", 5<<20, "Largest image upload in bytes")
+	flag.IntVar(&cfg.images.maxDimension, "image-max-dimension", 4096, "Largest width or height of an image upload in pixels")
+	flag.Int64Var(&cfg.documents.maxBytes, "document-max-bytes", 20<<20, "Largest document upload in bytes")
+	flag.StringVar(&cfg.documents.clamdAddr, "clamd-addr", "", "clamd socket path or host:port documents are scanned with, empty to skip scanning")
+	flag.IntVar(&cfg.licenses.expiringDays, "license-expiring-days", 30, "Days before its expiry a license counts as expiring")
+	flag.DurationVar(&cfg.licenses.checkInterval, "license-check-interval", 24*time.Hour, "How often expiring licenses are flagged, 0 to disable")
+	flag.StringVar(&cfg.profanityWords, "profanity-words", "", "File of words that flag a review for moderation, one per line, empty to disable")
 	flag.Parse()
 
 	//create a logger ~ use := for undeclared var
@@ -63,12 +141,67 @@ func main() {
 	// log successful connection
 	logger.Printf("database connection pool established")
 
+	// load the translated messages embedded in the binary
+	catalog, err := i18n.Load()
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	// load the gazetteer once, geocoding never leaves this process
+	var gazetteer *geocode.Gazetteer
+	if cfg.gazetteer != "" {
+		gazetteer, err = geocode.Load(cfg.gazetteer)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		logger.Printf("gazetteer loaded with %d places", gazetteer.Len())
+	}
+
+	// uploaded files live on the local disk
+	blobs, err := blob.NewLocal(cfg.blob.dir, cfg.blob.url)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	// documents are served without a scan unless clamd is configured
+	var scanner scan.Scanner = scan.Noop{}
+	if cfg.documents.clamdAddr != "" {
+		scanner = scan.NewClamAV(cfg.documents.clamdAddr)
+	}
+
+	// reviews are only screened when a word list is given
+	var profanity moderation.Filter = moderation.Noop{}
+	if cfg.profanityWords != "" {
+		words, err := moderation.LoadWordList(cfg.profanityWords)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		logger.Printf("profanity filter loaded with %d words", words.Len())
+		profanity = words
+	}
+
 	//create install of out appmi
 	app := &application{
-		config: cfg,
-		logger: logger,
-		models: *data.NewModels(db),
+		config:      cfg,
+		logger:      logger,
+		models:      *data.NewModels(db),
+		catalog:     catalog,
+		websites:    validator.NewWebsiteChecker(),
+		gazetteer:   gazetteer,
+		suggestions: cache.New[string, []*data.Suggestion](cfg.suggest.cacheSize, cfg.suggest.cacheTTL),
+		stats:       cache.New[string, *data.SchoolStats](statsCacheSize(cfg.statsTTL), cfg.statsTTL),
+		vocab:       cache.New[string, data.Vocabularies](1, cfg.vocabTTL),
+		blobs:       blobs,
+		scanner:     scanner,
+		notifier:    notify.Log{Logger: logger},
+		profanity:   profanity,
+	}
+	// finish the scans an earlier run left behind
+	app.background(app.scanPendingDocuments)
+	if cfg.licenses.checkInterval > 0 {
+		app.background(app.watchLicenses)
 	}
+
 	//create out new servemux
 	mux := http.NewServeMux()
 	mux.HandleFunc("/v1/healthcheck", app.healthcheckHandler)
@@ -89,6 +222,14 @@ func main() {
 
 }
 
+// statsCacheSize() disables the statistics cache when no ttl is set
+func statsCacheSize(ttl time.Duration) int {
+	if ttl <= 0 {
+		return 0
+	}
+	return 100
+}
+
 // openDB return a *sql.DB instance
 func openDB(cfg config) (*sql.DB, error) {
 	db, err := sql.Open("postgres", cfg.db.dsn)
@@ -0,0 +1,102 @@
+// Filename: cmd/api/middleware.go
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"appletree.miguelavila.net/internal/data"
+	"appletree.miguelavila.net/internal/i18n"
+	"github.com/julienschmidt/httprouter"
+)
+
+// negotiateContent() picks the response format from the Accept header before
+// the handler runs, so an unsupported media type is rejected without side effects.
+// The routes of acceptAny produce their own media type, such as a calendar feed
+// or a file download, and take any Accept header; errors fall back to JSON
+func (app *application) negotiateContent(next http.Handler, acceptAny *httprouter.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		format, ok := negotiateFormat(r.Header.Get("Accept"))
+		if !ok {
+			if handle, _, _ := acceptAny.Lookup(r.Method, r.URL.Path); handle == nil {
+				app.notAcceptableResponse(w, r)
+				return
+			}
+		}
+		r = app.contextSetFormat(r, format)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// negotiateLanguage() picks the language of the messages from the Accept-Language header
+func (app *application) negotiateLanguage(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lang := i18n.DefaultLanguage
+		if app.catalog != nil {
+			lang = app.catalog.Negotiate(r.Header.Get("Accept-Language"))
+		}
+		w.Header().Set("Content-Language", lang)
+		w.Header().Add("Vary", "Accept-Language")
+		r = app.contextSetLanguage(r, lang)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticate() identifies the user from an "Authorization: Bearer <token>"
+// header. Requests without the header go on as the anonymous user, a token
+// that is malformed or unknown is rejected
+func (app *application) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the response depends on who is asking
+		w.Header().Add("Vary", "Authorization")
+
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			r = app.contextSetUser(r, data.AnonymousUser)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		scheme, token, ok := strings.Cut(header, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") || !data.ValidTokenPlaintext(token) {
+			app.invalidTokenResponse(w, r)
+			return
+		}
+		user, err := app.models.Users.GetForToken(token)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.invalidTokenResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		r = app.contextSetUser(r, user)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireUser() only lets authenticated users through to next
+func (app *application) requireUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.contextGetUser(r).IsAnonymous() {
+			app.authenticationRequiredResponse(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// requireModerator() only lets moderators through to next
+func (app *application) requireModerator(next http.HandlerFunc) http.HandlerFunc {
+	return app.requireUser(func(w http.ResponseWriter, r *http.Request) {
+		if !app.contextGetUser(r).Moderator {
+			app.notPermittedResponse(w, r)
+			return
+		}
+		next(w, r)
+	})
+}
@@ -0,0 +1,346 @@
+// Filename: cmd/api/programs.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"appletree.miguelavila.net/internal/data"
+	"appletree.miguelavila.net/internal/validator"
+)
+
+// includeNames lists the related records ?include= can embed in schools
+var includeNames = []string{"programs", "hours", "images"}
+
+// readIncludes() reads ?include=programs,hours,images
+func (app *application) readIncludes(qs url.Values, v *validator.Validator) []string {
+	includes := app.readCSV(qs, "include", []string{})
+	for i, include := range includes {
+		v.CheckCode(validator.In(include, includeNames...), validator.Index("include", i), validator.CodeOneOf, validator.Params{"values": includeNames}, "must be a known include")
+	}
+	return includes
+}
+
+// loadIncludes() embeds the requested related records in the schools. The
+// logo is always embedded, the photos only with ?include=images
+func (app *application) loadIncludes(includes []string, schools ...*data.School) error {
+	ids := make([]int64, 0, len(schools))
+	for _, school := range schools {
+		ids = append(ids, school.ID)
+	}
+	if validator.In("images", includes...) {
+		images, err := app.models.Images.GetAllForSchools(ids)
+		if err != nil {
+			return err
+		}
+		for _, school := range schools {
+			school.Images = images[school.ID]
+			app.setImageURLs(school.Images...)
+			// the logo is listed first
+			if len(school.Images) > 0 && school.Images[0].Kind == "logo" {
+				school.Logo = school.Images[0]
+			}
+		}
+	} else {
+		logos, err := app.models.Images.GetLogosForSchools(ids)
+		if err != nil {
+			return err
+		}
+		for _, school := range schools {
+			if logo, ok := logos[school.ID]; ok {
+				app.setImageURLs(logo)
+				school.Logo = logo
+			}
+		}
+	}
+	if validator.In("programs", includes...) {
+		programs, err := app.models.Programs.GetAllForSchools(ids)
+		if err != nil {
+			return err
+		}
+		for _, school := range schools {
+			school.Programs = programs[school.ID]
+		}
+	}
+	if validator.In("hours", includes...) {
+		hours, err := app.models.Calendar.GetHoursForSchools(ids)
+		if err != nil {
+			return err
+		}
+		for _, school := range schools {
+			school.OpeningHours = hours[school.ID]
+		}
+	}
+	return nil
+}
+
+// listProgramsHandler for GET /v1/programs endpoint
+// searches the programs of every school
+func (app *application) listProgramsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.ProgramFilter
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Name = app.readString(qs, "name", "")
+	input.SchoolLevel = app.readString(qs, "school_level", "")
+	input.Mode = app.readCSV(qs, "mode", []string{})
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortList = []string{"id", "name", "capacity", "-id", "-name", "-capacity"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	// the level and mode filters accept codes or aliases
+	vocab, err := app.vocabularies()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if code, ok := vocab.Levels.Resolve(input.SchoolLevel); ok {
+		input.SchoolLevel = code
+	}
+	for i, mode := range input.Mode {
+		if code, ok := vocab.Modes.Resolve(mode); ok {
+			input.Mode[i] = code
+		}
+	}
+
+	programs, metadata, err := app.models.Programs.GetAll(input.ProgramFilter, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"programs": programs, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listSchoolProgramsHandler for GET /v1/schools/:id/programs endpoint
+func (app *application) listSchoolProgramsHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	programs, err := app.models.Programs.GetAllForSchools([]int64{school.ID})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	list := programs[school.ID]
+	if list == nil {
+		list = []*data.Program{}
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"programs": list}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createProgramHandler for POST /v1/schools/:id/programs endpoint
+func (app *application) createProgramHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name        string   `json:"name"`
+		Description string   `json:"description"`
+		Mode        []string `json:"mode"`
+		Capacity    *int32   `json:"capacity"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badResquestReponse(w, r, err)
+		return
+	}
+
+	program := &data.Program{
+		SchoolID:    school.ID,
+		Name:        input.Name,
+		Description: input.Description,
+		Mode:        input.Mode,
+		Capacity:    input.Capacity,
+	}
+
+	modes, err := app.models.Modes.Vocabulary()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateProgram(v, program, school, modes); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Programs.Insert(program)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateRecord):
+			v.AddFailure("name", validator.CodeUnique, nil, "is already used by another program of the school")
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/schools/%d/programs/%d", school.ID, program.ID))
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"program": program}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// programFromPath() loads the program named by :program_id of the school
+func (app *application) programFromPath(w http.ResponseWriter, r *http.Request, school *data.School) (*data.Program, bool) {
+	id, err := app.readNamedIDParam(r, "program_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	program, err := app.models.Programs.Get(school.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return program, true
+}
+
+// showProgramHandler for GET /v1/schools/:id/programs/:program_id endpoint
+func (app *application) showProgramHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+	program, ok := app.programFromPath(w, r, school)
+	if !ok {
+		return
+	}
+
+	err := app.writeResponse(w, r, http.StatusOK, envelope{"program": program}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateProgramHandler for PATCH /v1/schools/:id/programs/:program_id endpoint
+func (app *application) updateProgramHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+	program, ok := app.programFromPath(w, r, school)
+	if !ok {
+		return
+	}
+
+	// pointers tell us which fields the client wants to change
+	var input struct {
+		Name        *string  `json:"name"`
+		Description *string  `json:"description"`
+		Mode        []string `json:"mode"`
+		Capacity    *int32   `json:"capacity"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badResquestReponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		program.Name = *input.Name
+	}
+	if input.Description != nil {
+		program.Description = *input.Description
+	}
+	if input.Mode != nil {
+		program.Mode = input.Mode
+	}
+	if input.Capacity != nil {
+		program.Capacity = input.Capacity
+	}
+
+	modes, err := app.models.Modes.Vocabulary()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateProgram(v, program, school, modes); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Programs.Update(program)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateRecord):
+			v.AddFailure("name", validator.CodeUnique, nil, "is already used by another program of the school")
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"program": program}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteProgramHandler for DELETE /v1/schools/:id/programs/:program_id endpoint
+func (app *application) deleteProgramHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+	id, err := app.readNamedIDParam(r, "program_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Programs.Delete(school.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "program successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,261 @@
+// Filename: cmd/api/render.go
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// responseFormat identifies the representation sent back to the client
+type responseFormat string
+
+const (
+	formatJSON responseFormat = "json"
+	formatXML  responseFormat = "xml"
+)
+
+// contentType() returns the media type written in the Content-Type header
+func (f responseFormat) contentType() string {
+	if f == formatXML {
+		return "application/xml"
+	}
+	return "application/json"
+}
+
+// problemContentType() returns the RFC 7807 media type used for error responses
+func (f responseFormat) problemContentType() string {
+	if f == formatXML {
+		return "application/problem+xml"
+	}
+	return "application/problem+json"
+}
+
+// supportedMediaTypes maps the media types the API can produce to a format.
+// The order matters: the first entry wins when the client accepts anything
+var supportedMediaTypes = []struct {
+	mediaType string
+	format    responseFormat
+}{
+	{"application/json", formatJSON},
+	{"application/xml", formatXML},
+	{"text/xml", formatXML},
+	{"application/geo+json", formatJSON},
+}
+
+// negotiateFormat() picks a response format from the Accept header.
+// An empty header means the client accepts anything. The second return
+// value is false when none of the acceptable media types can be produced
+func negotiateFormat(accept string) (responseFormat, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return formatJSON, true
+	}
+
+	// media types the client refused with q=0, a wildcard must not bring them back
+	excluded := make(map[string]bool)
+	for _, part := range strings.Split(accept, ",") {
+		mediaRange, quality := parseMediaRange(part)
+		if quality <= 0 && !strings.HasSuffix(mediaRange, "/*") {
+			excluded[mediaRange] = true
+		}
+	}
+
+	bestFormat := formatJSON
+	bestQuality := 0.0
+	bestSpecificity := -1
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaRange, quality := parseMediaRange(part)
+		if quality <= 0 {
+			continue
+		}
+		for _, supported := range supportedMediaTypes {
+			specificity, ok := matchMediaRange(mediaRange, supported.mediaType)
+			if !ok {
+				continue
+			}
+			// the response is labelled with the content type of the format, so
+			// it must not be one the client refused either
+			if specificity < 2 && (excluded[supported.mediaType] || excluded[supported.format.contentType()]) {
+				continue
+			}
+			// prefer the highest quality, then the most specific range
+			if quality > bestQuality || (quality == bestQuality && specificity > bestSpecificity) {
+				bestFormat = supported.format
+				bestQuality = quality
+				bestSpecificity = specificity
+			}
+			break
+		}
+	}
+
+	if bestQuality == 0 {
+		return formatJSON, false
+	}
+	return bestFormat, true
+}
+
+// parseMediaRange() splits an Accept header entry into its media range and q value
+func parseMediaRange(part string) (string, float64) {
+	params := strings.Split(part, ";")
+	mediaRange := strings.ToLower(strings.TrimSpace(params[0]))
+	quality := 1.0
+	for _, param := range params[1:] {
+		key, value, found := strings.Cut(strings.TrimSpace(param), "=")
+		if !found || strings.ToLower(strings.TrimSpace(key)) != "q" {
+			continue
+		}
+		q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return mediaRange, 0
+		}
+		quality = q
+	}
+	return mediaRange, quality
+}
+
+// matchMediaRange() reports whether the media range covers the media type and
+// how specific the match is (0 for */*, 1 for type/*, 2 for an exact match)
+func matchMediaRange(mediaRange, mediaType string) (int, bool) {
+	switch {
+	case mediaRange == "*/*":
+		return 0, true
+	case mediaRange == mediaType:
+		return 2, true
+	case strings.HasSuffix(mediaRange, "/*"):
+		prefix := strings.TrimSuffix(mediaRange, "*")
+		return 1, strings.HasPrefix(mediaType, prefix)
+	}
+	return 0, false
+}
+
+// wantsPretty() decides whether the response should be indented. Responses
+// are compact in production unless the client asks for ?pretty=true
+func (app *application) wantsPretty(r *http.Request) bool {
+	if value := r.URL.Query().Get("pretty"); value != "" {
+		pretty, err := strconv.ParseBool(value)
+		if err == nil {
+			return pretty
+		}
+	}
+	return app.config.env != "prd"
+}
+
+// encodeResponse() converts the envelope into the body for the given format
+func encodeResponse(format responseFormat, data envelope, pretty bool) ([]byte, error) {
+	switch format {
+	case formatXML:
+		return encodeXML(data, pretty)
+	default:
+		if pretty {
+			return json.MarshalIndent(data, "", "\t")
+		}
+		return json.Marshal(data)
+	}
+}
+
+// encodeXML() renders the envelope as XML. The data is first passed through
+// encoding/json so that the XML document uses the same field names and
+// omitempty rules as the JSON representation
+func encodeXML(data envelope, pretty bool) ([]byte, error) {
+	js, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+	var tree interface{}
+	if err := dec.Decode(&tree); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	if pretty {
+		enc.Indent("", "\t")
+	}
+	if err := writeXMLElement(enc, "response", tree); err != nil {
+		return nil, err
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeXMLElement() writes a decoded JSON value as an XML element.
+// Objects become child elements, arrays become repeated <item> elements
+// and null values produce an empty element
+func writeXMLElement(enc *xml.Encoder, name string, value interface{}) error {
+	start := xmlStartElement(name)
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if err := writeXMLElement(enc, key, v[key]); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if err := writeXMLElement(enc, "item", item); err != nil {
+				return err
+			}
+		}
+	case nil:
+	default:
+		if err := enc.EncodeToken(xml.CharData(fmt.Sprint(v))); err != nil {
+			return err
+		}
+	}
+
+	return enc.EncodeToken(start.End())
+}
+
+// xmlStartElement() names an element after a key. Keys come from data too,
+// such as facet values or field paths like include[0], so a key that
+// is not a valid XML name is written as <entry key="...">
+func xmlStartElement(key string) xml.StartElement {
+	if validXMLName(key) {
+		return xml.StartElement{Name: xml.Name{Local: key}}
+	}
+	return xml.StartElement{
+		Name: xml.Name{Local: "entry"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: key}},
+	}
+}
+
+// validXMLName() reports whether name can be used as an element name. Colons
+// are left out as they would declare a namespace prefix, and names starting
+// with "xml" are reserved
+func validXMLName(name string) bool {
+	if name == "" || strings.HasPrefix(strings.ToLower(name), "xml") {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_' || unicode.IsLetter(r):
+		case i > 0 && (r == '-' || r == '.' || unicode.IsDigit(r)):
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,120 @@
+// Filename: cmd/api/render_test.go
+
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestEncodeXMLIsWellFormed(t *testing.T) {
+	data := envelope{
+		"facets": map[string]int{"Belize City": 3, "2nd": 1, "xmlish": 2, "ok_name": 4},
+		"errors": []fieldError{{Field: "include[0]", Code: "one_of", Params: map[string]interface{}{"a<b": "x&y"}}},
+	}
+	body, err := encodeXML(data, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dec := xml.NewDecoder(strings.NewReader(string(body)))
+	for {
+		_, err := dec.Token()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			t.Fatalf("invalid XML %s: %v", body, err)
+		}
+	}
+	for _, want := range []string{
+		`<entry key="Belize City">3</entry>`,
+		`<entry key="2nd">1</entry>`,
+		`<entry key="xmlish">2</entry>`,
+		`<ok_name>4</ok_name>`,
+		`<field>include[0]</field>`,
+		`<entry key="a&lt;b">x&amp;y</entry>`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("XML %s does not contain %s", body, want)
+		}
+	}
+}
+
+func TestValidXMLName(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"school", true},
+		{"postal_code", true},
+		{"_private", true},
+		{"contacts.0.phone", true},
+		{"año", true},
+		{"", false},
+		{"2nd", false},
+		{"-x", false},
+		{"Belize City", false},
+		{"include[0]", false},
+		{"a:b", false},
+		{"XMLData", false},
+		{"a<b", false},
+	}
+	for _, tt := range tests {
+		if got := validXMLName(tt.name); got != tt.want {
+			t.Errorf("validXMLName(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		accept string
+		format responseFormat
+		ok     bool
+	}{
+		{"", formatJSON, true},
+		{"*/*", formatJSON, true},
+		{"application/json", formatJSON, true},
+		{"application/xml", formatXML, true},
+		{"text/xml", formatXML, true},
+		{"Application/XML", formatXML, true},
+		{"application/geo+json", formatJSON, true},
+		{"application/*", formatJSON, true},
+		{"text/*", formatXML, true},
+		// the highest q value wins
+		{"application/json;q=0.5, application/xml;q=0.9", formatXML, true},
+		{"application/xml;q=0.4, application/json", formatJSON, true},
+		{"*/*;q=0.1, application/xml", formatXML, true},
+		{"text/html, application/xml;q=0.9, */*;q=0.8", formatXML, true},
+		{"application/xml ; q=0.7 , application/json ; q=0.3", formatXML, true},
+		// on equal q values the more specific range wins, then the first listed
+		{"*/*, application/xml", formatXML, true},
+		{"application/*, text/xml", formatXML, true},
+		{"application/xml, application/json", formatXML, true},
+		{"application/json, application/xml", formatJSON, true},
+		// q=0 and unreadable q values exclude a range
+		{"application/xml;q=0, application/json", formatJSON, true},
+		{"application/xml;q=0", formatJSON, false},
+		// a wildcard does not bring back a media type refused with q=0
+		{"application/json;q=0, */*", formatXML, true},
+		{"*/*, application/json;q=0", formatXML, true},
+		{"application/xml;q=0, text/xml;q=0, application/*", formatJSON, true},
+		{"application/json;q=0, application/*", formatXML, true},
+		{"application/json;q=0, application/xml;q=0, */*", formatJSON, false},
+		{"*/*;q=0, application/json", formatJSON, true},
+		{"application/xml;q=high", formatJSON, false},
+		{"text/html", formatJSON, false},
+		{"image/*", formatJSON, false},
+		{"text/calendar", formatJSON, false},
+	}
+
+	for _, tt := range tests {
+		format, ok := negotiateFormat(tt.accept)
+		if format != tt.format || ok != tt.ok {
+			t.Errorf("negotiateFormat(%q) = %q, %v, want %q, %v", tt.accept, format, ok, tt.format, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+// Filename: cmd/api/reviews.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"unicode/utf8"
+
+	"appletree.miguelavila.net/internal/data"
+	"appletree.miguelavila.net/internal/validator"
+)
+
+// readReviewFilters() reads the page and sort of a review listing
+func (app *application) readReviewFilters(qs url.Values, defaultSort string, v *validator.Validator) data.Filters {
+	var filters data.Filters
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	filters.Sort = app.readString(qs, "sort", defaultSort)
+	filters.SortList = []string{"id", "rating", "update_at", "-id", "-rating", "-update_at"}
+	data.ValidateFilters(v, filters)
+	return filters
+}
+
+// canModerate() reports whether the user may see the moderation details of
+// a review, that is its author or a moderator
+func canModerate(user *data.User, review *data.Review) bool {
+	return !user.IsAnonymous() && (user.ID == review.UserID || user.Moderator)
+}
+
+// listSchoolReviewsHandler for GET /v1/schools/:id/reviews endpoint
+// lists the approved reviews of a school, newest first
+func (app *application) listSchoolReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	v := validator.New()
+	filters := app.readReviewFilters(r.URL.Query(), "-id", v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	reviews, metadata, err := app.models.Reviews.GetAll(data.ReviewFilter{SchoolID: school.ID, Status: "approved"}, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	for _, review := range reviews {
+		review.School = nil
+		review.Redact()
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"reviews": reviews, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createReviewHandler for POST /v1/schools/:id/reviews endpoint
+// the review waits for a moderator before it is public
+func (app *application) createReviewHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Rating int    `json:"rating"`
+		Body   string `json:"body"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badResquestReponse(w, r, err)
+		return
+	}
+
+	review := &data.Review{
+		SchoolID: school.ID,
+		UserID:   user.ID,
+		Author:   user.Name,
+		Rating:   input.Rating,
+		Body:     input.Body,
+	}
+
+	v := validator.New()
+	if data.ValidateReview(v, review); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+	// flagged reviews are queued like any other, the terms help the moderators
+	review.FlaggedTerms = app.profanity.Check(review.Body)
+
+	err = app.models.Reviews.Insert(review)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateRecord):
+			v.AddFailure("school_id", validator.CodeUnique, nil, "has already been reviewed by this user")
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/schools/%d/reviews/%d", school.ID, review.ID))
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"review": review}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// reviewFromPath() loads the review named by :review_id of the school. Reviews
+// that are not approved only exist for their author and the moderators
+func (app *application) reviewFromPath(w http.ResponseWriter, r *http.Request, school *data.School) (*data.Review, bool) {
+	id, err := app.readNamedIDParam(r, "review_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	review, err := app.models.Reviews.Get(school.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	if review.Status != "approved" && !canModerate(app.contextGetUser(r), review) {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	return review, true
+}
+
+// showReviewHandler for GET /v1/schools/:id/reviews/:review_id endpoint
+func (app *application) showReviewHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+	review, ok := app.reviewFromPath(w, r, school)
+	if !ok {
+		return
+	}
+	if !canModerate(app.contextGetUser(r), review) {
+		review.Redact()
+	}
+
+	err := app.writeResponse(w, r, http.StatusOK, envelope{"review": review}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateReviewHandler for PATCH /v1/schools/:id/reviews/:review_id endpoint
+// only the author may change a review, which sends it back to the queue
+func (app *application) updateReviewHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+	review, ok := app.reviewFromPath(w, r, school)
+	if !ok {
+		return
+	}
+	if review.UserID != app.contextGetUser(r).ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	// pointers tell us which fields the client wants to change
+	var input struct {
+		Rating *int    `json:"rating"`
+		Body   *string `json:"body"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badResquestReponse(w, r, err)
+		return
+	}
+
+	if input.Rating != nil {
+		review.Rating = *input.Rating
+	}
+	if input.Body != nil {
+		review.Body = *input.Body
+	}
+
+	v := validator.New()
+	if data.ValidateReview(v, review); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+	review.FlaggedTerms = app.profanity.Check(review.Body)
+
+	err = app.models.Reviews.Update(review)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"review": review}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteReviewHandler for DELETE /v1/schools/:id/reviews/:review_id endpoint
+// a review is removed by its author or a moderator
+func (app *application) deleteReviewHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+	review, ok := app.reviewFromPath(w, r, school)
+	if !ok {
+		return
+	}
+	if !canModerate(app.contextGetUser(r), review) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	err := app.models.Reviews.Delete(school.ID, review.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "review successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// moderateReviewHandler for PUT /v1/schools/:id/reviews/:review_id/moderation endpoint
+// approves or rejects a review, only approved reviews count towards the rating
+func (app *application) moderateReviewHandler(w http.ResponseWriter, r *http.Request) {
+	school, ok := app.schoolFromPath(w, r)
+	if !ok {
+		return
+	}
+	review, ok := app.reviewFromPath(w, r, school)
+	if !ok {
+		return
+	}
+	// a moderator may not moderate their own review
+	if review.UserID == app.contextGetUser(r).ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Status string `json:"status"`
+		Note   string `json:"note"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badResquestReponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.CheckCode(validator.In(input.Status, data.ReviewStatuses...), "status", validator.CodeOneOf, validator.Params{"values": data.ReviewStatuses}, "must be pending, approved or rejected")
+	v.CheckCode(utf8.RuneCountInString(input.Note) <= 1000, "note", validator.CodeMaxLength, validator.Params{"max": 1000}, "must not be more than 1000 characters")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+	review.Status = input.Status
+	review.ModerationNote = input.Note
+
+	err = app.models.Reviews.Moderate(review, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"review": review}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listReviewQueueHandler for GET /v1/reviews endpoint
+// the moderation queue, pending reviews oldest first unless ?status= says otherwise
+func (app *application) listReviewQueueHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	var filter data.ReviewFilter
+	filter.Status = app.readString(qs, "status", "pending")
+	v.CheckCode(validator.In(filter.Status, data.ReviewStatuses...), "status", validator.CodeOneOf, validator.Params{"values": data.ReviewStatuses}, "must be pending, approved or rejected")
+	filter.SchoolID = int64(app.readInt(qs, "school_id", 0, v))
+	filters := app.readReviewFilters(qs, "id", v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	reviews, metadata, err := app.models.Reviews.GetAll(filter, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"reviews": reviews, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listCurrentUserReviewsHandler for GET /v1/users/me/reviews endpoint
+// the reviews of the user in every state
+func (app *application) listCurrentUserReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	filters := app.readReviewFilters(r.URL.Query(), "-id", v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	reviews, metadata, err := app.models.Reviews.GetAll(data.ReviewFilter{UserID: app.contextGetUser(r).ID}, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"reviews": reviews, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
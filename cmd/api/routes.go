@@ -8,17 +8,129 @@ import (
 	"github.com/julienschmidt/httprouter"
 )
 
-func (app *application) routes() *httprouter.Router {
+// staticOr() serves the handler registered for the value of the :id segment and
+// falls back to next. httprouter does not allow static routes such as
+// /v1/schools/nearby next to /v1/schools/:id for the same method
+func (app *application) staticOr(next http.HandlerFunc, static map[string]http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+		if handler, ok := static[params.ByName("id")]; ok {
+			handler(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (app *application) routes() http.Handler {
 	// Create new http router instance
 	router := httprouter.New()
 	router.NotFound = http.HandlerFunc(app.notFoundResponse)
 	router.MethodNotAllowed = http.HandlerFunc(app.MethodNotAllowedReponse)
+	// acceptAny holds the routes serving files, they are exempt from the
+	// Accept check of negotiateContent()
+	acceptAny := httprouter.New()
+	file := func(path string, handler http.HandlerFunc) {
+		router.HandlerFunc(http.MethodGet, path, handler)
+		acceptAny.HandlerFunc(http.MethodGet, path, handler)
+	}
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
 	router.HandlerFunc(http.MethodGet, "/v1/schools", app.listSchoolsHandler)
 	router.HandlerFunc(http.MethodPost, "/v1/schools", app.createSchoolHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/schools/:id", app.showSchoolHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/schools.geojson", app.schoolsGeoJSONHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/schools/:id", app.staticOr(app.showSchoolHandler, map[string]http.HandlerFunc{
+		"nearby":  app.nearbySchoolsHandler,
+		"suggest": app.suggestSchoolsHandler,
+		"stats":   app.schoolStatsHandler,
+	}))
+	router.HandlerFunc(http.MethodGet, "/v1/schools/:id/duplicates", app.schoolDuplicatesHandler)
+	// POST /v1/schools/merge shares its segment with the nested /v1/schools/:id/... routes
+	router.HandlerFunc(http.MethodPost, "/v1/schools/:id", app.staticOr(app.MethodNotAllowedReponse, map[string]http.HandlerFunc{
+		"merge": app.mergeSchoolsHandler,
+	}))
+
+	router.HandlerFunc(http.MethodGet, "/v1/schools/:id/contacts", app.listContactsHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/schools/:id/contacts", app.createContactHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/schools/:id/contacts/:contact_id", app.showContactHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/schools/:id/contacts/:contact_id", app.updateContactHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/schools/:id/contacts/:contact_id", app.deleteContactHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/programs", app.listProgramsHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/schools/:id/programs", app.listSchoolProgramsHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/schools/:id/programs", app.createProgramHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/schools/:id/programs/:program_id", app.showProgramHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/schools/:id/programs/:program_id", app.updateProgramHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/schools/:id/programs/:program_id", app.deleteProgramHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/enrollments/summary", app.enrollmentSummaryHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/schools/:id/enrollments", app.listEnrollmentsHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/schools/:id/enrollments/:year", app.upsertEnrollmentHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/schools/:id/enrollments/:year", app.deleteEnrollmentHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/schools/:id/images", app.listImagesHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/schools/:id/images", app.uploadImageHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/schools/:id/images/:image_id", app.showImageHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/schools/:id/images/:image_id", app.deleteImageHandler)
+	file("/v1/files/*key", app.serveFileHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/schools/:id/documents", app.listDocumentsHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/schools/:id/documents", app.uploadDocumentHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/schools/:id/documents/:document_id", app.showDocumentHandler)
+	file("/v1/schools/:id/documents/:document_id/download", app.downloadDocumentHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/schools/:id/documents/:document_id", app.updateDocumentHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/schools/:id/documents/:document_id", app.deleteDocumentHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/schools/:id/licenses", app.listLicensesHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/schools/:id/licenses", app.createLicenseHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/schools/:id/licenses/:license_id", app.showLicenseHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/schools/:id/licenses/:license_id", app.updateLicenseHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/schools/:id/licenses/:license_id", app.deleteLicenseHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/schools/:id/hours", app.showHoursHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/schools/:id/hours", app.updateHoursHandler)
+	file("/v1/calendar.ics", app.calendarFeedHandler)
+	file("/v1/schools/:id/calendar.ics", app.schoolCalendarFeedHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/schools/:id/calendar", app.listEventsHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/schools/:id/calendar", app.createEventHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/schools/:id/calendar/:event_id", app.showEventHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/schools/:id/calendar/:event_id", app.updateEventHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/schools/:id/calendar/:event_id", app.deleteEventHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/reviews", app.requireModerator(app.listReviewQueueHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/schools/:id/reviews", app.listSchoolReviewsHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/schools/:id/reviews", app.requireUser(app.createReviewHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/schools/:id/reviews/:review_id", app.showReviewHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/schools/:id/reviews/:review_id", app.requireUser(app.updateReviewHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/schools/:id/reviews/:review_id", app.requireUser(app.deleteReviewHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/schools/:id/reviews/:review_id/moderation", app.requireModerator(app.moderateReviewHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/users/me", app.requireUser(app.showCurrentUserHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/reviews", app.requireUser(app.listCurrentUserReviewsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/favorites", app.requireUser(app.listFavoritesHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/favorites/:school_id", app.requireUser(app.addFavoriteHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/favorites/:school_id", app.requireUser(app.removeFavoriteHandler))
+
 	router.HandlerFunc(http.MethodPatch, "/v1/schools/:id", app.updateSchoolHandler)
 	router.HandlerFunc(http.MethodDelete, "/v1/schools/:id", app.deleteSchoolHandler)
 
-	return router
+	router.HandlerFunc(http.MethodGet, "/v1/levels", app.listTermsHandler(app.models.Levels, "levels"))
+	router.HandlerFunc(http.MethodPost, "/v1/levels", app.createTermHandler(app.models.Levels, "levels", "level"))
+	router.HandlerFunc(http.MethodGet, "/v1/levels/:id", app.showTermHandler(app.models.Levels, "level"))
+	router.HandlerFunc(http.MethodPatch, "/v1/levels/:id", app.updateTermHandler(app.models.Levels, "level"))
+	router.HandlerFunc(http.MethodDelete, "/v1/levels/:id", app.deleteTermHandler(app.models.Levels, "level"))
+
+	router.HandlerFunc(http.MethodGet, "/v1/modes", app.listTermsHandler(app.models.Modes, "modes"))
+	router.HandlerFunc(http.MethodPost, "/v1/modes", app.createTermHandler(app.models.Modes, "modes", "mode"))
+	router.HandlerFunc(http.MethodGet, "/v1/modes/:id", app.showTermHandler(app.models.Modes, "mode"))
+	router.HandlerFunc(http.MethodPatch, "/v1/modes/:id", app.updateTermHandler(app.models.Modes, "mode"))
+	router.HandlerFunc(http.MethodDelete, "/v1/modes/:id", app.deleteTermHandler(app.models.Modes, "mode"))
+
+	router.HandlerFunc(http.MethodGet, "/v1/districts", app.listTermsHandler(app.models.Districts, "districts"))
+	router.HandlerFunc(http.MethodPost, "/v1/districts", app.createTermHandler(app.models.Districts, "districts", "district"))
+	router.HandlerFunc(http.MethodGet, "/v1/districts/:id", app.showTermHandler(app.models.Districts, "district"))
+	router.HandlerFunc(http.MethodPatch, "/v1/districts/:id", app.updateTermHandler(app.models.Districts, "district"))
+	router.HandlerFunc(http.MethodDelete, "/v1/districts/:id", app.deleteTermHandler(app.models.Districts, "district"))
+	router.HandlerFunc(http.MethodGet, "/v1/districts/:id/schools", app.districtSchoolsHandler)
+
+	return app.negotiateLanguage(app.negotiateContent(app.authenticate(router), acceptAny))
 }
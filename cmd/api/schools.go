@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"unicode/utf8"
 
 	"appletree.miguelavila.net/internal/data"
 	"appletree.miguelavila.net/internal/validator"
@@ -16,14 +17,21 @@ import (
 func (app *application) createSchoolHandler(w http.ResponseWriter, r *http.Request) {
 	// Target decode destination
 	var input struct {
-		Name    string   `json:"name"`
-		Level   string   `json:"level"`
-		Contact string   `json:"contact"`
-		Phone   string   `json:"phone"`
-		Email   string   `json:"email"`
-		Website string   `json:"website"`
-		Address string   `json:"address"`
-		Mode    []string `json:"mode"`
+		Name       string   `json:"name"`
+		Level      string   `json:"level"`
+		Contact    string   `json:"contact"`
+		Phone      string   `json:"phone"`
+		Email      string   `json:"email"`
+		Website    string   `json:"website"`
+		Address    string   `json:"address"`
+		Street     string   `json:"street"`
+		Town       string   `json:"town"`
+		District   string   `json:"district"`
+		PostalCode string   `json:"postal_code"`
+		Country    string   `json:"country"`
+		Mode       []string `json:"mode"`
+		Latitude   *float64 `json:"latitude"`
+		Longitude  *float64 `json:"longitude"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -34,37 +42,80 @@ func (app *application) createSchoolHandler(w http.ResponseWriter, r *http.Reque
 	}
 	// Copy the values from the input struct to a new School struct
 	school := &data.School{
-		Name:    input.Name,
-		Level:   input.Level,
-		Contact: input.Contact,
-		Phone:   input.Phone,
-		Email:   input.Email,
-		Website: input.Website,
-		Address: input.Address,
-		Mode:    input.Mode,
+		Name:       input.Name,
+		Level:      input.Level,
+		Contact:    input.Contact,
+		Phone:      input.Phone,
+		Email:      input.Email,
+		Website:    input.Website,
+		Address:    input.Address,
+		Street:     input.Street,
+		Town:       input.Town,
+		District:   input.District,
+		PostalCode: input.PostalCode,
+		Country:    input.Country,
+		Mode:       input.Mode,
+		Latitude:   input.Latitude,
+		Longitude:  input.Longitude,
 	}
 
+	// load the levels, modes and districts used to normalize the input
+	vocab, err := app.vocabularies()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// fill in the district and coordinates the client did not give from the address
+	data.GeocodeSchool(app.gazetteer, vocab.Districts, school, false)
+
 	// Initialize a new instance of validator
 	v := validator.New()
 
 	// Check the errors maps if there were any errors validation
-	if data.ValidateSchool(v, school); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+	if data.ValidateSchool(v, school, vocab); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
+	// with ?check=true make sure the website actually answers
+	if app.checkWebsite(r, v, school.Website); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	// refuse likely duplicates unless the client insists with ?force=true
+	if !app.readBool(r.URL.Query(), "force", false, v) {
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v)
+			return
+		}
+		duplicates, err := app.models.Schools.FindDuplicates(school, data.DuplicateBlockScore)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if len(duplicates) > 0 {
+			app.possibleDuplicateResponse(w, r, duplicates)
+			return
+		}
+	}
+
 	// create a school
 	err = app.models.Schools.Insert(school)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	// names changed, cached suggestions may be stale
+	app.suggestions.Purge()
+
 	// create a Location header for the newly created resource/school
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/schools/%d", school.ID))
 	// write the json response with 201 - created status code with the body
 	// being the school data and the headers being the headers map
-	err = app.writeJSON(w, http.StatusCreated, envelope{"school": school}, headers)
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"school": school}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -81,20 +132,42 @@ func (app *application) showSchoolHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// ?include=programs embeds related records
+	v := validator.New()
+	includes := app.readIncludes(r.URL.Query(), v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
 	// Fetch the specific school
 	school, err := app.models.Schools.Get(id)
 
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
+			app.mergedSchoolRedirect(w, r, id)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
+	err = app.loadIncludes(includes, school)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// authenticated users learn whether they starred the school
+	if user := app.contextGetUser(r); !user.IsAnonymous() {
+		favorite, err := app.models.Favorites.Exists(user.ID, school.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		school.IsFavorite = &favorite
+	}
 	// write the data return by the Get method
-	err = app.writeJSON(w, http.StatusOK, envelope{"school": school}, nil)
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"school": school}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -126,14 +199,21 @@ func (app *application) updateSchoolHandler(w http.ResponseWriter, r *http.Reque
 	// Update input struct to use pointers because pointers have a default value of nil
 	// if field remains nil then we know that the client is not interested in updating the field
 	var input struct {
-		Name    *string  `json:"name"`
-		Level   *string  `json:"level"`
-		Contact *string  `json:"contact"`
-		Phone   *string  `json:"phone"`
-		Email   *string  `json:"email"`
-		Website *string  `json:"website"`
-		Address *string  `json:"address"`
-		Mode    []string `json:"mode"`
+		Name       *string  `json:"name"`
+		Level      *string  `json:"level"`
+		Contact    *string  `json:"contact"`
+		Phone      *string  `json:"phone"`
+		Email      *string  `json:"email"`
+		Website    *string  `json:"website"`
+		Address    *string  `json:"address"`
+		Street     *string  `json:"street"`
+		Town       *string  `json:"town"`
+		District   *string  `json:"district"`
+		PostalCode *string  `json:"postal_code"`
+		Country    *string  `json:"country"`
+		Mode       []string `json:"mode"`
+		Latitude   *float64 `json:"latitude"`
+		Longitude  *float64 `json:"longitude"`
 	}
 	// Decode the data from the client
 	err = app.readJSON(w, r, &input)
@@ -168,21 +248,86 @@ func (app *application) updateSchoolHandler(w http.ResponseWriter, r *http.Reque
 		school.Website = *input.Website
 	}
 
+	// a legacy address replaces the components with a single street line
 	if input.Address != nil {
 		school.Address = *input.Address
+		school.Street = *input.Address
+		school.Town = ""
+		school.PostalCode = ""
+	}
+
+	if input.Street != nil {
+		school.Street = *input.Street
+	}
+
+	if input.Town != nil {
+		school.Town = *input.Town
+	}
+
+	if input.District != nil {
+		school.District = *input.District
+	}
+
+	if input.PostalCode != nil {
+		school.PostalCode = *input.PostalCode
+	}
+
+	if input.Country != nil {
+		school.Country = *input.Country
 	}
 
 	if input.Mode != nil {
 		school.Mode = input.Mode
 	}
 
+	if input.Latitude != nil {
+		school.Latitude = input.Latitude
+	}
+
+	if input.Longitude != nil {
+		school.Longitude = input.Longitude
+	}
+
 	// validate the data provided by the client, if the validation fails,
 	// then we send a 422 - Unprocessable responses to the client
 	// Initialize a new validation error instance
+	vocab, err := app.vocabularies()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// a new address moves the school unless the client also sent its location
+	if input.Address != nil || input.Street != nil || input.Town != nil {
+		data.GeocodeSchool(app.gazetteer, vocab.Districts, school, input.Latitude == nil && input.Longitude == nil && input.District == nil)
+	}
+
 	v := validator.New()
 
-	if data.ValidateSchool(v, school); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+	if data.ValidateSchool(v, school, vocab); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	// a mode cannot be dropped while programs are still offered in it
+	if input.Mode != nil {
+		inUse, err := app.models.Programs.ModesInUse(school.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		for _, mode := range inUse {
+			v.CheckCode(validator.In(mode, school.Mode...), "mode", validator.CodeInUse, validator.Params{"value": mode}, fmt.Sprintf("must include %q, programs are offered in it", mode))
+		}
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v)
+			return
+		}
+	}
+
+	// with ?check=true make sure the website actually answers
+	if app.checkWebsite(r, v, school.Website); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
@@ -198,8 +343,17 @@ func (app *application) updateSchoolHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	// names changed, cached suggestions may be stale
+	app.suggestions.Purge()
+	// embed the logo
+	err = app.loadIncludes(nil, school)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	// write the json response by Update
-	err = app.writeJSON(w, http.StatusCreated, envelope{"school": school}, nil)
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"school": school}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -218,6 +372,18 @@ func (app *application) deleteSchoolHandler(w http.ResponseWriter, r *http.Reque
 	}
 	// delete the school from the database. send a 404 notFoundResponse status code to the client if there is no matching record
 
+	// the stored files of the images and documents outlive their rows, look them up first
+	images, err := app.models.Images.GetAllForSchools([]int64{id})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	documents, err := app.models.Documents.GetAllForSchool(id, "")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	// fetch the original record from database
 	err = app.models.Schools.Delete(id)
 	if err != nil {
@@ -229,9 +395,14 @@ func (app *application) deleteSchoolHandler(w http.ResponseWriter, r *http.Reque
 		}
 		return
 	}
+	app.deleteImageBlobs(images[id]...)
+	app.deleteDocumentBlobs(documents...)
+
+	// names changed, cached suggestions may be stale
+	app.suggestions.Purge()
 
 	//  return 200 status ok the client with a successful message
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "school successfully deleted"}, nil)
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "school successfully deleted"}, nil)
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -240,45 +411,113 @@ func (app *application) deleteSchoolHandler(w http.ResponseWriter, r *http.Reque
 
 }
 
+// checkWebsite() probes the website when the client asked for ?check=true
+// and records a validation error if it cannot be reached
+func (app *application) checkWebsite(r *http.Request, v *validator.Validator, website string) {
+	if !app.readBool(r.URL.Query(), "check", false, v) || app.websites == nil {
+		return
+	}
+	err := app.websites.Reachable(r.Context(), website)
+	if err != nil {
+		app.logger.Printf("website check for %s failed: %v", website, err)
+		v.AddFailure("website", validator.CodeUnreachable, nil, "must be reachable")
+	}
+}
+
 // listSchoolsHandler() allows the client to see a listing of schools
 // based on a set of criteria
 func (app *application) listSchoolsHandler(w http.ResponseWriter, r *http.Request) {
-	// create an input struct to hold our query parameters
-	var input struct {
-		Name  string
-		Level string
-		Mode  []string
-		data.Filters
-	}
 	// initialize a validator
 	v := validator.New()
-	// get the URL values in a map
-	qs := r.URL.Query()
-	// use the helper method to extract the values
-	input.Name = app.readString(qs, "name", "")
-	input.Level = app.readString(qs, "level", "")
-	input.Mode = app.readCSV(qs, "mode", []string{})
-	// get the page information
-	input.Filters.Page = app.readInt(qs, "page", 1, v)
-	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
-	// get the sort information
-	input.Filters.Sort = app.readString(qs, "sort", "id")
-	// specific the allowed sort types
-	input.Filters.SortList = []string{"id", "name", "level", "-id", "-name", "-level"}
-
+	// the level, mode and district filters accept codes or aliases
+	vocab, err := app.vocabularies()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	filter, filters := app.readSchoolFilter(r, v, vocab)
+	// ?facets=level,mode counts the schools per value next to the listing
+	facets := app.readCSV(r.URL.Query(), "facets", []string{})
+	for i, facet := range facets {
+		v.CheckCode(validator.In(facet, data.FacetNames...), validator.Index("facets", i), validator.CodeOneOf, validator.Params{"values": data.FacetNames}, "must be a known facet")
+	}
+	v.CheckCode(validator.Unique(facets), "facets", validator.CodeUnique, nil, "must not contain duplicates")
+	includes := app.readIncludes(r.URL.Query(), v)
 	// check for validation errors
-	if data.ValidateFilters(v, input.Filters); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
 	}
 	// Get a listing of all schools
-	schools, metadata, err := app.models.Schools.GetAll(input.Name, input.Level, input.Mode, input.Filters)
+	schools, metadata, err := app.models.Schools.GetAll(filter, filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
-	err = app.writeJSON(w, http.StatusOK, envelope{"schools": schools, "metadata": metadata}, nil)
+	err = app.loadIncludes(includes, schools...)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	response := envelope{"schools": schools, "metadata": metadata}
+	if len(facets) > 0 {
+		counts, err := app.models.Schools.Facets(filter, facets)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		response["facets"] = counts
+	}
+	err = app.writeResponse(w, r, http.StatusOK, response, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// readSchoolFilter() reads the criteria and paging of a school listing from the
+// query string, codes and aliases are resolved against the vocabularies
+func (app *application) readSchoolFilter(r *http.Request, v *validator.Validator, vocab data.Vocabularies) (data.SchoolFilter, data.Filters) {
+	var filter data.SchoolFilter
+	var filters data.Filters
+	// get the URL values in a map
+	qs := r.URL.Query()
+	// use the helper method to extract the values
+	filter.Name = app.readString(qs, "name", "")
+	filter.Level = app.readString(qs, "level", "")
+	filter.Phone = app.readString(qs, "phone", "")
+	if _, err := data.PhoneSearchPattern(filter.Phone); err != nil {
+		v.AddFailure("phone", validator.CodePattern, validator.Params{"format": "phone"}, "must be a valid phone number")
+	}
+	filter.Mode = app.readCSV(qs, "mode", []string{})
+	filter.District = app.readString(qs, "district", "")
+	filter.Query = app.readString(qs, "q", "")
+	v.CheckCode(utf8.RuneCountInString(filter.Query) <= 200, "q", validator.CodeMaxLength, validator.Params{"max": 200}, "must not be more than 200 characters")
+	filter.LicenseStatus = app.readString(qs, "license_status", "")
+	filter.ExpiringDays = app.config.licenses.expiringDays
+	filter.ViewerID = app.contextGetUser(r).ID
+	if filter.LicenseStatus != "" {
+		v.CheckCode(validator.In(filter.LicenseStatus, data.LicenseStates...), "license_status", validator.CodeOneOf, validator.Params{"values": data.LicenseStates}, "must be valid, expiring or expired")
+	}
+	// get the page information
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	// get the sort information
+	filters.Sort = app.readString(qs, "sort", "id")
+	// specific the allowed sort types
+	filters.SortList = []string{"id", "name", "level", "district", "relevance", "rating_avg", "rating_count", "-id", "-name", "-level", "-district", "-rating_avg", "-rating_count"}
+	data.ValidateFilters(v, filters)
+
+	if code, ok := vocab.Levels.Resolve(filter.Level); ok {
+		filter.Level = code
+	}
+	for i, mode := range filter.Mode {
+		if code, ok := vocab.Modes.Resolve(mode); ok {
+			filter.Mode[i] = code
+		}
+	}
+	if code, ok := vocab.Districts.Resolve(filter.District); ok {
+		filter.District = code
+	}
+	return filter, filters
 }
@@ -0,0 +1,44 @@
+// Filename: cmd/api/stats.go
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"appletree.miguelavila.net/internal/validator"
+)
+
+// schoolStatsHandler for GET /v1/schools/stats endpoint
+// aggregates the schools matching the same filters as GET /v1/schools
+func (app *application) schoolStatsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	vocab, err := app.vocabularies()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	filter, _ := app.readSchoolFilter(r, v, vocab)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	// reports ask the same questions many times, recent answers are reused
+	key := fmt.Sprintf("%s|%s|%s|%s|%s|%s|%s", filter.Name, filter.Level, filter.Phone, strings.Join(filter.Mode, ","), filter.District, filter.Query, filter.LicenseStatus)
+	stats, ok := app.stats.Get(key)
+	if !ok {
+		stats, err = app.models.Schools.Stats(filter)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.stats.Add(key, stats)
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"stats": stats}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,48 @@
+// Filename: cmd/api/suggest.go
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"unicode/utf8"
+
+	"appletree.miguelavila.net/internal/data"
+	"appletree.miguelavila.net/internal/validator"
+)
+
+// suggestSchoolsHandler for GET /v1/schools/suggest endpoint
+// returns a few schools for the search box as the user types
+func (app *application) suggestSchoolsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	q := data.NormalizeSuggestQuery(app.readString(qs, "q", ""))
+	limit := app.readInt(qs, "limit", 10, v)
+	v.CheckCode(q != "", "q", validator.CodeRequired, nil, "must be provided")
+	v.CheckCode(utf8.RuneCountInString(q) <= 100, "q", validator.CodeMaxLength, validator.Params{"max": 100}, "must not be more than 100 characters")
+	v.CheckCode(limit > 0, "limit", validator.CodeMin, validator.Params{"min": 1}, "must be greater than zero")
+	v.CheckCode(limit <= 25, "limit", validator.CodeMax, validator.Params{"max": 25}, "must be maximum of 25")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	// the same prefix is typed over and over, answer it from memory when we can
+	key := fmt.Sprintf("%d:%s", limit, q)
+	suggestions, ok := app.suggestions.Get(key)
+	if !ok {
+		var err error
+		suggestions, err = app.models.Schools.Suggest(q, limit)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.suggestions.Add(key, suggestions)
+	}
+
+	err := app.writeResponse(w, r, http.StatusOK, envelope{"suggestions": suggestions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,70 @@
+// Filename: cmd/api/users.go
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"appletree.miguelavila.net/internal/data"
+	"appletree.miguelavila.net/internal/validator"
+)
+
+// registerUserHandler for POST /v1/users endpoint
+// the token is only ever shown in this response
+func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badResquestReponse(w, r, err)
+		return
+	}
+
+	user := &data.User{
+		Name:  strings.TrimSpace(input.Name),
+		Email: strings.TrimSpace(input.Email),
+	}
+
+	v := validator.New()
+	if data.ValidateUser(v, user); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	token, err := data.GenerateToken()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.models.Users.Insert(user, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateRecord):
+			v.AddFailure("email", validator.CodeUnique, nil, "is already registered")
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", "/v1/users/me")
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"user": user, "token": token.Plaintext}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showCurrentUserHandler for GET /v1/users/me endpoint
+func (app *application) showCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.writeResponse(w, r, http.StatusOK, envelope{"user": app.contextGetUser(r)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,248 @@
+// Filename: cmd/api/vocabularies.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"appletree.miguelavila.net/internal/data"
+	"appletree.miguelavila.net/internal/validator"
+)
+
+// The levels, modes and districts endpoints share their handlers, each handler is built
+// for a vocabulary model and the resource name used in paths and envelopes
+
+// vocabularyKey is the only key of the vocabulary cache
+const vocabularyKey = "all"
+
+// vocabularies() loads the lookups used to normalize school levels, modes and
+// districts. They are cached until a term is created, changed or deleted
+func (app *application) vocabularies() (data.Vocabularies, error) {
+	if vocab, ok := app.vocab.Get(vocabularyKey); ok {
+		return vocab, nil
+	}
+
+	levels, err := app.models.Levels.Vocabulary()
+	if err != nil {
+		return data.Vocabularies{}, err
+	}
+	modes, err := app.models.Modes.Vocabulary()
+	if err != nil {
+		return data.Vocabularies{}, err
+	}
+	districts, err := app.models.Districts.Vocabulary()
+	if err != nil {
+		return data.Vocabularies{}, err
+	}
+	vocab := data.Vocabularies{Levels: levels, Modes: modes, Districts: districts}
+	app.vocab.Add(vocabularyKey, vocab)
+	return vocab, nil
+}
+
+// createTermHandler for POST /v1/levels, /v1/modes and /v1/districts endpoints
+func (app *application) createTermHandler(model data.TermModel, resource, key string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Target decode destination
+		var input struct {
+			Code    string   `json:"code"`
+			Name    string   `json:"name"`
+			Aliases []string `json:"aliases"`
+		}
+
+		err := app.readJSON(w, r, &input)
+		if err != nil {
+			app.badResquestReponse(w, r, err)
+			return
+		}
+
+		term := &data.Term{
+			Code:    input.Code,
+			Name:    input.Name,
+			Aliases: input.Aliases,
+		}
+
+		vocab, err := model.Vocabulary()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		v := validator.New()
+		if data.ValidateTerm(v, term, vocab); !v.Valid() {
+			app.failedValidationResponse(w, r, v)
+			return
+		}
+
+		err = model.Insert(term)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDuplicateRecord):
+				v.AddFailure("code", validator.CodeUnique, nil, "is already used by another term")
+				app.failedValidationResponse(w, r, v)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		app.vocab.Purge()
+
+		headers := make(http.Header)
+		headers.Set("Location", fmt.Sprintf("/v1/%s/%d", resource, term.ID))
+		err = app.writeResponse(w, r, http.StatusCreated, envelope{key: term}, headers)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+// showTermHandler for GET /v1/levels/:id, /v1/modes/:id and /v1/districts/:id endpoints
+func (app *application) showTermHandler(model data.TermModel, key string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := app.readIDParam(r)
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		term, err := model.Get(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		err = app.writeResponse(w, r, http.StatusOK, envelope{key: term}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+// updateTermHandler for PATCH /v1/levels/:id, /v1/modes/:id and /v1/districts/:id endpoints
+func (app *application) updateTermHandler(model data.TermModel, key string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := app.readIDParam(r)
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		term, err := model.Get(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		// pointers tell us which fields the client wants to change
+		var input struct {
+			Code    *string  `json:"code"`
+			Name    *string  `json:"name"`
+			Aliases []string `json:"aliases"`
+		}
+
+		err = app.readJSON(w, r, &input)
+		if err != nil {
+			app.badResquestReponse(w, r, err)
+			return
+		}
+
+		if input.Code != nil {
+			term.Code = *input.Code
+		}
+		if input.Name != nil {
+			term.Name = *input.Name
+		}
+		if input.Aliases != nil {
+			term.Aliases = input.Aliases
+		}
+
+		vocab, err := model.Vocabulary()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		v := validator.New()
+		if data.ValidateTerm(v, term, vocab); !v.Valid() {
+			app.failedValidationResponse(w, r, v)
+			return
+		}
+
+		err = model.Update(term)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				app.editConflictResponse(w, r)
+			case errors.Is(err, data.ErrDuplicateRecord):
+				v.AddFailure("code", validator.CodeUnique, nil, "is already used by another term")
+				app.failedValidationResponse(w, r, v)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		app.vocab.Purge()
+
+		err = app.writeResponse(w, r, http.StatusOK, envelope{key: term}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+// deleteTermHandler for DELETE /v1/levels/:id, /v1/modes/:id and /v1/districts/:id endpoints
+func (app *application) deleteTermHandler(model data.TermModel, key string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := app.readIDParam(r)
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		err = model.Delete(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			case errors.Is(err, data.ErrRecordInUse):
+				app.recordInUseResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		app.vocab.Purge()
+
+		err = app.writeResponse(w, r, http.StatusOK, envelope{"message": fmt.Sprintf("%s successfully deleted", key)}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+// listTermsHandler for GET /v1/levels, /v1/modes and /v1/districts endpoints
+func (app *application) listTermsHandler(model data.TermModel, resource string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		terms, err := model.GetAll()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = app.writeResponse(w, r, http.StatusOK, envelope{resource: terms}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	}
+}
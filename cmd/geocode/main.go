@@ -0,0 +1,115 @@
+//Filename: cmd/geocode/main.go
+
+// geocode backfills the coordinates and district of existing schools from
+// the offline gazetteer. Schools whose address matches no place are left alone
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"appletree.miguelavila.net/internal/data"
+	"appletree.miguelavila.net/internal/geocode"
+	_ "github.com/lib/pq"
+)
+
+// backfill config
+type config struct {
+	dsn       string
+	gazetteer string
+	batch     int
+	overwrite bool
+}
+
+func main() {
+	var cfg config
+	flag.StringVar(&cfg.dsn, "db-dsn", os.Getenv("APPLETREE_DB_DSN"), "PostgreSQL DSN")
+	flag.StringVar(&cfg.gazetteer, "gazetteer", "./geodata/gazetteer.csv", "Gazetteer CSV used to geocode addresses")
+	flag.IntVar(&cfg.batch, "batch", 100, "Schools read per batch")
+	flag.BoolVar(&cfg.overwrite, "overwrite", false, "Replace coordinates that schools already have")
+	flag.Parse()
+
+	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
+
+	if cfg.batch < 1 {
+		logger.Fatal("batch must be greater than zero")
+	}
+
+	gazetteer, err := geocode.Load(cfg.gazetteer)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	logger.Printf("gazetteer loaded with %d places", gazetteer.Len())
+
+	db, err := openDB(cfg.dsn)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer db.Close()
+
+	models := data.NewModels(db)
+
+	// the gazetteer names districts, they are stored by code
+	districts, err := models.Districts.Vocabulary()
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	var afterID int64
+	located, unmatched, conflicts := 0, 0, 0
+	for {
+		schools, err := models.Schools.GetUnlocated(afterID, cfg.batch)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		if len(schools) == 0 {
+			break
+		}
+		for _, school := range schools {
+			afterID = school.ID
+			if !data.GeocodeSchool(gazetteer, districts, school, cfg.overwrite) {
+				unmatched++
+				logger.Printf("school %d: no place matches %q", school.ID, school.Address)
+				continue
+			}
+			err := models.Schools.UpdateLocation(school)
+			if err != nil {
+				switch {
+				// the school was edited meanwhile, the API geocoded it already
+				case errors.Is(err, data.ErrEditConflict):
+					conflicts++
+					continue
+				default:
+					logger.Fatal(err)
+				}
+			}
+			located++
+		}
+		logger.Printf("processed schools up to id %d", afterID)
+	}
+
+	logger.Printf("done: %d located, %d unmatched, %d skipped after concurrent edits", located, unmatched, conflicts)
+}
+
+// openDB return a *sql.DB instance
+func openDB(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// create a context with a 5 section timeout deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
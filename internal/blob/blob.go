@@ -0,0 +1,135 @@
+// Filename : internal/blob/blob.go
+
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	ErrNotFound   = errors.New("blob: not found")
+	ErrInvalidKey = errors.New("blob: invalid key")
+)
+
+// Store keeps uploaded files by key. Keys are slash separated paths such as
+// images/3f2a/original.jpg
+type Store interface {
+	// Put() writes the blob, replacing any blob with the same key
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Open() reads a blob, ErrNotFound when there is none
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, error)
+	// Delete() removes a blob, a missing blob is not an error
+	Delete(ctx context.Context, key string) error
+	// URL() is where clients download the blob from
+	URL(key string) string
+}
+
+// Local stores blobs as files under a root directory
+type Local struct {
+	root    string
+	baseURL string
+}
+
+// NewLocal() creates the root directory when needed. Blob URLs are baseURL
+// followed by the key
+func NewLocal(root, baseURL string) (*Local, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	return &Local{root: root, baseURL: strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+// CleanKey() normalizes a key, refusing the ones that would leave the store
+func CleanKey(key string) (string, error) {
+	if key == "" || strings.Contains(key, "\\") {
+		return "", ErrInvalidKey
+	}
+	cleaned := path.Clean("/" + key)[1:]
+	if cleaned == "" || cleaned != strings.TrimPrefix(key, "/") {
+		return "", ErrInvalidKey
+	}
+	return cleaned, nil
+}
+
+// path() maps a key to its file
+func (s *Local) path(key string) (string, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+// Put() writes to a temporary file first, so a reader never sees half a blob
+func (s *Local) Put(ctx context.Context, key string, r io.Reader) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return err
+	}
+	// a no-op once the file is renamed
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// Open() opens the file of a blob
+func (s *Local) Open(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	name, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+// Delete() removes the file of a blob and the directories it leaves empty
+func (s *Local) Delete(ctx context.Context, key string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for dir := filepath.Dir(name); dir != filepath.Clean(s.root); dir = filepath.Dir(dir) {
+		// fails, and stops, at the first directory that is not empty
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// URL() joins the base url and the key
+func (s *Local) URL(key string) string {
+	return s.baseURL + "/" + key
+}
@@ -0,0 +1,173 @@
+// Filename : internal/cache/lru_test.go
+
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLRUEviction(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity int
+		adds     []string
+		gets     []string // read between the adds and the last add
+		last     string
+		present  []string
+		missing  []string
+	}{
+		{
+			name:     "oldest entry is evicted",
+			capacity: 2,
+			adds:     []string{"a", "b"},
+			last:     "c",
+			present:  []string{"b", "c"},
+			missing:  []string{"a"},
+		},
+		{
+			name:     "a read keeps an entry",
+			capacity: 2,
+			adds:     []string{"a", "b"},
+			gets:     []string{"a"},
+			last:     "c",
+			present:  []string{"a", "c"},
+			missing:  []string{"b"},
+		},
+		{
+			name:     "adding an existing key refreshes it",
+			capacity: 2,
+			adds:     []string{"a", "b", "a"},
+			last:     "c",
+			present:  []string{"a", "c"},
+			missing:  []string{"b"},
+		},
+		{
+			name:     "capacity of one",
+			capacity: 1,
+			adds:     []string{"a"},
+			last:     "b",
+			present:  []string{"b"},
+			missing:  []string{"a"},
+		},
+		{
+			name:     "zero capacity stores nothing",
+			capacity: 0,
+			adds:     []string{"a"},
+			last:     "b",
+			missing:  []string{"a", "b"},
+		},
+	}
+
+	for _, tt := range tests {
+		c := New[string, int](tt.capacity, 0)
+		for i, key := range tt.adds {
+			c.Add(key, i)
+		}
+		for _, key := range tt.gets {
+			c.Get(key)
+		}
+		c.Add(tt.last, -1)
+
+		for _, key := range tt.present {
+			if _, ok := c.Get(key); !ok {
+				t.Errorf("%s: %q should be cached", tt.name, key)
+			}
+		}
+		for _, key := range tt.missing {
+			if _, ok := c.Get(key); ok {
+				t.Errorf("%s: %q should have been evicted", tt.name, key)
+			}
+		}
+		if c.Len() != len(tt.present) {
+			t.Errorf("%s: Len() = %d, want %d", tt.name, c.Len(), len(tt.present))
+		}
+	}
+}
+
+func TestLRUValues(t *testing.T) {
+	c := New[int, string](4, 0)
+	c.Add(1, "one")
+	c.Add(1, "uno")
+	if v, ok := c.Get(1); !ok || v != "uno" {
+		t.Errorf("Get(1) = %q, %v, want %q, true", v, ok, "uno")
+	}
+	if v, ok := c.Get(2); ok || v != "" {
+		t.Errorf("Get(2) = %q, %v, want the zero value and false", v, ok)
+	}
+}
+
+func TestLRUTTL(t *testing.T) {
+	ttl := 50 * time.Millisecond
+	c := New[string, int](4, ttl)
+	c.Add("a", 1)
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("a fresh entry should be cached")
+	}
+
+	time.Sleep(ttl / 2)
+	// b is added half a ttl later so it outlives a
+	c.Add("b", 2)
+	time.Sleep(ttl/2 + 10*time.Millisecond)
+
+	if _, ok := c.Get("a"); ok {
+		t.Error("an expired entry should be missing")
+	}
+	if _, ok := c.Get("b"); !ok {
+		t.Error("an entry within its ttl should be cached")
+	}
+	if c.Len() != 1 {
+		t.Errorf("expired entries should be dropped on read, Len() = %d", c.Len())
+	}
+
+	// a ttl of zero never expires
+	forever := New[string, int](4, 0)
+	forever.Add("a", 1)
+	time.Sleep(10 * time.Millisecond)
+	if _, ok := forever.Get("a"); !ok {
+		t.Error("an entry without a ttl should not expire")
+	}
+}
+
+func TestLRUPurgeAndNil(t *testing.T) {
+	c := New[string, int](4, 0)
+	c.Add("a", 1)
+	c.Add("b", 2)
+	c.Purge()
+	if c.Len() != 0 {
+		t.Errorf("Len() after Purge() = %d, want 0", c.Len())
+	}
+	if _, ok := c.Get("a"); ok {
+		t.Error("a purged entry should be missing")
+	}
+
+	// a nil cache behaves like one that is always empty
+	var none *LRU[string, int]
+	none.Add("a", 1)
+	none.Purge()
+	if _, ok := none.Get("a"); ok || none.Len() != 0 {
+		t.Error("a nil cache should hold nothing")
+	}
+}
+
+func TestLRUConcurrentUse(t *testing.T) {
+	c := New[string, int](16, time.Minute)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				key := fmt.Sprintf("%d-%d", i, j%20)
+				c.Add(key, j)
+				c.Get(key)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if c.Len() > 16 {
+		t.Errorf("Len() = %d, the capacity is 16", c.Len())
+	}
+}
@@ -0,0 +1,400 @@
+// Filename : internal/data/calendar.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"sort"
+	"time"
+
+	"appletree.miguelavila.net/internal/validator"
+	"github.com/lib/pq"
+)
+
+// Weekdays are the days of OpeningHours, Monday first as in ISO 8601
+var Weekdays = []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"}
+
+// EventKinds are the kinds of calendar events
+var EventKinds = []string{"term_start", "term_end", "holiday", "open_day", "event"}
+
+// DateLayout is how calendar dates are written, e.g. 2024-09-02
+const DateLayout = "2006-01-02"
+
+// clockRX matches a time of day written as 07:30
+var clockRX = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]$`)
+
+func init() {
+	validator.RegisterRule("date", func(fl validator.FieldLevel) *validator.FieldError {
+		if ValidDate(fl.Value.String()) {
+			return nil
+		}
+		return validator.Failed(validator.CodePattern, validator.Params{"format": "date"}, "must be a date such as 2024-09-02")
+	})
+	validator.RegisterRule("clock", func(fl validator.FieldLevel) *validator.FieldError {
+		if validator.Matches(fl.Value.String(), clockRX) {
+			return nil
+		}
+		return validator.Failed(validator.CodePattern, validator.Params{"format": "clock"}, "must be a time of day such as 07:30")
+	})
+}
+
+// ValidDate() reports whether s is a calendar date written as 2024-09-02
+func ValidDate(s string) bool {
+	_, err := time.Parse(DateLayout, s)
+	return err == nil
+}
+
+// OpeningHours is a span of a weekday the school is open. A day may have
+// several spans, e.g. a lunch break splits it in two
+type OpeningHours struct {
+	Day    string `json:"day" validate:"required,oneof=monday tuesday wednesday thursday friday saturday sunday"`
+	Opens  string `json:"opens" validate:"required,clock"`
+	Closes string `json:"closes" validate:"required,clock"`
+}
+
+// ValidateHours() checks a week of opening hours. Spans of a day must not overlap
+func ValidateHours(v *validator.Validator, hours []OpeningHours) {
+	var input struct {
+		Hours []OpeningHours `json:"hours" validate:"max=21,dive"`
+	}
+	input.Hours = hours
+	v.Struct(&input)
+	if !v.Valid() {
+		return
+	}
+
+	for i, span := range hours {
+		v.CheckCode(span.Closes > span.Opens, validator.Path(validator.Index("hours", i), "closes"), validator.CodeGteField, validator.Params{"field": "opens"}, "must be later than opens")
+	}
+	if !v.Valid() {
+		return
+	}
+
+	// spans of the same day, in the order they open, must not overlap
+	order := make([]int, len(hours))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		ha, hb := hours[order[a]], hours[order[b]]
+		if ha.Day != hb.Day {
+			return ha.Day < hb.Day
+		}
+		return ha.Opens < hb.Opens
+	})
+	for k := 1; k < len(order); k++ {
+		prev, cur := hours[order[k-1]], hours[order[k]]
+		if prev.Day == cur.Day {
+			v.CheckCode(cur.Opens >= prev.Closes, validator.Path(validator.Index("hours", order[k]), "opens"), validator.CodeOverlap, nil, "must not overlap other opening hours of the day")
+		}
+	}
+}
+
+// Event is a date in the calendar of a school such as the start of a term
+// or a holiday. Both dates are inclusive
+type Event struct {
+	ID          int64          `json:"id"`
+	CreatedAt   time.Time      `json:"-"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	SchoolID    int64          `json:"school_id"`
+	Kind        string         `json:"kind" validate:"required,oneof=term_start term_end holiday open_day event"`
+	Title       string         `json:"title" validate:"required,max=200"`
+	Description string         `json:"description,omitempty" validate:"max=2000"`
+	StartsOn    string         `json:"starts_on" validate:"required,date"`
+	EndsOn      string         `json:"ends_on" validate:"required,date"`
+	Version     int32          `json:"version"`
+	School      *SchoolSummary `json:"school,omitempty"`
+}
+
+// ValidateEvent() checks a calendar event
+func ValidateEvent(v *validator.Validator, event *Event) {
+	// an event without an end lasts a single day
+	if event.EndsOn == "" {
+		event.EndsOn = event.StartsOn
+	}
+	v.Struct(event)
+
+	if len(v.FieldErrors("starts_on")) == 0 && len(v.FieldErrors("ends_on")) == 0 {
+		v.CheckCode(event.EndsOn >= event.StartsOn, "ends_on", validator.CodeGteField, validator.Params{"field": "starts_on"}, "must not be before starts_on")
+	}
+}
+
+// EventFilter holds the criteria of a calendar listing. From and To are
+// inclusive dates, an empty one leaves that side open
+type EventFilter struct {
+	From     string
+	To       string
+	Kind     string
+	District string
+	Level    string
+}
+
+// define a CalendarModel object that wraps a sql.DB connection pool
+type CalendarModel struct {
+	DB *sql.DB
+}
+
+// eventColumns is the select list matching scanDest()
+const eventColumns = `e.id, e.create_at, e.update_at, e.school_id, e.kind, e.title, e.description,
+	to_char(e.starts_on, 'YYYY-MM-DD'), to_char(e.ends_on, 'YYYY-MM-DD'), e.version`
+
+// scanDest() returns the scan destinations of eventColumns
+func (event *Event) scanDest() []interface{} {
+	return []interface{}{
+		&event.ID,
+		&event.CreatedAt,
+		&event.UpdatedAt,
+		&event.SchoolID,
+		&event.Kind,
+		&event.Title,
+		&event.Description,
+		&event.StartsOn,
+		&event.EndsOn,
+		&event.Version,
+	}
+}
+
+// GetHours() returns the opening hours of a school in weekday order
+func (m CalendarModel) GetHours(schoolID int64) ([]OpeningHours, error) {
+	hours, err := m.GetHoursForSchools([]int64{schoolID})
+	if err != nil {
+		return nil, err
+	}
+	if hours[schoolID] == nil {
+		return []OpeningHours{}, nil
+	}
+	return hours[schoolID], nil
+}
+
+// GetHoursForSchools() returns the opening hours of the given schools keyed by school id
+func (m CalendarModel) GetHoursForSchools(schoolIDs []int64) (map[int64][]OpeningHours, error) {
+	hours := make(map[int64][]OpeningHours)
+	if len(schoolIDs) == 0 {
+		return hours, nil
+	}
+	query := `
+		SELECT school_id, weekday, to_char(opens, 'HH24:MI'), to_char(closes, 'HH24:MI')
+		FROM school_hours
+		WHERE school_id = ANY($1)
+		ORDER BY school_id, weekday, opens`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(schoolIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var schoolID int64
+		var weekday int
+		var span OpeningHours
+		if err := rows.Scan(&schoolID, &weekday, &span.Opens, &span.Closes); err != nil {
+			return nil, err
+		}
+		span.Day = Weekdays[weekday-1]
+		hours[schoolID] = append(hours[schoolID], span)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return hours, nil
+}
+
+// ReplaceHours() swaps the opening hours of a school for a new week
+func (m CalendarModel) ReplaceHours(schoolID int64, hours []OpeningHours) error {
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM school_hours WHERE school_id = $1`, schoolID)
+	if err != nil {
+		return err
+	}
+	for _, span := range hours {
+		weekday := 1
+		for i, day := range Weekdays {
+			if day == span.Day {
+				weekday = i + 1
+			}
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO school_hours (school_id, weekday, opens, closes)
+			VALUES ($1, $2, $3, $4)`, schoolID, weekday, span.Opens, span.Closes)
+		if err != nil {
+			return translateConstraintError(err)
+		}
+	}
+	return tx.Commit()
+}
+
+// InsertEvent() adds an event to the calendar of a school
+func (m CalendarModel) InsertEvent(event *Event) error {
+	query := `
+		INSERT INTO school_events (school_id, kind, title, description, starts_on, ends_on)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, create_at, update_at, version`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	args := []interface{}{event.SchoolID, event.Kind, event.Title, event.Description, event.StartsOn, event.EndsOn}
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&event.ID, &event.CreatedAt, &event.UpdatedAt, &event.Version)
+}
+
+// GetEvent() retrieves an event of a school
+func (m CalendarModel) GetEvent(schoolID, id int64) (*Event, error) {
+	// Ensure that there is a valid id
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT ` + eventColumns + `
+		FROM school_events e
+		WHERE e.id = $1
+		AND e.school_id = $2`
+	var event Event
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, schoolID).Scan(event.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &event, nil
+}
+
+// UpdateEvent() changes an event using optimistic locking
+func (m CalendarModel) UpdateEvent(event *Event) error {
+	query := `
+		UPDATE school_events
+		SET kind = $1, title = $2, description = $3, starts_on = $4, ends_on = $5,
+			update_at = NOW(), version = version + 1
+		WHERE id = $6
+		AND school_id = $7
+		AND version = $8
+		RETURNING update_at, version`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	args := []interface{}{
+		event.Kind,
+		event.Title,
+		event.Description,
+		event.StartsOn,
+		event.EndsOn,
+		event.ID,
+		event.SchoolID,
+		event.Version,
+	}
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&event.UpdatedAt, &event.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteEvent() removes an event of a school
+func (m CalendarModel) DeleteEvent(schoolID, id int64) error {
+	// Ensure that there is a valid id
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM school_events
+		WHERE id = $1
+		AND school_id = $2`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, schoolID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetEvents() returns the events overlapping the filter's dates, in date
+// order. With schoolID 0 it spans every school matching the district and
+// level of the filter and fills in the school of each event
+func (m CalendarModel) GetEvents(schoolID int64, f EventFilter) ([]*Event, error) {
+	query := `
+		SELECT ` + eventColumns + `, s.name, s.level
+		FROM school_events e
+		JOIN schools s ON s.id = e.school_id
+		WHERE (e.school_id = $1 OR $1 = 0)
+		AND (e.ends_on >= NULLIF($2, '')::date OR $2 = '')
+		AND (e.starts_on <= NULLIF($3, '')::date OR $3 = '')
+		AND (e.kind = $4 OR $4 = '')
+		AND (s.district = $5 OR $5 = '')
+		AND (s.level = $6 OR $6 = '')
+		ORDER BY e.starts_on ASC, e.id ASC
+		LIMIT 5000`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	args := []interface{}{schoolID, f.From, f.To, f.Kind, f.District, f.Level}
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*Event{}
+	for rows.Next() {
+		event := Event{School: &SchoolSummary{}}
+		err := rows.Scan(append(event.scanDest(), &event.School.Name, &event.School.Level)...)
+		if err != nil {
+			return nil, err
+		}
+		event.School.ID = event.SchoolID
+		if schoolID != 0 {
+			event.School = nil
+		}
+		events = append(events, &event)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
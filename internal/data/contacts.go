@@ -0,0 +1,309 @@
+// Filename : internal/data/contacts.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"appletree.miguelavila.net/internal/validator"
+)
+
+// ContactRoles lists the roles a school contact can have
+var ContactRoles = []string{"general", "principal", "vice-principal", "bursar", "counselor", "secretary", "administrator", "other"}
+
+// Contact is a person to reach at a school. The primary contact is also
+// exposed through the contact, phone and email fields of the school
+type Contact struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"-"`
+	SchoolID  int64     `json:"school_id"`
+	Role      string    `json:"role" validate:"required,oneof=general principal vice-principal bursar counselor secretary administrator other"`
+	Name      string    `json:"name" validate:"required,max=200"`
+	Phone     string    `json:"phone,omitempty" validate:"omitempty,phone"`
+	PhoneE164 string    `json:"phone_e164,omitempty"`
+	Email     string    `json:"email,omitempty" validate:"omitempty,email"`
+	Primary   bool      `json:"primary"`
+	Version   int32     `json:"version"`
+}
+
+// ValidateContact() checks a contact and normalizes its phone number. The
+// primary contact needs the phone and email the school requires
+func ValidateContact(v *validator.Validator, contact *Contact) {
+	v.Struct(contact)
+	v.CheckCode(contact.Phone != "" || contact.Email != "", "phone", validator.CodeRequired, nil, "must be provided when there is no email")
+	if contact.Primary {
+		v.CheckCode(contact.Phone != "", "phone", validator.CodeRequired, validator.Params{"field": "primary", "value": true}, "must be provided")
+		v.CheckCode(contact.Email != "", "email", validator.CodeRequired, validator.Params{"field": "primary", "value": true}, "must be provided")
+	}
+
+	if !v.Valid() {
+		return
+	}
+	contact.PhoneE164 = ""
+	if phone, err := validator.ParsePhone(contact.Phone, validator.DefaultPhoneRegion); err == nil {
+		contact.Phone = phone.Display()
+		contact.PhoneE164 = phone.E164()
+	}
+}
+
+// execQueryer is satisfied by both *sql.DB and *sql.Tx
+type execQueryer interface {
+	queryRower
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// syncPrimaryContact() writes the flat contact fields of a school to its
+// primary contact, creating the contact when the school has none
+func syncPrimaryContact(ctx context.Context, q execQueryer, school *School) error {
+	query := `
+		INSERT INTO school_contacts (school_id, role, name, phone, phone_e164, email, is_primary)
+		VALUES ($1, 'general', $2, $3, $4, $5, true)
+		ON CONFLICT (school_id) WHERE is_primary DO UPDATE
+		SET name = EXCLUDED.name, phone = EXCLUDED.phone, phone_e164 = EXCLUDED.phone_e164, email = EXCLUDED.email,
+			version = school_contacts.version + 1
+		WHERE (school_contacts.name, school_contacts.phone, school_contacts.phone_e164, school_contacts.email)
+			IS DISTINCT FROM (EXCLUDED.name, EXCLUDED.phone, EXCLUDED.phone_e164, EXCLUDED.email)`
+	_, err := q.ExecContext(ctx, query, school.ID, school.Contact, school.Phone, school.PhoneE164, school.Email)
+	return err
+}
+
+// syncSchoolContact() copies the primary contact of a school onto its flat fields
+func syncSchoolContact(ctx context.Context, q execQueryer, schoolID int64) error {
+	query := `
+		UPDATE schools s
+		SET contact = c.name, phone = c.phone, phone_e164 = c.phone_e164, email = c.email, version = s.version + 1
+		FROM school_contacts c
+		WHERE c.school_id = s.id
+		AND c.is_primary
+		AND s.id = $1
+		AND (s.contact, s.phone, s.phone_e164, s.email) IS DISTINCT FROM (c.name, c.phone, c.phone_e164, c.email)`
+	_, err := q.ExecContext(ctx, query, schoolID)
+	return err
+}
+
+// demotePrimary() clears the primary flag of the other contacts of the school
+func demotePrimary(ctx context.Context, q execQueryer, contact *Contact) error {
+	if !contact.Primary {
+		return nil
+	}
+	query := `
+		UPDATE school_contacts
+		SET is_primary = false, version = version + 1
+		WHERE school_id = $1
+		AND is_primary
+		AND id <> $2`
+	_, err := q.ExecContext(ctx, query, contact.SchoolID, contact.ID)
+	return err
+}
+
+// define a ContactModel object that wraps a sql.DB connection pool
+type ContactModel struct {
+	DB *sql.DB
+}
+
+// Insert() adds a contact to a school, a new primary contact replaces the old one
+func (m ContactModel) Insert(contact *Contact) error {
+	query := `
+		INSERT INTO school_contacts (school_id, role, name, phone, phone_e164, email, is_primary)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, create_at, version`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	err = demotePrimary(ctx, tx, contact)
+	if err != nil {
+		return err
+	}
+	args := []interface{}{contact.SchoolID, contact.Role, contact.Name, contact.Phone, contact.PhoneE164, contact.Email, contact.Primary}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&contact.ID, &contact.CreatedAt, &contact.Version)
+	if err != nil {
+		return translateConstraintError(err)
+	}
+	err = syncSchoolContact(ctx, tx, contact.SchoolID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Get() retrieves a contact of a school
+func (m ContactModel) Get(schoolID, id int64) (*Contact, error) {
+	// Ensure that there is a valid id
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, create_at, school_id, role, name, phone, phone_e164, email, is_primary, version
+		FROM school_contacts
+		WHERE id = $1
+		AND school_id = $2`
+	var contact Contact
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, schoolID).Scan(contact.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &contact, nil
+}
+
+// Update() changes a contact using optimistic locking
+func (m ContactModel) Update(contact *Contact) error {
+	query := `
+		UPDATE school_contacts
+		SET role = $1, name = $2, phone = $3, phone_e164 = $4, email = $5, is_primary = $6, version = version + 1
+		WHERE id = $7
+		AND school_id = $8
+		AND version = $9
+		RETURNING version`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	err = demotePrimary(ctx, tx, contact)
+	if err != nil {
+		return err
+	}
+	args := []interface{}{
+		contact.Role,
+		contact.Name,
+		contact.Phone,
+		contact.PhoneE164,
+		contact.Email,
+		contact.Primary,
+		contact.ID,
+		contact.SchoolID,
+		contact.Version,
+	}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&contact.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return translateConstraintError(err)
+		}
+	}
+	err = syncSchoolContact(ctx, tx, contact.SchoolID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Delete() removes a contact of a school. The primary contact cannot be
+// removed, another contact has to become primary first
+func (m ContactModel) Delete(schoolID, id int64) error {
+	// Ensure that there is a valid id
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM school_contacts
+		WHERE id = $1
+		AND school_id = $2
+		RETURNING is_primary`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	var primary bool
+	err = tx.QueryRowContext(ctx, query, id, schoolID).Scan(&primary)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	if primary {
+		return ErrRecordInUse
+	}
+	return tx.Commit()
+}
+
+// GetAllForSchool() returns the contacts of a school, the primary contact first
+func (m ContactModel) GetAllForSchool(schoolID int64) ([]*Contact, error) {
+	query := `
+		SELECT id, create_at, school_id, role, name, phone, phone_e164, email, is_primary, version
+		FROM school_contacts
+		WHERE school_id = $1
+		ORDER BY is_primary DESC, id ASC`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, schoolID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	contacts := []*Contact{}
+	for rows.Next() {
+		var contact Contact
+		err := rows.Scan(contact.scanDest()...)
+		if err != nil {
+			return nil, err
+		}
+		contacts = append(contacts, &contact)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return contacts, nil
+}
+
+// scanDest() returns the scan destinations of the contact columns
+func (contact *Contact) scanDest() []interface{} {
+	return []interface{}{
+		&contact.ID,
+		&contact.CreatedAt,
+		&contact.SchoolID,
+		&contact.Role,
+		&contact.Name,
+		&contact.Phone,
+		&contact.PhoneE164,
+		&contact.Email,
+		&contact.Primary,
+		&contact.Version,
+	}
+}
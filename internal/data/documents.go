@@ -0,0 +1,283 @@
+// Filename : internal/data/documents.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"appletree.miguelavila.net/internal/validator"
+)
+
+// DocumentTypes are the kinds of documents a school files
+var DocumentTypes = []string{"accreditation", "fee_schedule", "license", "policy", "other"}
+
+// DocumentContentTypes are the sniffed types a document may have
+var DocumentContentTypes = []string{"application/pdf", "image/jpeg", "image/png"}
+
+// Scan statuses of a document, only clean documents are listed and served
+const (
+	ScanPending  = "pending"
+	ScanClean    = "clean"
+	ScanInfected = "infected"
+)
+
+// Document is a file such as an accreditation certificate. The file is the
+// blob at Key, SHA256 is its hex encoded checksum
+type Document struct {
+	ID            int64      `json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	SchoolID      int64      `json:"school_id"`
+	Type          string     `json:"type" validate:"required,oneof=accreditation fee_schedule license policy other"`
+	Title         string     `json:"title" validate:"required,max=200"`
+	ValidFrom     string     `json:"valid_from,omitempty" validate:"omitempty,date"`
+	ValidUntil    string     `json:"valid_until,omitempty" validate:"omitempty,date"`
+	Filename      string     `json:"filename" validate:"required,max=255"`
+	ContentType   string     `json:"content_type"`
+	Size          int64      `json:"size"`
+	SHA256        string     `json:"sha256"`
+	Key           string     `json:"-"`
+	ScanStatus    string     `json:"scan_status"`
+	ScanSignature string     `json:"scan_signature,omitempty"`
+	ScannedAt     *time.Time `json:"scanned_at,omitempty"`
+	Version       int32      `json:"version"`
+}
+
+// ValidateDocument() checks the metadata of a document
+func ValidateDocument(v *validator.Validator, document *Document) {
+	v.Struct(document)
+
+	if document.ValidFrom != "" && document.ValidUntil != "" && len(v.FieldErrors("valid_from")) == 0 && len(v.FieldErrors("valid_until")) == 0 {
+		v.CheckCode(document.ValidUntil >= document.ValidFrom, "valid_until", validator.CodeGteField, validator.Params{"field": "valid_from"}, "must not be before valid_from")
+	}
+	v.CheckCode(validator.In(document.ContentType, DocumentContentTypes...), "file", validator.CodeOneOf, validator.Params{"values": DocumentContentTypes}, "must be a PDF, JPEG or PNG file")
+}
+
+// define a DocumentModel object that wraps a sql.DB connection pool
+type DocumentModel struct {
+	DB *sql.DB
+}
+
+// documentColumns is the select list matching scanDest()
+const documentColumns = `id, create_at, school_id, type, title,
+	COALESCE(to_char(valid_from, 'YYYY-MM-DD'), ''), COALESCE(to_char(valid_until, 'YYYY-MM-DD'), ''),
+	filename, content_type, size, sha256, blob_key, scan_status, scan_signature, scanned_at, version`
+
+// scanDest() returns the scan destinations of documentColumns
+func (document *Document) scanDest() []interface{} {
+	return []interface{}{
+		&document.ID,
+		&document.CreatedAt,
+		&document.SchoolID,
+		&document.Type,
+		&document.Title,
+		&document.ValidFrom,
+		&document.ValidUntil,
+		&document.Filename,
+		&document.ContentType,
+		&document.Size,
+		&document.SHA256,
+		&document.Key,
+		&document.ScanStatus,
+		&document.ScanSignature,
+		&document.ScannedAt,
+		&document.Version,
+	}
+}
+
+// Insert() records an uploaded document, pending until it is scanned
+func (m DocumentModel) Insert(document *Document) error {
+	query := `
+		INSERT INTO school_documents (school_id, type, title, valid_from, valid_until,
+			filename, content_type, size, sha256, blob_key)
+		VALUES ($1, $2, $3, NULLIF($4, '')::date, NULLIF($5, '')::date, $6, $7, $8, $9, $10)
+		RETURNING id, create_at, scan_status, version`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	args := []interface{}{
+		document.SchoolID,
+		document.Type,
+		document.Title,
+		document.ValidFrom,
+		document.ValidUntil,
+		document.Filename,
+		document.ContentType,
+		document.Size,
+		document.SHA256,
+		document.Key,
+	}
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&document.ID, &document.CreatedAt, &document.ScanStatus, &document.Version)
+}
+
+// Get() retrieves a document of a school whatever its scan status
+func (m DocumentModel) Get(schoolID, id int64) (*Document, error) {
+	// Ensure that there is a valid id
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT ` + documentColumns + `
+		FROM school_documents
+		WHERE id = $1
+		AND school_id = $2`
+	var document Document
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, schoolID).Scan(document.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &document, nil
+}
+
+// GetAllForSchool() lists the documents of a school with a scan status,
+// every document when status is empty
+func (m DocumentModel) GetAllForSchool(schoolID int64, status string) ([]*Document, error) {
+	query := `
+		SELECT ` + documentColumns + `
+		FROM school_documents
+		WHERE school_id = $1
+		AND (scan_status = $2 OR $2 = '')
+		ORDER BY type ASC, valid_from DESC NULLS LAST, id DESC`
+	return m.query(query, schoolID, status)
+}
+
+// GetPending() lists the documents still waiting for a scan, oldest first
+func (m DocumentModel) GetPending() ([]*Document, error) {
+	query := `
+		SELECT ` + documentColumns + `
+		FROM school_documents
+		WHERE scan_status = 'pending'
+		ORDER BY id ASC`
+	return m.query(query)
+}
+
+// query() runs a select of documentColumns
+func (m DocumentModel) query(query string, args ...interface{}) ([]*Document, error) {
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	documents := []*Document{}
+	for rows.Next() {
+		var document Document
+		if err := rows.Scan(document.scanDest()...); err != nil {
+			return nil, err
+		}
+		documents = append(documents, &document)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return documents, nil
+}
+
+// Update() changes the metadata of a document using optimistic locking
+func (m DocumentModel) Update(document *Document) error {
+	query := `
+		UPDATE school_documents
+		SET type = $1, title = $2, valid_from = NULLIF($3, '')::date, valid_until = NULLIF($4, '')::date,
+			version = version + 1
+		WHERE id = $5
+		AND school_id = $6
+		AND version = $7
+		RETURNING version`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	args := []interface{}{
+		document.Type,
+		document.Title,
+		document.ValidFrom,
+		document.ValidUntil,
+		document.ID,
+		document.SchoolID,
+		document.Version,
+	}
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&document.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// SetScanResult() records the verdict of the scanner on a pending document
+func (m DocumentModel) SetScanResult(document *Document) error {
+	query := `
+		UPDATE school_documents
+		SET scan_status = $1, scan_signature = $2, scanned_at = NOW(), version = version + 1
+		WHERE id = $3
+		AND scan_status = 'pending'
+		RETURNING scanned_at, version`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, document.ScanStatus, document.ScanSignature, document.ID).Scan(&document.ScannedAt, &document.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete() removes a document of a school and returns it, so its blob can be removed
+func (m DocumentModel) Delete(schoolID, id int64) (*Document, error) {
+	// Ensure that there is a valid id
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM school_documents
+		WHERE id = $1
+		AND school_id = $2
+		RETURNING ` + documentColumns
+	var document Document
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, schoolID).Scan(document.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &document, nil
+}
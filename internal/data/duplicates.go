@@ -0,0 +1,422 @@
+// Filename : internal/data/duplicates.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// DuplicateListScore is the lowest score reported by GET /v1/schools/:id/duplicates
+	DuplicateListScore = 0.5
+	// DuplicateBlockScore is the score from which a new school is refused as a duplicate
+	DuplicateBlockScore = 0.7
+)
+
+// weights of the signals making up a duplicate score, they add up to 1
+const (
+	nameWeight    = 0.45
+	phoneWeight   = 0.25
+	emailWeight   = 0.15
+	addressWeight = 0.15
+)
+
+// freeMailDomains are shared by unrelated schools, so the domain alone says nothing
+var freeMailDomains = []string{"gmail.com", "yahoo.com", "hotmail.com", "outlook.com", "live.com", "icloud.com", "aol.com"}
+
+// DuplicateCandidate is an existing school that may be the same as another one
+type DuplicateCandidate struct {
+	School  *School  `json:"school"`
+	Score   float64  `json:"score"`
+	Reasons []string `json:"reasons"`
+}
+
+// emailDomain() returns the domain of an email unless it is a free mail provider
+func emailDomain(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, free := range freeMailDomains {
+		if domain == free {
+			return ""
+		}
+	}
+	return domain
+}
+
+// FindDuplicates() scores the schools that share a signal with school: a similar
+// name or address, the same phone number, the same email or email domain. The
+// candidates scoring at least minScore are returned best first
+func (m SchoolModel) FindDuplicates(school *School, minScore float64) ([]*DuplicateCandidate, error) {
+	query := fmt.Sprintf(`
+		SELECT %s,
+				similarity(lower(name), lower($1)),
+				similarity(lower(address), lower($2)),
+				$3 <> '' AND phone_e164 = $3,
+				$4 <> '' AND lower(email) = lower($4),
+				$5 <> '' AND split_part(lower(email), '@', 2) = $5
+			FROM schools
+			WHERE id <> $6
+			AND (
+				lower(name) %% lower($1)
+				OR lower(address) %% lower($2)
+				OR ($3 <> '' AND phone_e164 = $3)
+				OR ($5 <> '' AND split_part(lower(email), '@', 2) = $5)
+				OR ($4 <> '' AND lower(email) = lower($4))
+			)
+			ORDER BY similarity(lower(name), lower($1)) DESC, id ASC
+			LIMIT 50`, schoolColumns(""))
+	// create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	args := []interface{}{school.Name, school.Address, school.PhoneE164, school.Email, emailDomain(school.Email), school.ID}
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	candidates := []*DuplicateCandidate{}
+	for rows.Next() {
+		candidate := DuplicateCandidate{School: &School{}, Reasons: []string{}}
+		var name, address float64
+		var phone, email, domain bool
+		dest := append(candidate.School.scanDest(), &name, &address, &phone, &email, &domain)
+		err := rows.Scan(dest...)
+		if err != nil {
+			return nil, err
+		}
+
+		score := nameWeight*name + addressWeight*address
+		if name >= 0.5 {
+			candidate.Reasons = append(candidate.Reasons, "similar_name")
+		}
+		if address >= 0.5 {
+			candidate.Reasons = append(candidate.Reasons, "similar_address")
+		}
+		if phone {
+			score += phoneWeight
+			candidate.Reasons = append(candidate.Reasons, "same_phone")
+		}
+		switch {
+		case email:
+			score += emailWeight
+			candidate.Reasons = append(candidate.Reasons, "same_email")
+		case domain:
+			score += emailWeight * 2 / 3
+			candidate.Reasons = append(candidate.Reasons, "same_email_domain")
+		}
+		candidate.Score = math.Round(score*100) / 100
+		if candidate.Score >= minScore {
+			candidates = append(candidates, &candidate)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+	if len(candidates) > 10 {
+		candidates = candidates[:10]
+	}
+	return candidates, nil
+}
+
+// mergeRule copies one field of a school during a merge
+type mergeRule struct {
+	empty func(s *School) bool
+	copy  func(dst, src *School)
+}
+
+// mergeRules lists the fields a merge can take from another school
+var mergeRules = map[string]mergeRule{
+	"name":        {func(s *School) bool { return s.Name == "" }, func(d, s *School) { d.Name = s.Name }},
+	"level":       {func(s *School) bool { return s.Level == "" }, func(d, s *School) { d.Level = s.Level }},
+	"contact":     {func(s *School) bool { return s.Contact == "" }, func(d, s *School) { d.Contact = s.Contact }},
+	"phone":       {func(s *School) bool { return s.Phone == "" }, func(d, s *School) { d.Phone, d.PhoneE164 = s.Phone, s.PhoneE164 }},
+	"email":       {func(s *School) bool { return s.Email == "" }, func(d, s *School) { d.Email = s.Email }},
+	"website":     {func(s *School) bool { return s.Website == "" }, func(d, s *School) { d.Website = s.Website }},
+	"street":      {func(s *School) bool { return s.Street == "" }, func(d, s *School) { d.Street = s.Street }},
+	"town":        {func(s *School) bool { return s.Town == "" }, func(d, s *School) { d.Town = s.Town }},
+	"district":    {func(s *School) bool { return s.District == "" }, func(d, s *School) { d.District = s.District }},
+	"postal_code": {func(s *School) bool { return s.PostalCode == "" }, func(d, s *School) { d.PostalCode = s.PostalCode }},
+	"country":     {func(s *School) bool { return s.Country == "" }, func(d, s *School) { d.Country = s.Country }},
+	"mode":        {func(s *School) bool { return len(s.Mode) == 0 }, func(d, s *School) { d.Mode = append([]string{}, s.Mode...) }},
+	"location": {func(s *School) bool { return s.Latitude == nil || s.Longitude == nil }, func(d, s *School) {
+		d.Latitude, d.Longitude = s.Latitude, s.Longitude
+	}},
+}
+
+// MergeFields lists the fields that can be given in the prefer map of a merge
+func MergeFields() []string {
+	fields := make([]string, 0, len(mergeRules))
+	for field := range mergeRules {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// MergeSchools() folds the sources into target. A field listed in prefer is
+// taken from the school with the given id. Otherwise the target keeps its
+// value and empty fields are filled from the first source that has one,
+// except mode where the modes of every school are combined
+func MergeSchools(target *School, sources []*School, prefer map[string]int64) {
+	byID := map[int64]*School{target.ID: target}
+	for _, source := range sources {
+		byID[source.ID] = source
+	}
+
+	for field, rule := range mergeRules {
+		if id, ok := prefer[field]; ok {
+			if school, ok := byID[id]; ok && school != target {
+				rule.copy(target, school)
+			}
+			continue
+		}
+		if field == "mode" {
+			for _, source := range sources {
+				for _, mode := range source.Mode {
+					if !containsString(target.Mode, mode) {
+						target.Mode = append(target.Mode, mode)
+					}
+				}
+			}
+			continue
+		}
+		if !rule.empty(target) {
+			continue
+		}
+		for _, source := range sources {
+			if !rule.empty(source) {
+				rule.copy(target, source)
+				break
+			}
+		}
+	}
+}
+
+// containsString() reports whether value is in list
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Merge() stores the merged target and removes the sources in one transaction.
+// The ids of the sources redirect to the target from then on, and the merge is
+// written to the history of every school involved together with the removed rows
+func (m SchoolModel) Merge(target *School, sources []*School) error {
+	// create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	err = updateSchool(ctx, tx, target)
+	if err != nil {
+		return err
+	}
+	err = syncPrimaryContact(ctx, tx, target)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]int64, 0, len(sources))
+	for _, source := range sources {
+		ids = append(ids, source.ID)
+	}
+
+	// the people of the sources stay reachable as secondary contacts of the target
+	_, err = tx.ExecContext(ctx, `UPDATE school_contacts SET school_id = $1, is_primary = false WHERE school_id = ANY($2)`, target.ID, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	// earlier redirects to a source now lead to the target
+	_, err = tx.ExecContext(ctx, `UPDATE school_redirects SET school_id = $1 WHERE school_id = ANY($2)`, target.ID, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO school_redirects (old_id, school_id)
+		SELECT unnest($2::bigint[]), $1`, target.ID, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	// programs move too, unless the target already runs one with the same name
+	_, err = tx.ExecContext(ctx, `
+		UPDATE programs SET school_id = $1
+		WHERE id IN (
+			SELECT DISTINCT ON (lower(name)) id
+				FROM programs
+				WHERE school_id = ANY($2)
+				AND lower(name) NOT IN (SELECT lower(name) FROM programs WHERE school_id = $1)
+				ORDER BY lower(name), id
+		)`, target.ID, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	// enrollments move too, the target keeps its own figures for a year it
+	// already reported and otherwise the most recently updated source wins
+	_, err = tx.ExecContext(ctx, `
+		UPDATE school_enrollments SET school_id = $1
+		WHERE (school_id, academic_year) IN (
+			SELECT DISTINCT ON (academic_year) school_id, academic_year
+				FROM school_enrollments
+				WHERE school_id = ANY($2)
+				AND academic_year NOT IN (SELECT academic_year FROM school_enrollments WHERE school_id = $1)
+				ORDER BY academic_year, update_at DESC, array_position($2, school_id)
+		)`, target.ID, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE school_events SET school_id = $1 WHERE school_id = ANY($2)`, target.ID, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	// a week of opening hours is only taken over as a whole, from the first
+	// source that has one and only when the target has none of its own
+	_, err = tx.ExecContext(ctx, `
+		UPDATE school_hours SET school_id = $1
+		WHERE school_id = (
+			SELECT school_id
+				FROM school_hours
+				WHERE school_id = ANY($2)
+				ORDER BY array_position($2, school_id)
+				LIMIT 1
+		)
+		AND NOT EXISTS (SELECT 1 FROM school_hours WHERE school_id = $1)`, target.ID, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE school_licenses SET school_id = $1 WHERE school_id = ANY($2)`, target.ID, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE school_documents SET school_id = $1 WHERE school_id = ANY($2)`, target.ID, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	// images move as photos, the target keeps its own logo
+	_, err = tx.ExecContext(ctx, `UPDATE school_images SET school_id = $1, kind = 'photo' WHERE school_id = ANY($2)`, target.ID, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	// a user keeps a single review of the target, their earliest one wins
+	_, err = tx.ExecContext(ctx, `
+		UPDATE reviews SET school_id = $1
+		WHERE id IN (
+			SELECT DISTINCT ON (user_id) id
+				FROM reviews
+				WHERE school_id = ANY($2)
+				AND user_id NOT IN (SELECT user_id FROM reviews WHERE school_id = $1)
+				ORDER BY user_id, id
+		)`, target.ID, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	// users who starred a source have starred the target
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO user_favorites (user_id, school_id, create_at)
+		SELECT user_id, $1, min(create_at)
+			FROM user_favorites
+			WHERE school_id = ANY($2)
+			GROUP BY user_id
+		ON CONFLICT (user_id, school_id) DO NOTHING`, target.ID, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM schools WHERE id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return translateConstraintError(err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	// a source was removed while we were merging
+	if rows != int64(len(ids)) {
+		return ErrEditConflict
+	}
+
+	details, err := json.Marshal(map[string]interface{}{"merged_ids": ids, "merged": sources})
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO school_history (school_id, action, details) VALUES ($1, 'merge', $2)`, target.ID, details)
+	if err != nil {
+		return err
+	}
+	for _, source := range sources {
+		details, err := json.Marshal(map[string]interface{}{"merged_into": target.ID, "school": source})
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO school_history (school_id, action, details) VALUES ($1, 'merged_into', $2)`, source.ID, details)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// RedirectTarget() returns the id of the school a merged id now points to
+func (m SchoolModel) RedirectTarget(id int64) (int64, error) {
+	query := `
+		SELECT school_id
+			FROM school_redirects
+			WHERE old_id = $1`
+	// create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	var target int64
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&target)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+	return target, nil
+}
@@ -0,0 +1,274 @@
+// Filename : internal/data/enrollments.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+
+	"appletree.miguelavila.net/internal/validator"
+)
+
+// academicYearRX matches academic years written as 2023-2024
+var academicYearRX = regexp.MustCompile(`^[0-9]{4}-[0-9]{4}$`)
+
+func init() {
+	validator.RegisterRule("academic_year", func(fl validator.FieldLevel) *validator.FieldError {
+		if ValidAcademicYear(fl.Value.String()) {
+			return nil
+		}
+		return validator.Failed(validator.CodePattern, validator.Params{"format": "academic_year"}, "must be an academic year such as 2023-2024")
+	})
+}
+
+// ValidAcademicYear() reports whether year is two consecutive years, e.g. 2023-2024
+func ValidAcademicYear(year string) bool {
+	if !validator.Matches(year, academicYearRX) {
+		return false
+	}
+	start, _ := strconv.Atoi(year[:4])
+	end, _ := strconv.Atoi(year[5:])
+	return end == start+1
+}
+
+// Enrollment holds the figures of a school for one academic year
+type Enrollment struct {
+	SchoolID     int64     `json:"school_id"`
+	AcademicYear string    `json:"academic_year" validate:"required,academic_year"`
+	CreatedAt    time.Time `json:"-"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	Enrollment   int32     `json:"enrollment" validate:"min=0,max=100000"`
+	Capacity     int32     `json:"capacity" validate:"min=0,max=100000"`
+	Teachers     int32     `json:"teachers" validate:"min=0,max=10000"`
+	OverCapacity bool      `json:"over_capacity"`
+	Version      int32     `json:"version"`
+}
+
+// ValidateEnrollment() checks the figures of a year. Enrolling more students
+// than the school has room for must be flagged with over_capacity
+func ValidateEnrollment(v *validator.Validator, enrollment *Enrollment) {
+	v.Struct(enrollment)
+
+	if len(v.FieldErrors("enrollment")) == 0 && len(v.FieldErrors("capacity")) == 0 {
+		v.CheckCode(enrollment.OverCapacity || enrollment.Enrollment <= enrollment.Capacity, "enrollment", validator.CodeLteField, validator.Params{"field": "capacity"}, "must not be greater than capacity unless over_capacity is set")
+	}
+}
+
+// EnrollmentFilter holds the criteria of the enrollment summary
+type EnrollmentFilter struct {
+	Year     string
+	District string
+	Level    string
+}
+
+// EnrollmentSummary totals the figures of the schools reporting for a year
+type EnrollmentSummary struct {
+	AcademicYear       string  `json:"academic_year"`
+	Schools            int     `json:"schools"`
+	Enrollment         int64   `json:"enrollment"`
+	Capacity           int64   `json:"capacity"`
+	Teachers           int64   `json:"teachers"`
+	OverCapacity       int     `json:"over_capacity"`
+	Utilization        float64 `json:"utilization"`
+	StudentsPerTeacher float64 `json:"students_per_teacher"`
+}
+
+// define an EnrollmentModel object that wraps a sql.DB connection pool
+type EnrollmentModel struct {
+	DB *sql.DB
+}
+
+// Upsert() records the figures of a school for a year, replacing the ones
+// already there. It reports whether the year was new
+func (m EnrollmentModel) Upsert(enrollment *Enrollment) (bool, error) {
+	query := `
+		INSERT INTO school_enrollments (school_id, academic_year, enrollment, capacity, teachers, over_capacity)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (school_id, academic_year) DO UPDATE
+		SET enrollment = EXCLUDED.enrollment,
+			capacity = EXCLUDED.capacity,
+			teachers = EXCLUDED.teachers,
+			over_capacity = EXCLUDED.over_capacity,
+			update_at = NOW(),
+			version = school_enrollments.version + 1
+		RETURNING create_at, update_at, version, (xmax = 0) AS inserted`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	args := []interface{}{
+		enrollment.SchoolID,
+		enrollment.AcademicYear,
+		enrollment.Enrollment,
+		enrollment.Capacity,
+		enrollment.Teachers,
+		enrollment.OverCapacity,
+	}
+	var inserted bool
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&enrollment.CreatedAt, &enrollment.UpdatedAt, &enrollment.Version, &inserted)
+	if err != nil {
+		return false, translateConstraintError(err)
+	}
+	return inserted, nil
+}
+
+// Update() replaces the figures of a year using optimistic locking, the
+// version of the enrollment is the one the client last read
+func (m EnrollmentModel) Update(enrollment *Enrollment) error {
+	query := `
+		UPDATE school_enrollments
+		SET enrollment = $1, capacity = $2, teachers = $3, over_capacity = $4, update_at = NOW(), version = version + 1
+		WHERE school_id = $5
+		AND academic_year = $6
+		AND version = $7
+		RETURNING create_at, update_at, version`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	args := []interface{}{
+		enrollment.Enrollment,
+		enrollment.Capacity,
+		enrollment.Teachers,
+		enrollment.OverCapacity,
+		enrollment.SchoolID,
+		enrollment.AcademicYear,
+		enrollment.Version,
+	}
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&enrollment.CreatedAt, &enrollment.UpdatedAt, &enrollment.Version)
+	if err != nil {
+		switch {
+		// the year was changed or deleted since the client read it
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete() removes the figures of a school for a year
+func (m EnrollmentModel) Delete(schoolID int64, year string) error {
+	query := `
+		DELETE FROM school_enrollments
+		WHERE school_id = $1
+		AND academic_year = $2`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, schoolID, year)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetAllForSchool() returns the yearly figures of a school, latest year first
+func (m EnrollmentModel) GetAllForSchool(schoolID int64) ([]*Enrollment, error) {
+	query := `
+		SELECT school_id, academic_year, create_at, update_at, enrollment, capacity, teachers, over_capacity, version
+		FROM school_enrollments
+		WHERE school_id = $1
+		ORDER BY academic_year DESC`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, schoolID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	enrollments := []*Enrollment{}
+	for rows.Next() {
+		var enrollment Enrollment
+		err := rows.Scan(
+			&enrollment.SchoolID,
+			&enrollment.AcademicYear,
+			&enrollment.CreatedAt,
+			&enrollment.UpdatedAt,
+			&enrollment.Enrollment,
+			&enrollment.Capacity,
+			&enrollment.Teachers,
+			&enrollment.OverCapacity,
+			&enrollment.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		enrollments = append(enrollments, &enrollment)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return enrollments, nil
+}
+
+// Summary() totals the figures per academic year of the schools matching
+// the filter, latest year first
+func (m EnrollmentModel) Summary(f EnrollmentFilter) ([]*EnrollmentSummary, error) {
+	query := `
+		SELECT e.academic_year, COUNT(*), SUM(e.enrollment), SUM(e.capacity), SUM(e.teachers),
+			COUNT(*) FILTER (WHERE e.enrollment > e.capacity)
+		FROM school_enrollments e
+		JOIN schools s ON s.id = e.school_id
+		WHERE (e.academic_year = $1 OR $1 = '')
+		AND (s.district = $2 OR $2 = '')
+		AND (s.level = $3 OR $3 = '')
+		GROUP BY e.academic_year
+		ORDER BY e.academic_year DESC`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, f.Year, f.District, f.Level)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := []*EnrollmentSummary{}
+	for rows.Next() {
+		var summary EnrollmentSummary
+		err := rows.Scan(
+			&summary.AcademicYear,
+			&summary.Schools,
+			&summary.Enrollment,
+			&summary.Capacity,
+			&summary.Teachers,
+			&summary.OverCapacity,
+		)
+		if err != nil {
+			return nil, err
+		}
+		summary.Utilization = percentage(int(summary.Enrollment), int(summary.Capacity))
+		if summary.Teachers > 0 {
+			summary.StudentsPerTeacher = math.Round(float64(summary.Enrollment)/float64(summary.Teachers)*10) / 10
+		}
+		summaries = append(summaries, &summary)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
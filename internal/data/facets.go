@@ -0,0 +1,74 @@
+// Filename : internal/data/facets.go
+
+package data
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// FacetNames lists the fields a school listing can be faceted on
+var FacetNames = []string{"level", "mode", "district"}
+
+// FacetValue is the number of schools sharing a value of a facet
+type FacetValue struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// facetSQL counts the schools per value of each facet, %s is the filter
+// without the facet's own criterion so every value stays selectable
+var facetSQL = map[string]string{
+	"level":    `SELECT 'level', level, COUNT(*) FROM schools WHERE %s GROUP BY level`,
+	"mode":     `SELECT 'mode', m.value, COUNT(*) FROM schools, unnest(mode) AS m(value) WHERE %s GROUP BY m.value`,
+	"district": `SELECT 'district', district, COUNT(*) FROM schools WHERE %s AND district IS NOT NULL GROUP BY district`,
+}
+
+// Facets() returns the value counts of the requested facets for the schools
+// matching the filter. Each facet ignores its own criterion, so filtering on
+// mode=online still reports how many schools are face-to-face. All facets
+// are counted in a single query
+func (m SchoolModel) Facets(f SchoolFilter, facets []string) (map[string][]FacetValue, error) {
+	result := make(map[string][]FacetValue)
+	if len(facets) == 0 {
+		return result, nil
+	}
+
+	counts := []string{}
+	for _, facet := range facets {
+		counts = append(counts, fmt.Sprintf(facetSQL[facet], f.where(facet)))
+		result[facet] = []FacetValue{}
+	}
+	// a criterion left out by every facet would leave its placeholder untyped
+	query := fmt.Sprintf(`
+		WITH filter AS (SELECT $1::text, $2::text, $3::text, $4::text[], $5::text, $6::text, $7::text, $8::integer)
+		SELECT facet, value, total
+			FROM (%s) AS facets(facet, value, total)
+			ORDER BY facet ASC, total DESC, value ASC`, strings.Join(counts, "\n\t\t\tUNION ALL\n\t\t\t"))
+	// create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, f.args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var facet string
+		var value FacetValue
+		err := rows.Scan(&facet, &value.Value, &value.Count)
+		if err != nil {
+			return nil, err
+		}
+		result[facet] = append(result[facet], value)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
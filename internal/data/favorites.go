@@ -0,0 +1,132 @@
+// Filename : internal/data/favorites.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// isFavoriteSQL() returns the select expression of School.IsFavorite for the
+// schools of table, param holds the id of the user listing them. It is NULL
+// for the anonymous user so the flag is left out of the response
+func isFavoriteSQL(table, param string) string {
+	return fmt.Sprintf(`CASE WHEN %[2]s = 0 THEN NULL ELSE EXISTS (
+					SELECT 1 FROM user_favorites f WHERE f.user_id = %[2]s AND f.school_id = %[1]s.id
+				) END`, table, param)
+}
+
+// define a FavoriteModel object that wraps a sql.DB connection pool
+type FavoriteModel struct {
+	DB *sql.DB
+}
+
+// Insert() stars a school for a user, created is false when it already was
+func (m FavoriteModel) Insert(userID, schoolID int64) (bool, error) {
+	query := `
+		INSERT INTO user_favorites (user_id, school_id)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id, school_id) DO NOTHING`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, schoolID)
+	if err != nil {
+		return false, translateConstraintError(err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// Exists() reports whether a user starred a school
+func (m FavoriteModel) Exists(userID, schoolID int64) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM user_favorites
+			WHERE user_id = $1
+			AND school_id = $2
+		)`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	var exists bool
+	err := m.DB.QueryRowContext(ctx, query, userID, schoolID).Scan(&exists)
+	return exists, err
+}
+
+// Delete() removes the star of a user from a school
+func (m FavoriteModel) Delete(userID, schoolID int64) error {
+	query := `
+		DELETE FROM user_favorites
+		WHERE user_id = $1
+		AND school_id = $2`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, schoolID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetAll() returns the schools a user starred
+func (m FavoriteModel) GetAll(userID int64, filters Filters) ([]*School, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), %s, f.create_at AS favorited_at
+			FROM user_favorites f
+			JOIN schools s ON s.id = f.school_id
+			WHERE f.user_id = $1
+			ORDER BY %s %s, s.id ASC
+			LIMIT $2 OFFSET $3`, schoolColumns("s"), filters.sortColumn(), filters.sortOrder())
+	// create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	schools := []*School{}
+	for rows.Next() {
+		var school School
+		// favorited_at is only selected so that it can be sorted on
+		var favoritedAt time.Time
+		dest := append([]interface{}{&totalRecords}, school.scanDest()...)
+		err := rows.Scan(append(dest, &favoritedAt)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		favorite := true
+		school.IsFavorite = &favorite
+		schools = append(schools, &school)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculatesMetadata(totalRecords, filters.Page, filters.PageSize)
+	return schools, metadata, nil
+}
@@ -18,12 +18,12 @@ type Filters struct {
 
 func ValidateFilters(v *validator.Validator, f Filters) {
 	// check page and page size parameters
-	v.Check(f.Page > 0, "page", "must be greater than zero")
-	v.Check(f.Page <= 1000, "page", "must be maximum of 1000")
-	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
-	v.Check(f.PageSize <= 100, "page_size", "must be maximum of 100")
+	v.CheckCode(f.Page > 0, "page", validator.CodeMin, validator.Params{"min": 1}, "must be greater than zero")
+	v.CheckCode(f.Page <= 1000, "page", validator.CodeMax, validator.Params{"max": 1000}, "must be maximum of 1000")
+	v.CheckCode(f.PageSize > 0, "page_size", validator.CodeMin, validator.Params{"min": 1}, "must be greater than zero")
+	v.CheckCode(f.PageSize <= 100, "page_size", validator.CodeMax, validator.Params{"max": 100}, "must be maximum of 100")
 	// check that the sort parameter matches a value the acceptable sort list
-	v.Check(validator.In(f.Sort, f.SortList...), "sort", "invalid sort value")
+	v.CheckCode(validator.In(f.Sort, f.SortList...), "sort", validator.CodeOneOf, validator.Params{"values": f.SortList}, "invalid sort value")
 }
 
 // sortColumn() methods safety extracts the sort field query parameters
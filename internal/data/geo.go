@@ -0,0 +1,242 @@
+// Filename : internal/data/geo.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"appletree.miguelavila.net/internal/geocode"
+	"appletree.miguelavila.net/internal/validator"
+)
+
+// kilometres covered by one degree of latitude
+const kmPerDegree = 111.045
+
+// NearbySchool is a school together with its distance from the search point
+type NearbySchool struct {
+	*School
+	DistanceKM float64 `json:"distance_km"`
+}
+
+// NearbyFilter describes a nearest-school search
+type NearbyFilter struct {
+	Latitude  float64
+	Longitude float64
+	RadiusKM  float64
+	// ViewerID is the user asking, 0 when anonymous, for School.IsFavorite
+	ViewerID int64
+}
+
+// ValidateNearbyFilter() checks the search point and radius
+func ValidateNearbyFilter(v *validator.Validator, f NearbyFilter) {
+	v.CheckCode(f.Latitude >= -90, "lat", validator.CodeMin, validator.Params{"min": -90}, "must be at least -90")
+	v.CheckCode(f.Latitude <= 90, "lat", validator.CodeMax, validator.Params{"max": 90}, "must be maximum of 90")
+	v.CheckCode(f.Longitude >= -180, "lng", validator.CodeMin, validator.Params{"min": -180}, "must be at least -180")
+	v.CheckCode(f.Longitude <= 180, "lng", validator.CodeMax, validator.Params{"max": 180}, "must be maximum of 180")
+	v.CheckCode(f.RadiusKM > 0, "radius_km", validator.CodeMin, validator.Params{"min": 0}, "must be greater than zero")
+	v.CheckCode(f.RadiusKM <= 500, "radius_km", validator.CodeMax, validator.Params{"max": 500}, "must be maximum of 500")
+}
+
+// boundingBox() returns the latitude and longitude ranges that contain the
+// search circle. Near the poles or the antimeridian the longitude range is left open
+func (f NearbyFilter) boundingBox() (minLat, maxLat, minLng, maxLng float64) {
+	dLat := f.RadiusKM / kmPerDegree
+	minLat = math.Max(f.Latitude-dLat, -90)
+	maxLat = math.Min(f.Latitude+dLat, 90)
+
+	minLng, maxLng = -180, 180
+	cos := math.Cos(f.Latitude * math.Pi / 180)
+	if cos > 0.01 {
+		dLng := f.RadiusKM / (kmPerDegree * cos)
+		if f.Longitude-dLng >= -180 && f.Longitude+dLng <= 180 {
+			minLng, maxLng = f.Longitude-dLng, f.Longitude+dLng
+		}
+	}
+	return minLat, maxLat, minLng, maxLng
+}
+
+// Nearby() returns the schools within the radius ordered by distance. The
+// bounding box lets the index discard far away rows before the haversine
+// distance is computed for the rest
+func (m SchoolModel) Nearby(f NearbyFilter, filters Filters) ([]*NearbySchool, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), %s, distance_km,
+				%s
+			FROM (
+				SELECT *,
+					6371 * 2 * asin(least(1, sqrt(
+						power(sin(radians(latitude - $1) / 2), 2) +
+						cos(radians($1)) * cos(radians(latitude)) *
+						power(sin(radians(longitude - $2) / 2), 2)
+					))) AS distance_km
+				FROM schools
+				WHERE latitude BETWEEN $3 AND $4
+				AND longitude BETWEEN $5 AND $6
+			) AS candidates
+			WHERE distance_km <= $7
+			ORDER BY distance_km ASC, id ASC
+			LIMIT $8 OFFSET $9`, schoolColumns(""), isFavoriteSQL("candidates", "$10"))
+	// create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	minLat, maxLat, minLng, maxLng := f.boundingBox()
+	args := []interface{}{f.Latitude, f.Longitude, minLat, maxLat, minLng, maxLng, f.RadiusKM, filters.limit(), filters.offset(), f.ViewerID}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	schools := []*NearbySchool{}
+
+	for rows.Next() {
+		nearby := NearbySchool{School: &School{}}
+		dest := append([]interface{}{&totalRecords}, nearby.School.scanDest()...)
+		err := rows.Scan(append(dest, &nearby.DistanceKM, &nearby.School.IsFavorite)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		// a couple of decimals is plenty for display
+		nearby.DistanceKM = math.Round(nearby.DistanceKM*100) / 100
+		schools = append(schools, &nearby)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculatesMetadata(totalRecords, filters.Page, filters.PageSize)
+	return schools, metadata, nil
+}
+
+// GetAllLocated() returns every school that has coordinates, used for the GeoJSON feed
+func (m SchoolModel) GetAllLocated() ([]*School, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+			FROM schools
+			WHERE latitude IS NOT NULL AND longitude IS NOT NULL
+			ORDER BY id ASC`, schoolColumns(""))
+	// create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schools := []*School{}
+	for rows.Next() {
+		var school School
+		err := rows.Scan(school.scanDest()...)
+		if err != nil {
+			return nil, err
+		}
+		schools = append(schools, &school)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return schools, nil
+}
+
+// GetUnlocated() returns a batch of schools without coordinates or district, ordered by id
+// and starting after afterID, for the geocoding backfill
+func (m SchoolModel) GetUnlocated(afterID int64, limit int) ([]*School, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+			FROM schools
+			WHERE (latitude IS NULL OR district IS NULL)
+			AND id > $1
+			ORDER BY id ASC
+			LIMIT $2`, schoolColumns(""))
+	// create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schools := []*School{}
+	for rows.Next() {
+		var school School
+		err := rows.Scan(school.scanDest()...)
+		if err != nil {
+			return nil, err
+		}
+		schools = append(schools, &school)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return schools, nil
+}
+
+// UpdateLocation() stores the coordinates and district of a school using
+// the same optimistic locking as Update()
+func (m SchoolModel) UpdateLocation(school *School) error {
+	query := `
+		UPDATE schools
+		SET latitude = $1, longitude = $2, district = NULLIF($3, ''), version = version + 1
+		WHERE id = $4
+		AND version = $5
+		RETURNING version`
+	// create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	args := []interface{}{school.Latitude, school.Longitude, school.District, school.ID, school.Version}
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&school.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// GeocodeSchool() resolves the school's address against the gazetteer. The
+// district and coordinates are only replaced when overwrite is true or the
+// school has none yet. It reports whether the address matched a place
+func GeocodeSchool(g *geocode.Gazetteer, districts *Vocabulary, school *School, overwrite bool) bool {
+	if g == nil {
+		return false
+	}
+	address := strings.TrimSpace(school.Street + " " + school.Town)
+	if address == "" {
+		address = school.Address
+	}
+	match, err := g.Geocode(address)
+	if err != nil {
+		return false
+	}
+	// the gazetteer names districts, schools store the district code
+	if code, ok := districts.Resolve(match.Place.District); ok && (overwrite || school.District == "") {
+		school.District = code
+	}
+	if overwrite || school.Latitude == nil || school.Longitude == nil {
+		lat, lng := match.Place.Latitude, match.Place.Longitude
+		school.Latitude = &lat
+		school.Longitude = &lng
+	}
+	return true
+}
@@ -0,0 +1,262 @@
+// Filename : internal/data/images.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrImageLimit is returned when a school already has MaxPhotos photos
+var ErrImageLimit = errors.New("image limit reached")
+
+// ImageKinds are the kinds of school images, a school has a single logo
+var ImageKinds = []string{"logo", "photo"}
+
+// MaxPhotos is how many photos a school can have
+const MaxPhotos = 20
+
+// ThumbnailSizes are the edges, in pixels, of the squares thumbnails fit in
+var ThumbnailSizes = []int{96, 320, 800}
+
+// Image is a logo or photo of a school. The original and its thumbnails are
+// blobs below Key, the URLs are filled in by the API
+type Image struct {
+	ID         int64             `json:"id"`
+	CreatedAt  time.Time         `json:"-"`
+	SchoolID   int64             `json:"school_id"`
+	Kind       string            `json:"kind"`
+	Key        string            `json:"-"`
+	Ext        string            `json:"-"`
+	Width      int               `json:"width"`
+	Height     int               `json:"height"`
+	Size       int64             `json:"size"`
+	URL        string            `json:"url"`
+	Thumbnails map[string]string `json:"thumbnails,omitempty"`
+}
+
+// OriginalKey() is the blob of the uploaded image, stripped of its metadata
+func (image *Image) OriginalKey() string {
+	return fmt.Sprintf("%s/original.%s", image.Key, image.Ext)
+}
+
+// ThumbnailKey() is the blob of the thumbnail fitting a size x size square
+func (image *Image) ThumbnailKey(size int) string {
+	return fmt.Sprintf("%s/%d.%s", image.Key, size, image.Ext)
+}
+
+// BlobKeys() lists every blob of the image
+func (image *Image) BlobKeys() []string {
+	keys := []string{image.OriginalKey()}
+	for _, size := range ThumbnailSizes {
+		keys = append(keys, image.ThumbnailKey(size))
+	}
+	return keys
+}
+
+// define an ImageModel object that wraps a sql.DB connection pool
+type ImageModel struct {
+	DB *sql.DB
+}
+
+// imageColumns is the select list matching scanDest()
+const imageColumns = "id, create_at, school_id, kind, blob_key, ext, width, height, size"
+
+// scanDest() returns the scan destinations of imageColumns
+func (image *Image) scanDest() []interface{} {
+	return []interface{}{
+		&image.ID,
+		&image.CreatedAt,
+		&image.SchoolID,
+		&image.Kind,
+		&image.Key,
+		&image.Ext,
+		&image.Width,
+		&image.Height,
+		&image.Size,
+	}
+}
+
+// Insert() adds an image to a school. A new logo replaces the old one, which
+// is returned so its blobs can be removed
+func (m ImageModel) Insert(image *Image) ([]*Image, error) {
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	// a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	// lock the school so concurrent uploads count the same photos
+	_, err = tx.ExecContext(ctx, `SELECT id FROM schools WHERE id = $1 FOR UPDATE`, image.SchoolID)
+	if err != nil {
+		return nil, err
+	}
+
+	replaced := []*Image{}
+	if image.Kind == "logo" {
+		rows, err := tx.QueryContext(ctx, `
+			DELETE FROM school_images
+			WHERE school_id = $1
+			AND kind = 'logo'
+			RETURNING `+imageColumns, image.SchoolID)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var old Image
+			if err := rows.Scan(old.scanDest()...); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			replaced = append(replaced, &old)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+	} else {
+		var photos int
+		err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM school_images WHERE school_id = $1 AND kind = 'photo'`, image.SchoolID).Scan(&photos)
+		if err != nil {
+			return nil, err
+		}
+		if photos >= MaxPhotos {
+			return nil, ErrImageLimit
+		}
+	}
+
+	query := `
+		INSERT INTO school_images (school_id, kind, blob_key, ext, width, height, size)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, create_at`
+	args := []interface{}{image.SchoolID, image.Kind, image.Key, image.Ext, image.Width, image.Height, image.Size}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&image.ID, &image.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return replaced, tx.Commit()
+}
+
+// Get() retrieves an image of a school
+func (m ImageModel) Get(schoolID, id int64) (*Image, error) {
+	// Ensure that there is a valid id
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT ` + imageColumns + `
+		FROM school_images
+		WHERE id = $1
+		AND school_id = $2`
+	var image Image
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, schoolID).Scan(image.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &image, nil
+}
+
+// Delete() removes an image of a school and returns it, so its blobs can be removed
+func (m ImageModel) Delete(schoolID, id int64) (*Image, error) {
+	// Ensure that there is a valid id
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM school_images
+		WHERE id = $1
+		AND school_id = $2
+		RETURNING ` + imageColumns
+	var image Image
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, schoolID).Scan(image.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &image, nil
+}
+
+// GetAllForSchools() returns the images of the given schools keyed by school
+// id, the logo first and then the photos in upload order
+func (m ImageModel) GetAllForSchools(schoolIDs []int64) (map[int64][]*Image, error) {
+	return m.getForSchools(schoolIDs, ImageKinds)
+}
+
+// GetLogosForSchools() returns the logos of the given schools keyed by school id
+func (m ImageModel) GetLogosForSchools(schoolIDs []int64) (map[int64]*Image, error) {
+	images, err := m.getForSchools(schoolIDs, []string{"logo"})
+	if err != nil {
+		return nil, err
+	}
+	logos := make(map[int64]*Image, len(images))
+	for schoolID, logo := range images {
+		logos[schoolID] = logo[0]
+	}
+	return logos, nil
+}
+
+// getForSchools() returns the images of the given kinds keyed by school id
+func (m ImageModel) getForSchools(schoolIDs []int64, kinds []string) (map[int64][]*Image, error) {
+	images := make(map[int64][]*Image)
+	if len(schoolIDs) == 0 {
+		return images, nil
+	}
+	query := `
+		SELECT ` + imageColumns + `
+		FROM school_images
+		WHERE school_id = ANY($1)
+		AND kind = ANY($2)
+		ORDER BY kind = 'logo' DESC, id ASC`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(schoolIDs), pq.Array(kinds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var image Image
+		if err := rows.Scan(image.scanDest()...); err != nil {
+			return nil, err
+		}
+		images[image.SchoolID] = append(images[image.SchoolID], &image)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return images, nil
+}
@@ -0,0 +1,293 @@
+// Filename : internal/data/licenses.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"appletree.miguelavila.net/internal/validator"
+)
+
+// LicenseStatuses are what the issuing body says about a license
+var LicenseStatuses = []string{"active", "suspended", "revoked"}
+
+// LicenseStates are how an active license stands against its expiry date,
+// schools are filtered on them with ?license_status=
+var LicenseStates = []string{"valid", "expiring", "expired"}
+
+// License is an accreditation or operating license held by a school
+type License struct {
+	ID               int64      `json:"id"`
+	CreatedAt        time.Time  `json:"-"`
+	SchoolID         int64      `json:"school_id"`
+	IssuingBody      string     `json:"issuing_body" validate:"required,max=200"`
+	Number           string     `json:"number" validate:"required,max=100"`
+	Status           string     `json:"status" validate:"required,oneof=active suspended revoked"`
+	IssuedOn         string     `json:"issued_on" validate:"required,date"`
+	ExpiresOn        string     `json:"expires_on,omitempty" validate:"omitempty,date"`
+	State            string     `json:"state,omitempty"`
+	ExpiryNotifiedAt *time.Time `json:"expiry_notified_at,omitempty"`
+	Version          int32      `json:"version"`
+}
+
+// ValidateLicense() checks a license
+func ValidateLicense(v *validator.Validator, license *License) {
+	v.Struct(license)
+
+	if license.ExpiresOn != "" && len(v.FieldErrors("issued_on")) == 0 && len(v.FieldErrors("expires_on")) == 0 {
+		v.CheckCode(license.ExpiresOn >= license.IssuedOn, "expires_on", validator.CodeGteField, validator.Params{"field": "issued_on"}, "must not be before issued_on")
+	}
+}
+
+// SetState() works out the state of an active license on a day, it mirrors
+// the school_license_status() function of the database
+func (license *License) SetState(today time.Time, expiringDays int) {
+	license.State = ""
+	if license.Status != "active" {
+		return
+	}
+	// dates written as 2006-01-02 compare like strings
+	switch {
+	case license.ExpiresOn == "" || license.ExpiresOn > today.AddDate(0, 0, expiringDays).Format(DateLayout):
+		license.State = "valid"
+	case license.ExpiresOn >= today.Format(DateLayout):
+		license.State = "expiring"
+	default:
+		license.State = "expired"
+	}
+}
+
+// ExpiringLicense is a license about to expire together with its school
+type ExpiringLicense struct {
+	License
+	SchoolName string
+}
+
+// define a LicenseModel object that wraps a sql.DB connection pool
+type LicenseModel struct {
+	DB *sql.DB
+}
+
+// licenseColumns is the select list matching scanDest()
+const licenseColumns = `l.id, l.create_at, l.school_id, l.issuing_body, l.number, l.status,
+	to_char(l.issued_on, 'YYYY-MM-DD'), COALESCE(to_char(l.expires_on, 'YYYY-MM-DD'), ''),
+	l.expiry_notified_at, l.version`
+
+// scanDest() returns the scan destinations of licenseColumns
+func (license *License) scanDest() []interface{} {
+	return []interface{}{
+		&license.ID,
+		&license.CreatedAt,
+		&license.SchoolID,
+		&license.IssuingBody,
+		&license.Number,
+		&license.Status,
+		&license.IssuedOn,
+		&license.ExpiresOn,
+		&license.ExpiryNotifiedAt,
+		&license.Version,
+	}
+}
+
+// Insert() adds a license to a school
+func (m LicenseModel) Insert(license *License) error {
+	query := `
+		INSERT INTO school_licenses (school_id, issuing_body, number, status, issued_on, expires_on)
+		VALUES ($1, $2, $3, $4, $5::date, NULLIF($6, '')::date)
+		RETURNING id, create_at, version`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	args := []interface{}{license.SchoolID, license.IssuingBody, license.Number, license.Status, license.IssuedOn, license.ExpiresOn}
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&license.ID, &license.CreatedAt, &license.Version)
+	if err != nil {
+		return translateConstraintError(err)
+	}
+	return nil
+}
+
+// Get() retrieves a license of a school
+func (m LicenseModel) Get(schoolID, id int64) (*License, error) {
+	// Ensure that there is a valid id
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT ` + licenseColumns + `
+		FROM school_licenses l
+		WHERE l.id = $1
+		AND l.school_id = $2`
+	var license License
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, schoolID).Scan(license.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &license, nil
+}
+
+// GetAllForSchool() lists the licenses of a school, the latest issued first
+func (m LicenseModel) GetAllForSchool(schoolID int64) ([]*License, error) {
+	query := `
+		SELECT ` + licenseColumns + `
+		FROM school_licenses l
+		WHERE l.school_id = $1
+		ORDER BY l.issued_on DESC, l.id DESC`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, schoolID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	licenses := []*License{}
+	for rows.Next() {
+		var license License
+		if err := rows.Scan(license.scanDest()...); err != nil {
+			return nil, err
+		}
+		licenses = append(licenses, &license)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return licenses, nil
+}
+
+// Update() changes a license using optimistic locking. A new expiry date
+// clears the expiry alert so the renewed license is watched again
+func (m LicenseModel) Update(license *License) error {
+	query := `
+		UPDATE school_licenses
+		SET issuing_body = $1, number = $2, status = $3, issued_on = $4::date,
+			expiry_notified_at = CASE WHEN expires_on IS DISTINCT FROM NULLIF($5, '')::date THEN NULL ELSE expiry_notified_at END,
+			expires_on = NULLIF($5, '')::date,
+			version = version + 1
+		WHERE id = $6
+		AND school_id = $7
+		AND version = $8
+		RETURNING expiry_notified_at, version`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	args := []interface{}{
+		license.IssuingBody,
+		license.Number,
+		license.Status,
+		license.IssuedOn,
+		license.ExpiresOn,
+		license.ID,
+		license.SchoolID,
+		license.Version,
+	}
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&license.ExpiryNotifiedAt, &license.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return translateConstraintError(err)
+		}
+	}
+	return nil
+}
+
+// Delete() removes a license of a school
+func (m LicenseModel) Delete(schoolID, id int64) error {
+	// Ensure that there is a valid id
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM school_licenses
+		WHERE id = $1
+		AND school_id = $2`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, schoolID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetExpiring() lists the active licenses expiring within days that have
+// not been alerted on yet, the soonest first
+func (m LicenseModel) GetExpiring(days int) ([]*ExpiringLicense, error) {
+	query := `
+		SELECT ` + licenseColumns + `, s.name
+		FROM school_licenses l
+		JOIN schools s ON s.id = l.school_id
+		WHERE l.status = 'active'
+		AND l.expires_on BETWEEN current_date AND current_date + $1::integer
+		AND l.expiry_notified_at IS NULL
+		ORDER BY l.expires_on ASC, l.id ASC`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, days)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	licenses := []*ExpiringLicense{}
+	for rows.Next() {
+		var license ExpiringLicense
+		if err := rows.Scan(append(license.scanDest(), &license.SchoolName)...); err != nil {
+			return nil, err
+		}
+		licenses = append(licenses, &license)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return licenses, nil
+}
+
+// MarkNotified() flags a license once its expiry alert went out
+func (m LicenseModel) MarkNotified(id int64) error {
+	query := `
+		UPDATE school_licenses
+		SET expiry_notified_at = NOW()
+		WHERE id = $1`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	return err
+}
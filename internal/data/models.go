@@ -8,18 +8,46 @@ import (
 )
 
 var (
-	ErrRecordNotFound = errors.New("record not found")
-	ErrEditConflict   = errors.New("edit conflict")
+	ErrRecordNotFound  = errors.New("record not found")
+	ErrEditConflict    = errors.New("edit conflict")
+	ErrDuplicateRecord = errors.New("duplicate record")
+	ErrRecordInUse     = errors.New("record in use")
 )
 
 // A wrapper for out data models
 type Models struct {
-	Schools SchoolModel
+	Schools     SchoolModel
+	Levels      TermModel
+	Modes       TermModel
+	Districts   TermModel
+	Contacts    ContactModel
+	Programs    ProgramModel
+	Enrollments EnrollmentModel
+	Calendar    CalendarModel
+	Images      ImageModel
+	Documents   DocumentModel
+	Licenses    LicenseModel
+	Users       UserModel
+	Reviews     ReviewModel
+	Favorites   FavoriteModel
 }
 
 // NewModels() allows us to create new models
 func NewModels(db *sql.DB) *Models {
 	return &Models{
-		Schools: SchoolModel{DB: db},
+		Schools:     SchoolModel{DB: db},
+		Levels:      TermModel{DB: db, table: "levels"},
+		Modes:       TermModel{DB: db, table: "modes"},
+		Districts:   TermModel{DB: db, table: "districts"},
+		Contacts:    ContactModel{DB: db},
+		Programs:    ProgramModel{DB: db},
+		Enrollments: EnrollmentModel{DB: db},
+		Calendar:    CalendarModel{DB: db},
+		Images:      ImageModel{DB: db},
+		Documents:   DocumentModel{DB: db},
+		Licenses:    LicenseModel{DB: db},
+		Users:       UserModel{DB: db},
+		Reviews:     ReviewModel{DB: db},
+		Favorites:   FavoriteModel{DB: db},
 	}
 }
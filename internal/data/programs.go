@@ -0,0 +1,304 @@
+// Filename : internal/data/programs.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"appletree.miguelavila.net/internal/validator"
+	"github.com/lib/pq"
+)
+
+// Program is a course of study a school runs, such as STEM or TVET
+type Program struct {
+	ID          int64          `json:"id"`
+	CreatedAt   time.Time      `json:"-"`
+	SchoolID    int64          `json:"school_id"`
+	Name        string         `json:"name" validate:"required,max=200"`
+	Description string         `json:"description,omitempty" validate:"max=2000"`
+	Mode        []string       `json:"mode" validate:"required,min=1,max=5,unique,dive,required,max=200"`
+	Capacity    *int32         `json:"capacity,omitempty" validate:"omitempty,min=0,max=100000"`
+	Version     int32          `json:"version"`
+	School      *SchoolSummary `json:"school,omitempty"`
+}
+
+// SchoolSummary identifies the school of a record listed outside of its school
+type SchoolSummary struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Level string `json:"level"`
+}
+
+// ValidateProgram() checks a program. Its modes accept codes or aliases and
+// must be modes the school itself offers
+func ValidateProgram(v *validator.Validator, program *Program, school *School, modes *Vocabulary) {
+	v.Struct(program)
+
+	for i, mode := range program.Mode {
+		if mode == "" {
+			continue
+		}
+		if code, ok := modes.Resolve(mode); ok {
+			program.Mode[i] = code
+		}
+		v.CheckCode(validator.In(program.Mode[i], school.Mode...), validator.Index("mode", i), validator.CodeOneOf, validator.Params{"values": school.Mode}, "must be one of the school's modes")
+	}
+	if len(v.FieldErrors("mode")) == 0 {
+		v.CheckCode(validator.Unique(program.Mode), "mode", validator.CodeUnique, nil, "must not contain duplicates")
+	}
+}
+
+// ProgramFilter holds the criteria of the global program search
+type ProgramFilter struct {
+	Name        string
+	SchoolLevel string
+	Mode        []string
+}
+
+// define a ProgramModel object that wraps a sql.DB connection pool
+type ProgramModel struct {
+	DB *sql.DB
+}
+
+// programColumns is the select list matching scanDest()
+const programColumns = "p.id, p.create_at, p.school_id, p.name, p.description, p.mode, p.capacity, p.version"
+
+// scanDest() returns the scan destinations of programColumns
+func (program *Program) scanDest() []interface{} {
+	return []interface{}{
+		&program.ID,
+		&program.CreatedAt,
+		&program.SchoolID,
+		&program.Name,
+		&program.Description,
+		pq.Array(&program.Mode),
+		&program.Capacity,
+		&program.Version,
+	}
+}
+
+// Insert() adds a program to a school
+func (m ProgramModel) Insert(program *Program) error {
+	query := `
+		INSERT INTO programs (school_id, name, description, mode, capacity)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, create_at, version`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	args := []interface{}{program.SchoolID, program.Name, program.Description, pq.Array(program.Mode), program.Capacity}
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&program.ID, &program.CreatedAt, &program.Version)
+	if err != nil {
+		return translateConstraintError(err)
+	}
+	return nil
+}
+
+// Get() retrieves a program of a school
+func (m ProgramModel) Get(schoolID, id int64) (*Program, error) {
+	// Ensure that there is a valid id
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM programs p
+		WHERE p.id = $1
+		AND p.school_id = $2`, programColumns)
+	var program Program
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, schoolID).Scan(program.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &program, nil
+}
+
+// Update() changes a program using optimistic locking
+func (m ProgramModel) Update(program *Program) error {
+	query := `
+		UPDATE programs
+		SET name = $1, description = $2, mode = $3, capacity = $4, version = version + 1
+		WHERE id = $5
+		AND school_id = $6
+		AND version = $7
+		RETURNING version`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	args := []interface{}{
+		program.Name,
+		program.Description,
+		pq.Array(program.Mode),
+		program.Capacity,
+		program.ID,
+		program.SchoolID,
+		program.Version,
+	}
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&program.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return translateConstraintError(err)
+		}
+	}
+	return nil
+}
+
+// Delete() removes a program of a school
+func (m ProgramModel) Delete(schoolID, id int64) error {
+	// Ensure that there is a valid id
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM programs
+		WHERE id = $1
+		AND school_id = $2`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, schoolID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetAllForSchools() returns the programs of the given schools keyed by
+// school id, so a page of schools can embed its programs in one query
+func (m ProgramModel) GetAllForSchools(schoolIDs []int64) (map[int64][]*Program, error) {
+	programs := make(map[int64][]*Program)
+	if len(schoolIDs) == 0 {
+		return programs, nil
+	}
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM programs p
+		WHERE p.school_id = ANY($1)
+		ORDER BY p.name ASC, p.id ASC`, programColumns)
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(schoolIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var program Program
+		err := rows.Scan(program.scanDest()...)
+		if err != nil {
+			return nil, err
+		}
+		programs[program.SchoolID] = append(programs[program.SchoolID], &program)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return programs, nil
+}
+
+// ModesInUse() returns the modes the programs of a school are offered in
+func (m ProgramModel) ModesInUse(schoolID int64) ([]string, error) {
+	query := `
+		SELECT DISTINCT unnest(mode)
+		FROM programs
+		WHERE school_id = $1`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, schoolID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	modes := []string{}
+	for rows.Next() {
+		var mode string
+		if err := rows.Scan(&mode); err != nil {
+			return nil, err
+		}
+		modes = append(modes, mode)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return modes, nil
+}
+
+// GetAll() searches the programs of every school
+func (m ProgramModel) GetAll(f ProgramFilter, filters Filters) ([]*Program, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), %s, s.id, s.name, s.level
+			FROM programs p
+			JOIN schools s ON s.id = p.school_id
+			WHERE (to_tsvector('simple', p.name) @@ plainto_tsquery('simple', $1) OR $1 = '')
+			AND (s.level = $2 OR $2 = '')
+			AND (p.mode @> $3 OR $3 = '{}')
+			ORDER BY p.%s %s, p.id ASC
+			LIMIT $4 OFFSET $5`, programColumns, filters.sortColumn(), filters.sortOrder())
+	// create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	args := []interface{}{f.Name, f.SchoolLevel, pq.Array(f.Mode), filters.limit(), filters.offset()}
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	programs := []*Program{}
+	for rows.Next() {
+		program := Program{School: &SchoolSummary{}}
+		dest := append([]interface{}{&totalRecords}, program.scanDest()...)
+		err := rows.Scan(append(dest, &program.School.ID, &program.School.Name, &program.School.Level)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		programs = append(programs, &program)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculatesMetadata(totalRecords, filters.Page, filters.PageSize)
+	return programs, metadata, nil
+}
@@ -0,0 +1,271 @@
+// Filename : internal/data/reviews.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"appletree.miguelavila.net/internal/validator"
+	"github.com/lib/pq"
+)
+
+// ReviewStatuses are the stages of moderation, only approved reviews are
+// public and count towards the rating of a school
+var ReviewStatuses = []string{"pending", "approved", "rejected"}
+
+// Review is a rating of a school by a user, with an optional text
+type Review struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	SchoolID  int64     `json:"school_id"`
+	UserID    int64     `json:"-"`
+	Author    string    `json:"author"`
+	Rating    int       `json:"rating" validate:"required,min=1,max=5"`
+	Body      string    `json:"body" validate:"max=5000"`
+	Status    string    `json:"status"`
+	// FlaggedTerms are what the profanity filter found, they are shown to
+	// the author and the moderators only
+	FlaggedTerms   []string       `json:"flagged_terms,omitempty"`
+	ModerationNote string         `json:"moderation_note,omitempty"`
+	ModeratedAt    *time.Time     `json:"moderated_at,omitempty"`
+	Version        int32          `json:"version"`
+	School         *SchoolSummary `json:"school,omitempty"`
+}
+
+// ValidateReview() checks a review
+func ValidateReview(v *validator.Validator, review *Review) {
+	v.Struct(review)
+}
+
+// Redact() removes the moderation details from a review shown to the public
+func (review *Review) Redact() {
+	review.FlaggedTerms = nil
+	review.ModerationNote = ""
+	review.ModeratedAt = nil
+}
+
+// ReviewFilter narrows a review listing, zero values match everything
+type ReviewFilter struct {
+	SchoolID int64
+	UserID   int64
+	Status   string
+}
+
+// define a ReviewModel object that wraps a sql.DB connection pool
+type ReviewModel struct {
+	DB *sql.DB
+}
+
+// reviewColumns is the select list matching scanDest(), the author comes from users u
+const reviewColumns = `r.id, r.create_at, r.update_at, r.school_id, r.user_id, u.name, r.rating, r.body,
+	r.status, r.flagged_terms, r.moderation_note, r.moderated_at, r.version`
+
+// scanDest() returns the scan destinations of reviewColumns
+func (review *Review) scanDest() []interface{} {
+	return []interface{}{
+		&review.ID,
+		&review.CreatedAt,
+		&review.UpdatedAt,
+		&review.SchoolID,
+		&review.UserID,
+		&review.Author,
+		&review.Rating,
+		&review.Body,
+		&review.Status,
+		pq.Array(&review.FlaggedTerms),
+		&review.ModerationNote,
+		&review.ModeratedAt,
+		&review.Version,
+	}
+}
+
+// Insert() adds a review of a school, it waits in the moderation queue.
+// A second review of the same school by the same user is a duplicate
+func (m ReviewModel) Insert(review *Review) error {
+	query := `
+		INSERT INTO reviews (school_id, user_id, rating, body, flagged_terms)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, create_at, update_at, status, version`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	args := []interface{}{review.SchoolID, review.UserID, review.Rating, review.Body, pq.Array(review.FlaggedTerms)}
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&review.ID, &review.CreatedAt, &review.UpdatedAt, &review.Status, &review.Version)
+	if err != nil {
+		return translateConstraintError(err)
+	}
+	return nil
+}
+
+// Get() retrieves a review of a school
+func (m ReviewModel) Get(schoolID, id int64) (*Review, error) {
+	// Ensure that there is a valid id
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM reviews r
+		JOIN users u ON u.id = r.user_id
+		WHERE r.id = $1
+		AND r.school_id = $2`, reviewColumns)
+	var review Review
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, schoolID).Scan(review.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &review, nil
+}
+
+// Update() changes the rating or text of a review using optimistic locking.
+// The new text has not been seen by a moderator, so the review is queued again
+func (m ReviewModel) Update(review *Review) error {
+	query := `
+		UPDATE reviews
+		SET rating = $1, body = $2, flagged_terms = $3, status = 'pending', moderation_note = '',
+			moderated_at = NULL, moderated_by = NULL, update_at = NOW(), version = version + 1
+		WHERE id = $4
+		AND school_id = $5
+		AND version = $6
+		RETURNING update_at, status, version`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	args := []interface{}{
+		review.Rating,
+		review.Body,
+		pq.Array(review.FlaggedTerms),
+		review.ID,
+		review.SchoolID,
+		review.Version,
+	}
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&review.UpdatedAt, &review.Status, &review.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	review.ModerationNote, review.ModeratedAt = "", nil
+	return nil
+}
+
+// Moderate() records the decision of a moderator on a review using optimistic locking
+func (m ReviewModel) Moderate(review *Review, moderatorID int64) error {
+	query := `
+		UPDATE reviews
+		SET status = $1, moderation_note = $2, moderated_at = NOW(), moderated_by = $3, version = version + 1
+		WHERE id = $4
+		AND school_id = $5
+		AND version = $6
+		RETURNING moderated_at, version`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	args := []interface{}{review.Status, review.ModerationNote, moderatorID, review.ID, review.SchoolID, review.Version}
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&review.ModeratedAt, &review.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete() removes a review of a school
+func (m ReviewModel) Delete(schoolID, id int64) error {
+	// Ensure that there is a valid id
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM reviews
+		WHERE id = $1
+		AND school_id = $2`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, schoolID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetAll() lists reviews, each with a summary of its school
+func (m ReviewModel) GetAll(f ReviewFilter, filters Filters) ([]*Review, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), %s, s.id, s.name, s.level
+			FROM reviews r
+			JOIN users u ON u.id = r.user_id
+			JOIN schools s ON s.id = r.school_id
+			WHERE (r.school_id = $1 OR $1 = 0)
+			AND (r.user_id = $2 OR $2 = 0)
+			AND (r.status = $3 OR $3 = '')
+			ORDER BY r.%s %s, r.id ASC
+			LIMIT $4 OFFSET $5`, reviewColumns, filters.sortColumn(), filters.sortOrder())
+	// create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	args := []interface{}{f.SchoolID, f.UserID, f.Status, filters.limit(), filters.offset()}
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	reviews := []*Review{}
+	for rows.Next() {
+		review := Review{School: &SchoolSummary{}}
+		dest := append([]interface{}{&totalRecords}, review.scanDest()...)
+		err := rows.Scan(append(dest, &review.School.ID, &review.School.Name, &review.School.Level)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		reviews = append(reviews, &review)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculatesMetadata(totalRecords, filters.Page, filters.PageSize)
+	return reviews, metadata, nil
+}
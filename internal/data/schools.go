@@ -7,6 +7,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"appletree.miguelavila.net/internal/validator"
@@ -16,45 +17,196 @@ import (
 type School struct {
 	ID        int64     `json:"id"`
 	CreatedAt time.Time `json:"-"`
-	Name      string    `json:"name"`
-	Level     string    `json:"level"`
-	Contact   string    `json:"contact"`
-	Phone     string    `json:"phone"`
-	Email     string    `json:"email,omitempty"`
-	Website   string    `json:"website,omitempty"`
-	Address   string    `json:"address"`
-	Mode      []string  `json:"mode"`
-	Version   int32     `json:"version"`
+	Name      string    `json:"name" validate:"required,max=200"`
+	Level     string    `json:"level" validate:"required,max=200"`
+	Contact   string    `json:"contact" validate:"required,max=200"`
+	Phone     string    `json:"phone" validate:"required,phone"`
+	PhoneE164 string    `json:"phone_e164"`
+	Email     string    `json:"email,omitempty" validate:"required,email"`
+	Website   string    `json:"website,omitempty" validate:"required,website"`
+	Address   string    `json:"address" validate:"max=500"`
+	// Address is derived from these components, clients that only send
+	// address get it stored as the street line
+	Street     string   `json:"street" validate:"max=500"`
+	Town       string   `json:"town" validate:"max=100"`
+	District   string   `json:"district,omitempty"`
+	PostalCode string   `json:"postal_code,omitempty" validate:"max=20"`
+	Country    string   `json:"country" validate:"required,max=100"`
+	Mode       []string `json:"mode" validate:"required,min=1,max=5,unique,dive,required,max=200"`
+	Latitude   *float64 `json:"latitude,omitempty" validate:"required_with=Longitude,min=-90,max=90"`
+	Longitude  *float64 `json:"longitude,omitempty" validate:"required_with=Latitude,min=-180,max=180"`
+	Version    int32    `json:"version"`
+	// RatingAvg and RatingCount aggregate the approved reviews, they are
+	// maintained by the database and ignored on writes
+	RatingAvg   float64 `json:"rating_avg"`
+	RatingCount int     `json:"rating_count"`
+	// IsFavorite tells an authenticated user whether they starred the school
+	IsFavorite *bool `json:"is_favorite,omitempty"`
+	// Highlights holds the matching snippets of a ?q= search by field
+	Highlights map[string]string `json:"highlights,omitempty"`
+	// Logo is always filled in, the other images only with ?include=images
+	Logo *Image `json:"logo,omitempty"`
+	// Programs is only filled in with ?include=programs
+	Programs     []*Program     `json:"programs,omitempty"`
+	OpeningHours []OpeningHours `json:"opening_hours,omitempty"`
+	Images       []*Image       `json:"images,omitempty"`
 }
 
-func ValidateSchool(v *validator.Validator, school *School) {
+// DefaultCountry is assumed when a school does not give its country
+const DefaultCountry = "Belize"
 
-	v.Check(school.Name != "", "name", "must be provided")
-	v.Check(len(school.Name) <= 200, "name", "must no more 200 characters")
+// nullString scans a nullable text column into a string, NULL becomes ""
+type nullString struct {
+	s *string
+}
 
-	v.Check(school.Level != "", "level", "must be provided")
-	v.Check(len(school.Level) <= 200, "level", "must no more 200 characters")
+func (n nullString) Scan(value interface{}) error {
+	var ns sql.NullString
+	if err := ns.Scan(value); err != nil {
+		return err
+	}
+	*n.s = ns.String
+	return nil
+}
+
+// FormatAddress() joins the address components into the single line kept
+// in address, districtName is the display name of the district code
+func (school *School) FormatAddress(districtName string) string {
+	parts := []string{}
+	for _, part := range []string{school.Street, school.Town, districtName, school.PostalCode, school.Country} {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// schoolColumnNames lists the columns read into a School, in scan order
+var schoolColumnNames = []string{
+	"id", "create_at", "name", "level", "contact", "phone", "phone_e164",
+	"email", "website", "address", "street", "town", "district", "postal_code", "country",
+	"mode", "latitude", "longitude", "version", "rating_avg", "rating_count",
+}
+
+// schoolColumns() returns the select list for a School, qualified by the
+// table alias when the query joins other tables
+func schoolColumns(alias string) string {
+	if alias == "" {
+		return strings.Join(schoolColumnNames, ", ")
+	}
+	return alias + "." + strings.Join(schoolColumnNames, ", "+alias+".")
+}
 
-	v.Check(school.Contact != "", "contact", "must be provided")
-	v.Check(len(school.Contact) <= 200, "contact", "must no more 200 characters")
+// scanDest() returns the scan destinations matching schoolColumns()
+func (school *School) scanDest() []interface{} {
+	return []interface{}{
+		&school.ID,
+		&school.CreatedAt,
+		&school.Name,
+		&school.Level,
+		&school.Contact,
+		&school.Phone,
+		&school.PhoneE164,
+		&school.Email,
+		&school.Website,
+		&school.Address,
+		&school.Street,
+		&school.Town,
+		nullString{&school.District},
+		&school.PostalCode,
+		&school.Country,
+		pq.Array(&school.Mode),
+		&school.Latitude,
+		&school.Longitude,
+		&school.Version,
+		&school.RatingAvg,
+		&school.RatingCount,
+	}
+}
 
-	v.Check(school.Phone != "", "phone", "must be provided")
-	v.Check(validator.Matches(school.Phone, validator.PhoneRX), "phone", "must be a valid phone number")
+// Vocabularies groups the controlled vocabularies used to normalize a school
+type Vocabularies struct {
+	Levels    *Vocabulary
+	Modes     *Vocabulary
+	Districts *Vocabulary
+}
 
-	v.Check(school.Email != "", "email", "must be provided")
-	v.Check(validator.Matches(school.Email, validator.EmailRX), "email", "must be a valid email")
+// ValidateSchool() checks a school against the rules in its validate tags.
+// A valid school is normalized in place so it is stored in canonical form
+func ValidateSchool(v *validator.Validator, school *School, vocab Vocabularies) {
+	if school.Country == "" {
+		school.Country = DefaultCountry
+	}
+	// a legacy client sends the whole address as one line
+	if school.Street == "" && school.Town == "" {
+		school.Street = school.Address
+	}
 
-	v.Check(school.Website != "", "website", "must be provided")
-	v.Check(validator.ValidWebsite(school.Website), "website", "must be a valid website")
+	v.Struct(school)
+	v.CheckCode(school.Street != "" || school.Town != "", "address", validator.CodeRequired, nil, "must be provided")
 
-	v.Check(school.Address != "", "address", "must be provided")
-	v.Check(len(school.Address) <= 500, "address", "must no more 500 characters")
+	// level and mode accept a code or any of its aliases and are stored as the code
+	if school.Level != "" {
+		code, ok := vocab.Levels.Resolve(school.Level)
+		v.CheckCode(ok, "level", validator.CodeOneOf, validator.Params{"values": vocab.Levels.Codes()}, "must be a known level")
+		if ok {
+			school.Level = code
+		}
+	}
+	for i, mode := range school.Mode {
+		if mode == "" {
+			continue
+		}
+		code, ok := vocab.Modes.Resolve(mode)
+		v.CheckCode(ok, validator.Index("mode", i), validator.CodeOneOf, validator.Params{"values": vocab.Modes.Codes()}, "must be a known mode")
+		if ok {
+			school.Mode[i] = code
+		}
+	}
+	if school.District != "" {
+		code, ok := vocab.Districts.Resolve(school.District)
+		v.CheckCode(ok, "district", validator.CodeOneOf, validator.Params{"values": vocab.Districts.Codes()}, "must be a known district")
+		if ok {
+			school.District = code
+		}
+	}
+	// aliases of the same mode collapse into duplicates once normalized
+	if len(v.FieldErrors("mode")) == 0 {
+		v.CheckCode(validator.Unique(school.Mode), "mode", validator.CodeUnique, nil, "must not contain duplicates")
+	}
 
-	v.Check(school.Mode != nil, "mode", "must be provided")
-	v.Check(len(school.Mode) >= 1, "mode", "must contain at least one mode")
-	v.Check(len(school.Mode) <= 5, "mode", "must contain at most five mode")
-	v.Check(validator.Unique(school.Mode), "mode", "must not contain duplicates")
+	if !v.Valid() {
+		return
+	}
+	// keep the readable format in phone and the canonical form next to it
+	phone, err := validator.ParsePhone(school.Phone, validator.DefaultPhoneRegion)
+	if err == nil {
+		school.Phone = phone.Display()
+		school.PhoneE164 = phone.E164()
+	}
+	// store the website in canonical form so the same site is not saved twice
+	website, err := validator.CanonicalWebsite(school.Website)
+	if err == nil {
+		school.Website = website
+	}
+	school.Address = school.FormatAddress(vocab.Districts.Name(school.District))
+}
 
+// PhoneSearchPattern() turns a phone filter into a LIKE pattern for phone_e164.
+// A complete number matches exactly, anything else matches on its digits. An
+// empty filter gives an empty pattern, a filter without digits is an error
+func PhoneSearchPattern(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+	if phone, err := validator.ParsePhone(raw, validator.DefaultPhoneRegion); err == nil {
+		return phone.E164(), nil
+	}
+	digits, err := validator.PhoneDigits(raw)
+	if err != nil {
+		return "", err
+	}
+	return "%" + strings.TrimPrefix(digits, "+") + "%", nil
 }
 
 // define a SchoolModel object that wraps a sql.DB connection pool
@@ -62,11 +214,12 @@ type SchoolModel struct {
 	DB *sql.DB
 }
 
-// insert() allows us to create a new School
+// insert() allows us to create a new School together with its primary contact
 func (m SchoolModel) Insert(school *School) error {
 	query := `
-		INSERT INTO schools (name, level, contact, phone, email, website, address, mode)	
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		INSERT INTO schools (name, level, contact, phone, phone_e164, email, website, address, street, town, district, postal_code, country,
+			mode, latitude, longitude)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11, ''), $12, $13, $14, $15, $16)
 		RETURNING id, create_at, version
 	`
 	// Create a context
@@ -81,13 +234,36 @@ func (m SchoolModel) Insert(school *School) error {
 		school.Level,
 		school.Contact,
 		school.Phone,
+		school.PhoneE164,
 		school.Email,
 		school.Website,
 		school.Address,
+		school.Street,
+		school.Town,
+		school.District,
+		school.PostalCode,
+		school.Country,
 		pq.Array(school.Mode),
+		school.Latitude,
+		school.Longitude,
 	}
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// a no-op once the transaction is committed
+	defer tx.Rollback()
+
 	// run query ... -> expand the slice
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&school.ID, &school.CreatedAt, &school.Version)
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&school.ID, &school.CreatedAt, &school.Version)
+	if err != nil {
+		return err
+	}
+	err = syncPrimaryContact(ctx, tx, school)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // Get() allows us to retrieve a specific School
@@ -97,11 +273,11 @@ func (m SchoolModel) Get(id int64) (*School, error) {
 		return nil, ErrRecordNotFound
 	}
 	// Create the query for getting a specific School
-	query := `
-        SELECT id, name, level, contact, phone, email, website, address, mode, version
+	query := fmt.Sprintf(`
+        SELECT %s
         FROM schools
         WHERE id = $1
-    `
+    `, schoolColumns(""))
 	// declare a school variable and run query
 	var school School
 	// Create a context
@@ -111,18 +287,7 @@ func (m SchoolModel) Get(id int64) (*School, error) {
 	defer cancel()
 
 	// Execute the query
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
-		&school.ID,
-		&school.Name,
-		&school.Level,
-		&school.Contact,
-		&school.Phone,
-		&school.Email,
-		&school.Website,
-		&school.Address,
-		pq.Array(&school.Mode),
-		&school.Version,
-	)
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(school.scanDest()...)
 
 	if err != nil {
 		// Check error type
@@ -145,32 +310,69 @@ func (m SchoolModel) Get(id int64) (*School, error) {
 // B: Apples 3 buys 2 so 1 remains
 // USING Optimistic Locking to prevent multiple Optimistic sql
 func (m SchoolModel) Update(school *School) error {
-	query := `
-        UPDATE schools
-        SET name = $1, level = $2, contact = $3, phone = $4, email = $5, website = $6, address = $7, mode = $8, version = version + 1
-		WHERE id = $9
-		AND version = $10
-		RETURNING version
-		`
 	// Create a context
 	// Time starts when the context is created
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	// cleanup the context to prevent memory leaks
 	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	err = updateSchool(ctx, tx, school)
+	if err != nil {
+		return err
+	}
+	// the flat contact fields are the primary contact
+	err = syncPrimaryContact(ctx, tx, school)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// updateSchool() runs the optimistic update of Update(), inside a transaction when q is one
+func updateSchool(ctx context.Context, q queryRower, school *School) error {
+	query := `
+        UPDATE schools
+        SET name = $1, level = $2, contact = $3, phone = $4, phone_e164 = $5, email = $6, website = $7, address = $8,
+			street = $9, town = $10, district = NULLIF($11, ''), postal_code = $12, country = $13,
+			mode = $14, latitude = $15, longitude = $16, version = version + 1
+		WHERE id = $17
+		AND version = $18
+		RETURNING version
+		`
 	args := []interface{}{
 		school.Name,
 		school.Level,
 		school.Contact,
 		school.Phone,
+		school.PhoneE164,
 		school.Email,
 		school.Website,
 		school.Address,
+		school.Street,
+		school.Town,
+		school.District,
+		school.PostalCode,
+		school.Country,
 		pq.Array(school.Mode),
+		school.Latitude,
+		school.Longitude,
 		school.ID,
 		school.Version,
 	}
 	// check for edit conflict
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&school.Version)
+	err := q.QueryRowContext(ctx, query, args...).Scan(&school.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -224,28 +426,89 @@ func (m SchoolModel) Delete(id int64) error {
 
 }
 
-// func GetAll() method returns a list of all school sorted by id
-func (m SchoolModel) GetAll(name string, level string, mode []string, filters Filters) ([]*School, Metadata, error) {
+// SchoolFilter holds the criteria of a school listing, empty fields match every school
+type SchoolFilter struct {
+	Name     string
+	Level    string
+	Phone    string
+	Mode     []string
+	District string
+	// Query is free text searched across name, level, address and contact
+	Query string
+	// LicenseStatus is valid, expiring or expired, a license expiring within
+	// ExpiringDays counts as expiring
+	LicenseStatus string
+	ExpiringDays  int
+	// ViewerID is the user asking, 0 when anonymous. It is no criterion,
+	// GetAll() only uses it to work out IsFavorite
+	ViewerID int64
+}
+
+// schoolFilterSQL holds the condition of each SchoolFilter criterion in
+// argument order, the placeholders match the values returned by args()
+var schoolFilterSQL = []struct {
+	name      string
+	condition string
+}{
+	{"name", `(to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) OR $1 = '')`},
+	{"level", `(level = $2 OR $2 = '')`},
+	{"phone", `(phone_e164 LIKE $3 OR $3 = '')`},
+	{"mode", `(mode @> $4 OR $4 = '{}')`},
+	{"district", `(district = $5 OR $5 = '')`},
+	{"q", `(search @@ to_tsquery('simple', $6) OR $6 = '')`},
+	{"license_status", `(school_license_status(id, $8) = $7 OR $7 = '')`},
+}
+
+// where() joins the conditions of the filter, leaving out the named criteria
+func (f SchoolFilter) where(except ...string) string {
+	conditions := []string{}
+	for _, filter := range schoolFilterSQL {
+		if !validator.In(filter.name, except...) {
+			conditions = append(conditions, filter.condition)
+		}
+	}
+	return strings.Join(conditions, "\n\t\t\t\tAND ")
+}
+
+// args() returns the query arguments matching where()
+func (f SchoolFilter) args() []interface{} {
+	phone, err := PhoneSearchPattern(f.Phone)
+	if err != nil {
+		// readSchoolFilter() refuses such a filter, should one get here it
+		// has to match no school rather than every school
+		phone = "+"
+	}
+	return []interface{}{f.Name, f.Level, phone, pq.Array(f.Mode), f.District, SearchQuery(f.Query), f.LicenseStatus, f.ExpiringDays}
+}
+
+// func GetAll() method returns a list of all school sorted by id. With a
+// search query the schools can be sorted by relevance and carry highlighted snippets
+func (m SchoolModel) GetAll(f SchoolFilter, filters Filters) ([]*School, Metadata, error) {
+	// the best match comes first whatever the direction
+	order := filters.sortOrder()
+	if filters.sortColumn() == "relevance" {
+		order = "DESC"
+	}
 	// construct the query
 	query := fmt.Sprintf(
 		`
 			SELECT 
-					COUNT(*) OVER(), 
-					id, create_at, name, level, 
-					contact, phone, email, website, 
-					address, mode, version
-				FROM schools
-				WHERE (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) OR $1 = '')
-				AND (to_tsvector('simple', level) @@ plainto_tsquery('simple', $2) OR $2 = '')
-				AND (mode @> $3 OR $3 = '{}')
+					COUNT(*) OVER(), %s,
+					ts_rank(search, search_query) AS relevance,
+					CASE WHEN $6 = '' THEN '' ELSE ts_headline('simple', name, search_query, $11) END,
+					CASE WHEN $6 = '' THEN '' ELSE ts_headline('simple', address, search_query, $11) END,
+					CASE WHEN $6 = '' THEN '' ELSE ts_headline('simple', contact, search_query, $11) END,
+					%s
+				FROM schools, to_tsquery('simple', $6) AS search_query
+				WHERE %s
 				ORDER BY %s %s, id ASC
-				LIMIT $4 OFFSET $5`, filters.sortColumn(), filters.sortOrder())
+				LIMIT $9 OFFSET $10`, schoolColumns(""), isFavoriteSQL("schools", "$12"), f.where(), filters.sortColumn(), order)
 	// create a context
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	// cleanup the context to prevent memory leaks
 	defer cancel()
 
-	args := []interface{}{name, level, pq.Array(mode), filters.limit(), filters.offset()}
+	args := append(f.args(), filters.limit(), filters.offset(), headlineOptions, f.ViewerID)
 
 	// execute the query
 	rows, err := m.DB.QueryContext(ctx, query, args...)
@@ -263,24 +526,16 @@ func (m SchoolModel) GetAll(name string, level string, mode []string, filters Fi
 
 	for rows.Next() {
 		var school School
+		// relevance is only selected so that it can be sorted on
+		var relevance float64
+		var name, address, contact string
 		// scan the values from the row into school
-		err := rows.Scan(
-			&totalRecords,
-			&school.ID,
-			&school.CreatedAt,
-			&school.Name,
-			&school.Level,
-			&school.Contact,
-			&school.Phone,
-			&school.Email,
-			&school.Website,
-			&school.Address,
-			pq.Array(&school.Mode),
-			&school.Version,
-		)
+		dest := append([]interface{}{&totalRecords}, school.scanDest()...)
+		err := rows.Scan(append(dest, &relevance, &name, &address, &contact, &school.IsFavorite)...)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
+		school.setHighlights(map[string]string{"name": name, "address": address, "contact": contact})
 		// add the school to the slice
 		schools = append(schools, &school)
 
@@ -0,0 +1,31 @@
+// Filename : internal/data/schools_test.go
+
+package data
+
+import "testing"
+
+func TestPhoneSearchPattern(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{"607-1123", "+5016071123", false},
+		{"+1 212 555 0123", "+12125550123", false},
+		{"607", "%607%", false},
+		{"+501 60", "%50160%", false},
+		{"abc", "", true},
+		{"-", "", true},
+	}
+	for _, tt := range tests {
+		got, err := PhoneSearchPattern(tt.raw)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("PhoneSearchPattern(%q) = %q, %v, want %q", tt.raw, got, err, tt.want)
+		}
+	}
+	// an invalid filter that got past validation matches no school
+	if got := (SchoolFilter{Phone: "abc"}).args()[2]; got != "+" {
+		t.Errorf("args() phone pattern = %q, want %q", got, "+")
+	}
+}
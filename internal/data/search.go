@@ -0,0 +1,40 @@
+// Filename : internal/data/search.go
+
+package data
+
+import (
+	"strings"
+	"unicode"
+)
+
+// headlineOptions marks the matched words in the snippets returned with ?q=
+const headlineOptions = "StartSel=<mark>, StopSel=</mark>, HighlightAll=true"
+
+// highlightMark is how a highlighted snippet is recognised
+const highlightMark = "<mark>"
+
+// SearchQuery() turns free text into a to_tsquery expression where every word
+// is matched as a prefix, so "Appl Tre" finds "Apple Tree". Punctuation is
+// dropped so the input cannot change the meaning of the query
+func SearchQuery(q string) string {
+	words := strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		words[i] = word + ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+// setHighlights() keeps the snippets that actually contain a match
+func (school *School) setHighlights(fields map[string]string) {
+	for field, snippet := range fields {
+		if !strings.Contains(snippet, highlightMark) {
+			continue
+		}
+		if school.Highlights == nil {
+			school.Highlights = make(map[string]string)
+		}
+		school.Highlights[field] = snippet
+	}
+}
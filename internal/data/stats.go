@@ -0,0 +1,121 @@
+// Filename : internal/data/stats.go
+
+package data
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// MonthCount is the number of schools created in a month, formatted YYYY-MM
+type MonthCount struct {
+	Month string `json:"month"`
+	Count int    `json:"count"`
+}
+
+// Completeness is the share of schools, in percent, that filled in optional data
+type Completeness struct {
+	Website float64 `json:"website"`
+	Email   float64 `json:"email"`
+}
+
+// SchoolStats summarises the schools matching a filter
+type SchoolStats struct {
+	Total           int          `json:"total"`
+	ByLevel         []FacetValue `json:"by_level"`
+	ByMode          []FacetValue `json:"by_mode"`
+	ByDistrict      []FacetValue `json:"by_district"`
+	CreatedPerMonth []MonthCount `json:"created_per_month"`
+	Completeness    Completeness `json:"completeness"`
+}
+
+// Stats() aggregates the schools matching the filter. Every figure comes back
+// as a (kind, value, count) row of a single query
+func (m SchoolModel) Stats(f SchoolFilter) (*SchoolStats, error) {
+	query := fmt.Sprintf(`
+		WITH filtered AS (
+			SELECT level, mode, district, create_at, website, email
+				FROM schools
+				WHERE %s
+		)
+		SELECT 'total', '', COUNT(*) FROM filtered
+		UNION ALL
+		SELECT 'website', '', COUNT(*) FROM filtered WHERE website <> ''
+		UNION ALL
+		SELECT 'email', '', COUNT(*) FROM filtered WHERE email <> ''
+		UNION ALL
+		SELECT 'level', level, COUNT(*) FROM filtered GROUP BY level
+		UNION ALL
+		SELECT 'mode', m.value, COUNT(*) FROM filtered, unnest(mode) AS m(value) GROUP BY m.value
+		UNION ALL
+		SELECT 'district', district, COUNT(*) FROM filtered WHERE district IS NOT NULL GROUP BY district
+		UNION ALL
+		SELECT 'month', to_char(create_at AT TIME ZONE 'UTC', 'YYYY-MM'), COUNT(*) FROM filtered GROUP BY 2
+		ORDER BY 1 ASC, 3 DESC, 2 ASC`, f.where())
+	// create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, f.args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := &SchoolStats{
+		ByLevel:         []FacetValue{},
+		ByMode:          []FacetValue{},
+		ByDistrict:      []FacetValue{},
+		CreatedPerMonth: []MonthCount{},
+	}
+	websites, emails := 0, 0
+	for rows.Next() {
+		var kind, value string
+		var count int
+		err := rows.Scan(&kind, &value, &count)
+		if err != nil {
+			return nil, err
+		}
+		switch kind {
+		case "total":
+			stats.Total = count
+		case "website":
+			websites = count
+		case "email":
+			emails = count
+		case "level":
+			stats.ByLevel = append(stats.ByLevel, FacetValue{Value: value, Count: count})
+		case "mode":
+			stats.ByMode = append(stats.ByMode, FacetValue{Value: value, Count: count})
+		case "district":
+			stats.ByDistrict = append(stats.ByDistrict, FacetValue{Value: value, Count: count})
+		case "month":
+			stats.CreatedPerMonth = append(stats.CreatedPerMonth, MonthCount{Month: value, Count: count})
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// months read best in calendar order
+	sort.Slice(stats.CreatedPerMonth, func(i, j int) bool {
+		return stats.CreatedPerMonth[i].Month < stats.CreatedPerMonth[j].Month
+	})
+	stats.Completeness = Completeness{
+		Website: percentage(websites, stats.Total),
+		Email:   percentage(emails, stats.Total),
+	}
+	return stats, nil
+}
+
+// percentage() returns part of total in percent with one decimal
+func percentage(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(part)*1000/float64(total)) / 10
+}
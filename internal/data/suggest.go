@@ -0,0 +1,62 @@
+// Filename : internal/data/suggest.go
+
+package data
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Suggestion is the short form of a school used by the search box
+type Suggestion struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Level string `json:"level"`
+}
+
+// likeEscaper escapes the LIKE wildcards typed by the user
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// NormalizeSuggestQuery() folds the typed text so equivalent input shares a cache entry
+func NormalizeSuggestQuery(q string) string {
+	return strings.ToLower(strings.Join(strings.Fields(q), " "))
+}
+
+// Suggest() returns up to limit schools whose name starts with q or is close to
+// it. Prefix matches come first, then the rest by trigram word similarity so
+// that small typos such as "aple" still find "Apple Tree"
+func (m SchoolModel) Suggest(q string, limit int) ([]*Suggestion, error) {
+	query := `
+		SELECT id, name, level
+			FROM schools
+			WHERE lower(name) LIKE $2
+			OR $1 <% lower(name)
+			ORDER BY lower(name) LIKE $2 DESC, word_similarity($1, lower(name)) DESC, name ASC
+			LIMIT $3`
+	// create a context, suggestions are only useful when they are fast
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	q = NormalizeSuggestQuery(q)
+	rows, err := m.DB.QueryContext(ctx, query, q, likeEscaper.Replace(q)+"%", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []*Suggestion{}
+	for rows.Next() {
+		var suggestion Suggestion
+		err := rows.Scan(&suggestion.ID, &suggestion.Name, &suggestion.Level)
+		if err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, &suggestion)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return suggestions, nil
+}
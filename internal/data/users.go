@@ -0,0 +1,125 @@
+// Filename : internal/data/users.go
+
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"time"
+
+	"appletree.miguelavila.net/internal/validator"
+)
+
+// User is someone who writes reviews. Users identify themselves with a bearer
+// token handed out when they register; moderators are appointed in the database
+type User struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"-"`
+	Name      string    `json:"name" validate:"required,max=200"`
+	Email     string    `json:"email" validate:"required,email,max=500"`
+	Moderator bool      `json:"moderator"`
+	Version   int32     `json:"version"`
+}
+
+// AnonymousUser stands for a request without a token
+var AnonymousUser = &User{}
+
+// IsAnonymous() reports whether the user is the anonymous user
+func (user *User) IsAnonymous() bool {
+	return user == AnonymousUser
+}
+
+// ValidateUser() checks a user
+func ValidateUser(v *validator.Validator, user *User) {
+	v.Struct(user)
+}
+
+// tokenLength is the length of a plaintext token, 20 random bytes in base32
+const tokenLength = 32
+
+// Token is a bearer token, only its hash is stored
+type Token struct {
+	Plaintext string
+	Hash      []byte
+}
+
+// GenerateToken() creates a new random token
+func GenerateToken() (*Token, error) {
+	random := make([]byte, 20)
+	_, err := rand.Read(random)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(random)
+	return &Token{Plaintext: plaintext, Hash: hashToken(plaintext)}, nil
+}
+
+// hashToken() returns the SHA-256 hash a token is stored as
+func hashToken(plaintext string) []byte {
+	hash := sha256.Sum256([]byte(plaintext))
+	return hash[:]
+}
+
+// ValidTokenPlaintext() reports whether a string is shaped like a token
+func ValidTokenPlaintext(plaintext string) bool {
+	return len(plaintext) == tokenLength
+}
+
+// define a UserModel object that wraps a sql.DB connection pool
+type UserModel struct {
+	DB *sql.DB
+}
+
+// Insert() registers a user holding the given token
+func (m UserModel) Insert(user *User, token *Token) error {
+	query := `
+		INSERT INTO users (name, email, token_hash)
+		VALUES ($1, $2, $3)
+		RETURNING id, create_at, moderator, version`
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	args := []interface{}{user.Name, user.Email, token.Hash}
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Moderator, &user.Version)
+	if err != nil {
+		return translateConstraintError(err)
+	}
+	return nil
+}
+
+// GetForToken() retrieves the user holding a token
+func (m UserModel) GetForToken(plaintext string) (*User, error) {
+	query := `
+		SELECT id, create_at, name, email, moderator, version
+		FROM users
+		WHERE token_hash = $1`
+	var user User
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, hashToken(plaintext)).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Moderator,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
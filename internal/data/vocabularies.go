@@ -0,0 +1,304 @@
+// Filename : internal/data/vocabularies.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"appletree.miguelavila.net/internal/validator"
+	"github.com/lib/pq"
+)
+
+// codeRX limits codes to lower case words joined by hyphens, e.g. face-to-face
+var codeRX = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+func init() {
+	validator.RegisterRule("code", func(fl validator.FieldLevel) *validator.FieldError {
+		if validator.Matches(fl.Value.String(), codeRX) {
+			return nil
+		}
+		return validator.Failed(validator.CodePattern, validator.Params{"format": "code"}, "must be lower case words separated by hyphens")
+	})
+}
+
+// Term is an entry of a controlled vocabulary such as a school level or mode
+type Term struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"-"`
+	Code      string    `json:"code" validate:"required,max=50,code"`
+	Name      string    `json:"name" validate:"required,max=200"`
+	Aliases   []string  `json:"aliases" validate:"max=20,unique,dive,required,max=100"`
+	Version   int32     `json:"version"`
+}
+
+// ValidateTerm() checks a term and makes sure its code and aliases do not
+// already belong to another term of the same vocabulary
+func ValidateTerm(v *validator.Validator, term *Term, vocab *Vocabulary) {
+	// aliases are matched case-insensitively, store them the same way
+	for i, alias := range term.Aliases {
+		term.Aliases[i] = normalizeTerm(alias)
+	}
+	if term.Aliases == nil {
+		term.Aliases = []string{}
+	}
+
+	v.Struct(term)
+
+	if vocab == nil {
+		return
+	}
+	if owner, ok := vocab.Resolve(term.Code); ok && owner != vocab.codeOf(term.ID) {
+		v.AddFailure("code", validator.CodeUnique, validator.Params{"term": owner}, "is already used by another term")
+	}
+	for i, alias := range term.Aliases {
+		if owner, ok := vocab.Resolve(alias); ok && owner != vocab.codeOf(term.ID) {
+			v.AddFailure(validator.Index("aliases", i), validator.CodeUnique, validator.Params{"term": owner}, "is already used by another term")
+		}
+	}
+}
+
+// Vocabulary is an in-memory lookup of a vocabulary's codes and aliases
+type Vocabulary struct {
+	lookup map[string]string
+	ids    map[int64]string
+	names  map[string]string
+	codes  []string
+}
+
+// normalizeTerm() folds input so that "Pre-School " matches "pre-school"
+func normalizeTerm(value string) string {
+	return strings.ToLower(strings.Join(strings.Fields(value), " "))
+}
+
+// Resolve() returns the canonical code for a code or one of its aliases
+func (vocab *Vocabulary) Resolve(value string) (string, bool) {
+	if vocab == nil {
+		return "", false
+	}
+	code, ok := vocab.lookup[normalizeTerm(value)]
+	return code, ok
+}
+
+// Codes() returns the canonical codes in alphabetical order
+func (vocab *Vocabulary) Codes() []string {
+	if vocab == nil {
+		return nil
+	}
+	return vocab.codes
+}
+
+// Name() returns the display name of a canonical code
+func (vocab *Vocabulary) Name(code string) string {
+	if vocab == nil {
+		return ""
+	}
+	return vocab.names[code]
+}
+
+// codeOf() returns the current code of the term with the given id
+func (vocab *Vocabulary) codeOf(id int64) string {
+	return vocab.ids[id]
+}
+
+// define a TermModel object that wraps a sql.DB connection pool and the vocabulary table
+type TermModel struct {
+	DB    *sql.DB
+	table string
+}
+
+// Insert() allows us to create a new Term
+func (m TermModel) Insert(term *Term) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (code, name, aliases)
+		VALUES ($1, $2, $3)
+		RETURNING id, create_at, version
+	`, m.table)
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	args := []interface{}{term.Code, term.Name, pq.Array(term.Aliases)}
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&term.ID, &term.CreatedAt, &term.Version)
+	if err != nil {
+		return translateConstraintError(err)
+	}
+	return nil
+}
+
+// Get() allows us to retrieve a specific Term
+func (m TermModel) Get(id int64) (*Term, error) {
+	// Ensure that there is a valid id
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := fmt.Sprintf(`
+		SELECT id, create_at, code, name, aliases, version
+		FROM %s
+		WHERE id = $1
+	`, m.table)
+	var term Term
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&term.ID,
+		&term.CreatedAt,
+		&term.Code,
+		&term.Name,
+		pq.Array(&term.Aliases),
+		&term.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &term, nil
+}
+
+// Update() allows us to update a specific Term using optimistic locking
+func (m TermModel) Update(term *Term) error {
+	query := fmt.Sprintf(`
+		UPDATE %s
+		SET code = $1, name = $2, aliases = $3, version = version + 1
+		WHERE id = $4
+		AND version = $5
+		RETURNING version
+	`, m.table)
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	args := []interface{}{term.Code, term.Name, pq.Array(term.Aliases), term.ID, term.Version}
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&term.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return translateConstraintError(err)
+		}
+	}
+	return nil
+}
+
+// Delete() allows us to delete a specific Term that is not used by any school
+func (m TermModel) Delete(id int64) error {
+	// Ensure that there is a valid id
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := fmt.Sprintf(`
+		DELETE FROM %s
+		WHERE id = $1
+	`, m.table)
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return translateConstraintError(err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetAll() returns every term sorted by code, vocabularies are small so there is no paging
+func (m TermModel) GetAll() ([]*Term, error) {
+	query := fmt.Sprintf(`
+		SELECT id, create_at, code, name, aliases, version
+		FROM %s
+		ORDER BY code ASC
+	`, m.table)
+	// Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// cleanup the context to prevent memory leaks
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	terms := []*Term{}
+	for rows.Next() {
+		var term Term
+		err := rows.Scan(
+			&term.ID,
+			&term.CreatedAt,
+			&term.Code,
+			&term.Name,
+			pq.Array(&term.Aliases),
+			&term.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, &term)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return terms, nil
+}
+
+// Vocabulary() loads the codes and aliases of the table into memory
+func (m TermModel) Vocabulary() (*Vocabulary, error) {
+	terms, err := m.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	vocab := &Vocabulary{
+		lookup: make(map[string]string),
+		ids:    make(map[int64]string),
+		names:  make(map[string]string),
+	}
+	for _, term := range terms {
+		vocab.lookup[normalizeTerm(term.Code)] = term.Code
+		for _, alias := range term.Aliases {
+			vocab.lookup[normalizeTerm(alias)] = term.Code
+		}
+		vocab.ids[term.ID] = term.Code
+		vocab.names[term.Code] = term.Name
+		vocab.codes = append(vocab.codes, term.Code)
+	}
+	sort.Strings(vocab.codes)
+	return vocab, nil
+}
+
+// translateConstraintError() maps PostgreSQL constraint violations onto our errors
+func translateConstraintError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case "23505":
+			return ErrDuplicateRecord
+		case "23503":
+			return ErrRecordInUse
+		}
+	}
+	return err
+}
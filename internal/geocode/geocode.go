@@ -0,0 +1,213 @@
+// Filename : internal/geocode/geocode.go
+
+package geocode
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// MinScore is the lowest similarity accepted as a match
+const MinScore = 0.75
+
+var ErrNoMatch = errors.New("no gazetteer entry matches the address")
+
+// Place is a town, village or district centre from the gazetteer
+type Place struct {
+	Name      string
+	District  string
+	Kind      string // town, village or district
+	Latitude  float64
+	Longitude float64
+
+	normalized string
+	words      int
+}
+
+// Match is the place chosen for an address and how closely it matched
+type Match struct {
+	Place Place
+	Score float64
+}
+
+// Gazetteer resolves addresses against a list of places. It works fully
+// offline, the list is read from a CSV file once at start up
+type Gazetteer struct {
+	places []Place
+}
+
+// Load() reads a gazetteer CSV with a header row and the columns
+// name, district, kind, latitude, longitude
+func Load(path string) (*Gazetteer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// Read() parses a gazetteer CSV from r
+func Read(r io.Reader) (*Gazetteer, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 5
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("geocode: gazetteer is empty")
+	}
+
+	g := &Gazetteer{}
+	// skip the header row
+	for i, record := range records[1:] {
+		lat, err := strconv.ParseFloat(record[3], 64)
+		if err != nil || lat < -90 || lat > 90 {
+			return nil, fmt.Errorf("geocode: line %d: invalid latitude %q", i+2, record[3])
+		}
+		lng, err := strconv.ParseFloat(record[4], 64)
+		if err != nil || lng < -180 || lng > 180 {
+			return nil, fmt.Errorf("geocode: line %d: invalid longitude %q", i+2, record[4])
+		}
+		place := Place{
+			Name:      record[0],
+			District:  record[1],
+			Kind:      record[2],
+			Latitude:  lat,
+			Longitude: lng,
+		}
+		place.normalized = normalize(place.Name)
+		place.words = len(strings.Fields(place.normalized))
+		if place.words == 0 {
+			return nil, fmt.Errorf("geocode: line %d: empty place name", i+2)
+		}
+		g.places = append(g.places, place)
+	}
+
+	// longer names first so "san ignacio" is preferred over a shorter name on equal scores
+	sort.SliceStable(g.places, func(i, j int) bool {
+		return g.places[i].words > g.places[j].words
+	})
+	return g, nil
+}
+
+// Len() returns the number of places in the gazetteer
+func (g *Gazetteer) Len() int {
+	return len(g.places)
+}
+
+// Geocode() finds the place an address refers to. Every run of words in the
+// address is compared with the place names, tolerating small typos, and towns
+// and villages win over a district centre with the same score
+func (g *Gazetteer) Geocode(address string) (Match, error) {
+	words := strings.Fields(normalize(address))
+	if len(words) == 0 {
+		return Match{}, ErrNoMatch
+	}
+
+	var best Match
+	found := false
+	for _, place := range g.places {
+		score := 0.0
+		for i := 0; i+place.words <= len(words); i++ {
+			candidate := strings.Join(words[i:i+place.words], " ")
+			if s := similarity(candidate, place.normalized); s > score {
+				score = s
+			}
+		}
+		if score < MinScore {
+			continue
+		}
+		if !found || score > best.Score || (score == best.Score && best.Place.Kind == "district" && place.Kind != "district") {
+			best = Match{Place: place, Score: score}
+			found = true
+		}
+	}
+
+	if !found {
+		return Match{}, ErrNoMatch
+	}
+	return best, nil
+}
+
+// accents folds the accented letters used in Belizean place names
+var accents = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ä", "a",
+	"é", "e", "è", "e", "ê", "e", "ë", "e",
+	"í", "i", "ì", "i", "î", "i", "ï", "i",
+	"ó", "o", "ò", "o", "ô", "o", "ö", "o",
+	"ú", "u", "ù", "u", "û", "u", "ü", "u",
+	"ñ", "n", "ç", "c",
+)
+
+// normalize() lower cases text, strips accents and replaces punctuation with spaces
+func normalize(s string) string {
+	var b strings.Builder
+	for _, r := range accents.Replace(strings.ToLower(s)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune(' ')
+		}
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// similarity() scores two strings between 0 and 1 using the edit distance,
+// so "benque viejo" and "benqe viejo" still match
+func similarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	ra, rb := []rune(a), []rune(b)
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+// levenshtein() returns the number of single character edits between a and b
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,128 @@
+// Filename : internal/geocode/geocode_test.go
+
+package geocode
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testGazetteer = `# a few places of the real gazetteer
+name,district,kind,latitude,longitude
+Belize City,Belize,town,17.4986,-88.1886
+San Ignacio,Cayo,town,17.1561,-89.0714
+Santa Elena,Cayo,town,17.1606,-89.0653
+Benque Viejo del Carmen,Cayo,town,17.0747,-89.1392
+Benque Viejo,Cayo,town,17.0747,-89.1392
+San Pedro,Belize,town,17.9214,-87.9611
+Orange Walk Town,Orange Walk,town,18.0812,-88.5633
+Orange Walk,Orange Walk,town,18.0812,-88.5633
+Orange Walk District,Orange Walk,district,18.0812,-88.5633
+Cayo District,Cayo,district,17.2514,-88.7590
+San José,Orange Walk,village,18.0667,-88.7000
+`
+
+func TestGeocode(t *testing.T) {
+	g, err := Read(strings.NewReader(testGazetteer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		address string
+		name    string
+		wantErr error
+	}{
+		{"12 Main Street, San Ignacio, Cayo", "San Ignacio", nil},
+		{"SAN IGNACIO", "San Ignacio", nil},
+		// accents are folded on both sides
+		{"Sán Ígnacio", "San Ignacio", nil},
+		{"San Jose village", "San José", nil},
+		// an exact match beats a close one
+		{"San Jose, Orange Walk", "Orange Walk", nil},
+		{"San José", "San José", nil},
+		// small typos are tolerated
+		{"Benqe Viejo", "Benque Viejo", nil},
+		{"Bengue Viejo del Carmen", "Benque Viejo del Carmen", nil},
+		{"San Ignasio", "San Ignacio", nil},
+		{"Belize Cty", "Belize City", nil},
+		// the longer name wins on an equal score
+		{"Benque Viejo del Carmen, Cayo", "Benque Viejo del Carmen", nil},
+		{"Orange Walk Town", "Orange Walk Town", nil},
+		// a town wins over the district centre
+		{"Orange Walk District", "Orange Walk", nil},
+		{"Cayo District", "Cayo District", nil},
+		{"Main Street, Orange Walk", "Orange Walk", nil},
+		// punctuation is treated as spaces
+		{"San-Pedro, Ambergris Caye", "San Pedro", nil},
+		{"", "", ErrNoMatch},
+		{"!!!", "", ErrNoMatch},
+		{"Dangriga", "", ErrNoMatch},
+		{"Santo Domingo", "", ErrNoMatch},
+	}
+
+	for _, tt := range tests {
+		match, err := g.Geocode(tt.address)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Geocode(%q) error = %v, want %v", tt.address, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Geocode(%q) unexpected error: %v", tt.address, err)
+			continue
+		}
+		if match.Place.Name != tt.name {
+			t.Errorf("Geocode(%q) = %q, want %q", tt.address, match.Place.Name, tt.name)
+		}
+		if match.Score < MinScore || match.Score > 1 {
+			t.Errorf("Geocode(%q) score = %v, want between %v and 1", tt.address, match.Score, MinScore)
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		ok    bool
+	}{
+		{"header only", "name,district,kind,latitude,longitude\n", true},
+		{"comments", "# note\nname,district,kind,latitude,longitude\nBelmopan,Cayo,town,17.2514,-88.7590\n", true},
+		{"latitude out of range", "name,district,kind,latitude,longitude\nBelmopan,Cayo,town,97.2,-88.7\n", false},
+		{"longitude not a number", "name,district,kind,latitude,longitude\nBelmopan,Cayo,town,17.2,west\n", false},
+		{"empty name", "name,district,kind,latitude,longitude\n--,Cayo,town,17.2,-88.7\n", false},
+		{"missing column", "name,district,kind,latitude,longitude\nBelmopan,Cayo,17.2,-88.7\n", false},
+	}
+
+	for _, tt := range tests {
+		_, err := Read(strings.NewReader(tt.input))
+		if tt.ok && err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"cayo", "cayo", 1},
+		{"", "", 1},
+		{"cayo", "", 0},
+		{"benque", "benqe", 1 - 1.0/6},
+		{"san jose", "san josé", 1 - 1.0/8},
+	}
+
+	for _, tt := range tests {
+		if got := similarity(tt.a, tt.b); got != tt.want {
+			t.Errorf("similarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+// Filename : internal/i18n/i18n.go
+
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLanguage is the last entry of every fallback chain
+const DefaultLanguage = "en"
+
+//go:embed locales/*.json
+var localeFS embed.FS
+
+// Catalog holds the translated message templates keyed by language and message key.
+// Templates use {name} placeholders filled from the params of the message
+type Catalog struct {
+	messages map[string]map[string]string
+}
+
+// Load() reads every translation file from the embedded locales directory.
+// The file name without its extension is the language tag, e.g. es.json or es-bz.json
+func Load() (*Catalog, error) {
+	entries, err := localeFS.ReadDir("locales")
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Catalog{messages: make(map[string]map[string]string)}
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		contents, err := localeFS.ReadFile(path.Join("locales", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(contents, &messages); err != nil {
+			return nil, fmt.Errorf("i18n: %s: %w", entry.Name(), err)
+		}
+		lang := strings.ToLower(strings.TrimSuffix(entry.Name(), ".json"))
+		c.messages[lang] = messages
+	}
+
+	if _, ok := c.messages[DefaultLanguage]; !ok {
+		return nil, fmt.Errorf("i18n: missing %s translations", DefaultLanguage)
+	}
+	return c, nil
+}
+
+// Languages() returns the languages that have a translation file
+func (c *Catalog) Languages() []string {
+	languages := make([]string, 0, len(c.messages))
+	for lang := range c.messages {
+		languages = append(languages, lang)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// parentTags() lists a tag and its parents, most specific first, e.g. es-bz, es
+func parentTags(tag string) []string {
+	tag = strings.ToLower(strings.ReplaceAll(tag, "_", "-"))
+	var tags []string
+	for tag != "" {
+		tags = append(tags, tag)
+		i := strings.LastIndex(tag, "-")
+		if i < 0 {
+			break
+		}
+		tag = tag[:i]
+	}
+	return tags
+}
+
+// fallbackChain() lists the languages tried when translating, ending with the default
+func fallbackChain(lang string) []string {
+	chain := parentTags(lang)
+	if len(chain) == 0 || chain[len(chain)-1] != DefaultLanguage {
+		chain = append(chain, DefaultLanguage)
+	}
+	return chain
+}
+
+// Negotiate() picks the best supported language from an Accept-Language header,
+// falling back to the default language when nothing matches
+func (c *Catalog) Negotiate(acceptLanguage string) string {
+	type candidate struct {
+		tag     string
+		quality float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		params := strings.Split(part, ";")
+		tag := strings.TrimSpace(params[0])
+		if tag == "" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range params[1:] {
+			key, value, found := strings.Cut(strings.TrimSpace(param), "=")
+			if found && strings.TrimSpace(key) == "q" {
+				q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+				if err != nil {
+					q = 0
+				}
+				quality = q
+			}
+		}
+		if quality > 0 {
+			candidates = append(candidates, candidate{tag, quality})
+		}
+	}
+	// keep the header order for entries with the same quality
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].quality > candidates[j].quality
+	})
+
+	for _, cand := range candidates {
+		if cand.tag == "*" {
+			return DefaultLanguage
+		}
+		// try the tag and its parents before moving on to the next entry
+		for _, lang := range parentTags(cand.tag) {
+			if _, ok := c.messages[lang]; ok {
+				return lang
+			}
+		}
+	}
+	return DefaultLanguage
+}
+
+// Translate() renders the message for key in lang, walking the fallback chain.
+// The second return value is false when no language defines the key
+func (c *Catalog) Translate(lang, key string, params map[string]interface{}) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	for _, l := range fallbackChain(lang) {
+		if template, ok := c.messages[l][key]; ok {
+			return interpolate(template, params), true
+		}
+	}
+	return "", false
+}
+
+// interpolate() replaces {name} placeholders with the matching param
+func interpolate(template string, params map[string]interface{}) string {
+	if len(params) == 0 {
+		return template
+	}
+	pairs := make([]string, 0, len(params)*2)
+	for name, value := range params {
+		pairs = append(pairs, "{"+name+"}", formatParam(value))
+	}
+	return strings.NewReplacer(pairs...).Replace(template)
+}
+
+// formatParam() renders a param value, lists are joined with commas
+func formatParam(value interface{}) string {
+	switch v := value.(type) {
+	case []string:
+		return strings.Join(v, ", ")
+	case []int64:
+		parts := make([]string, len(v))
+		for i, n := range v {
+			parts[i] = strconv.FormatInt(n, 10)
+		}
+		return strings.Join(parts, ", ")
+	default:
+		return fmt.Sprint(v)
+	}
+}
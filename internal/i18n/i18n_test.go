@@ -0,0 +1,78 @@
+// Filename : internal/i18n/i18n_test.go
+
+package i18n
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// placeholderRX matches the {name} placeholders of a template
+var placeholderRX = regexp.MustCompile(`\{[a-z_]+\}`)
+
+func placeholders(template string) string {
+	found := placeholderRX.FindAllString(template, -1)
+	sort.Strings(found)
+	return strings.Join(found, " ")
+}
+
+// every language translates every message with the same placeholders
+func TestCatalogIsComplete(t *testing.T) {
+	c, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	english := c.messages[DefaultLanguage]
+
+	for _, lang := range c.Languages() {
+		messages := c.messages[lang]
+		for key, template := range english {
+			translated, ok := messages[key]
+			if !ok {
+				t.Errorf("%s: missing %q", lang, key)
+				continue
+			}
+			if placeholders(translated) != placeholders(template) {
+				t.Errorf("%s: %q has placeholders %q, want %q", lang, key, placeholders(translated), placeholders(template))
+			}
+		}
+		for key := range messages {
+			if _, ok := english[key]; !ok {
+				t.Errorf("%s: %q is not an English message", lang, key)
+			}
+		}
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	c, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		lang   string
+		key    string
+		params map[string]interface{}
+		want   string
+		ok     bool
+	}{
+		{"en", "validation.max_length", map[string]interface{}{"max": 500}, "must not be more than 500 characters", true},
+		{"es", "validation.max_length", map[string]interface{}{"max": 500}, "no debe tener más de 500 caracteres", true},
+		// regional variants fall back to their language, then to English
+		{"es-bz", "validation.required", nil, "es obligatorio", true},
+		{"fr", "validation.required", nil, "must be provided", true},
+		{"en", "validation.one_of", map[string]interface{}{"values": []string{"a", "b"}}, "must be one of a, b", true},
+		{"en", "validation.one_of", map[string]interface{}{"values": []int64{4, 7}}, "must be one of 4, 7", true},
+		{"en", "validation.no_such_rule", nil, "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := c.Translate(tt.lang, tt.key, tt.params)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Translate(%q, %q) = %q, %v, want %q, %v", tt.lang, tt.key, got, ok, tt.want, tt.ok)
+		}
+	}
+}
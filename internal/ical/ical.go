@@ -0,0 +1,109 @@
+// Filename : internal/ical/ical.go
+
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// lineLimit is the longest content line RFC 5545 allows, in octets
+const lineLimit = 75
+
+// Event is an all day event; End is the last day and inclusive
+type Event struct {
+	UID         string
+	Stamp       time.Time
+	Sequence    int
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Description string
+	Location    string
+	Categories  []string
+}
+
+// Calendar is an iCalendar document families can subscribe to
+type Calendar struct {
+	Name   string
+	Events []Event
+}
+
+// Write() encodes the calendar as text/calendar
+func (c *Calendar) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	line := func(name, value string) {
+		writeFolded(bw, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//appletree//schools//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	if c.Name != "" {
+		line("X-WR-CALNAME", escape(c.Name))
+	}
+	for _, event := range c.Events {
+		line("BEGIN", "VEVENT")
+		line("UID", event.UID)
+		line("DTSTAMP", event.Stamp.UTC().Format("20060102T150405Z"))
+		line("SEQUENCE", fmt.Sprint(event.Sequence))
+		line("DTSTART;VALUE=DATE", event.Start.Format("20060102"))
+		// the end of an all day event is exclusive
+		line("DTEND;VALUE=DATE", event.End.AddDate(0, 0, 1).Format("20060102"))
+		line("SUMMARY", escape(event.Summary))
+		if event.Description != "" {
+			line("DESCRIPTION", escape(event.Description))
+		}
+		if event.Location != "" {
+			line("LOCATION", escape(event.Location))
+		}
+		if len(event.Categories) > 0 {
+			categories := make([]string, len(event.Categories))
+			for i, category := range event.Categories {
+				categories[i] = escape(category)
+			}
+			line("CATEGORIES", strings.Join(categories, ","))
+		}
+		line("TRANSP", "TRANSPARENT")
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	return bw.Flush()
+}
+
+// escape() escapes the characters that are special in TEXT values
+func escape(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+		"\r", `\n`,
+	).Replace(s)
+}
+
+// writeFolded() writes a content line, folding it so no line is longer than
+// lineLimit octets. Folds never split a UTF-8 sequence
+func writeFolded(w *bufio.Writer, s string) {
+	limit := lineLimit
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		w.WriteString(s[:cut])
+		w.WriteString("\r\n ")
+		s = s[cut:]
+		// the leading space of a continuation counts towards its length
+		limit = lineLimit - 1
+	}
+	w.WriteString(s)
+	w.WriteString("\r\n")
+}
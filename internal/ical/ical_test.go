@@ -0,0 +1,171 @@
+// Filename : internal/ical/ical_test.go
+
+package ical
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// fold() runs writeFolded over s and returns what it wrote
+func fold(s string) string {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	writeFolded(w, s)
+	w.Flush()
+	return buf.String()
+}
+
+// unfold() joins continuation lines back as RFC 5545 section 3.1 describes
+func unfold(s string) string {
+	return strings.TrimSuffix(strings.ReplaceAll(s, "\r\n ", ""), "\r\n")
+}
+
+func TestWriteFolded(t *testing.T) {
+	tests := []struct {
+		name  string
+		line  string
+		lines int
+	}{
+		{"short", "SUMMARY:Sports day", 1},
+		{"exactly the limit", "SUMMARY:" + strings.Repeat("a", 67), 1},
+		{"one over the limit", "SUMMARY:" + strings.Repeat("a", 68), 2},
+		{"continuations hold 74 octets", "SUMMARY:" + strings.Repeat("a", 67+74), 2},
+		{"three lines", "SUMMARY:" + strings.Repeat("a", 67+74+1), 3},
+		// é is two octets and would straddle the 75th octet
+		{"two octet runes", "SUMMARY:" + strings.Repeat("a", 66) + strings.Repeat("é", 40), 3},
+		// ñ is two octets and starts at an odd offset
+		{"odd offset", "DESCRIPTION:Año escolar " + strings.Repeat("ñ", 60), 2},
+		{"three octet runes", "SUMMARY:" + strings.Repeat("学", 60), 3},
+		{"four octet runes", "SUMMARY:" + strings.Repeat("🎉", 50), 3},
+		{"mixed", "LOCATION:" + strings.Repeat("San José 🏫 学校, ", 12), 4},
+	}
+
+	for _, tt := range tests {
+		out := fold(tt.line)
+		if !strings.HasSuffix(out, "\r\n") {
+			t.Errorf("%s: output does not end in CRLF", tt.name)
+		}
+		lines := strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n")
+		if len(lines) != tt.lines {
+			t.Errorf("%s: got %d lines, want %d", tt.name, len(lines), tt.lines)
+		}
+		for i, line := range lines {
+			if len(line) > lineLimit {
+				t.Errorf("%s: line %d is %d octets long", tt.name, i+1, len(line))
+			}
+			if !utf8.ValidString(line) {
+				t.Errorf("%s: line %d splits a UTF-8 sequence: %q", tt.name, i+1, line)
+			}
+			if i > 0 && !strings.HasPrefix(line, " ") {
+				t.Errorf("%s: continuation line %d does not start with a space", tt.name, i+1)
+			}
+			if strings.ContainsAny(line, "\r\n") {
+				t.Errorf("%s: line %d holds a bare line break", tt.name, i+1)
+			}
+		}
+		if got := unfold(out); got != tt.line {
+			t.Errorf("%s: unfolding gives %q, want %q", tt.name, got, tt.line)
+		}
+	}
+}
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Sports day", "Sports day"},
+		{"Belize City, Belize", `Belize City\, Belize`},
+		{"break; lunch", `break\; lunch`},
+		{`C:\school`, `C:\\school`},
+		{"line one\nline two", `line one\nline two`},
+		{"line one\r\nline two", `line one\nline two`},
+		{"line one\rline two", `line one\nline two`},
+		{`a\,b`, `a\\\,b`},
+	}
+
+	for _, tt := range tests {
+		if got := escape(tt.in); got != tt.want {
+			t.Errorf("escape(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCalendarWrite(t *testing.T) {
+	stamp := time.Date(2024, 5, 2, 14, 30, 0, 0, time.FixedZone("CST", -6*60*60))
+	calendar := Calendar{
+		Name: "St. John's College, Belize",
+		Events: []Event{
+			{
+				UID:         "event-7@appletree",
+				Stamp:       stamp,
+				Sequence:    2,
+				Start:       time.Date(2024, 12, 20, 0, 0, 0, 0, time.UTC),
+				End:         time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC),
+				Summary:     "Christmas holidays",
+				Description: "School closes; classes resume\nin January",
+				Location:    "Belize City",
+				Categories:  []string{"holiday", "term, break"},
+			},
+			{
+				UID:     "event-8@appletree",
+				Stamp:   stamp,
+				Start:   time.Date(2024, 2, 28, 0, 0, 0, 0, time.UTC),
+				End:     time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+				Summary: "Día del niño " + strings.Repeat("🎈", 20),
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := calendar.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	if strings.Contains(strings.ReplaceAll(out, "\r\n", ""), "\n") {
+		t.Error("every line should end in CRLF")
+	}
+	for i, line := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+		if len(line) > lineLimit || !utf8.ValidString(line) {
+			t.Errorf("line %d is not a valid folded line: %q", i+1, line)
+		}
+	}
+
+	unfolded := unfold(out)
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\nVERSION:2.0\r\n",
+		`X-WR-CALNAME:St. John's College\, Belize`,
+		"DTSTAMP:20240502T203000Z",
+		"SEQUENCE:2",
+		"DTSTART;VALUE=DATE:20241220",
+		// the end is exclusive so the last day is included
+		"DTEND;VALUE=DATE:20250104",
+		`DESCRIPTION:School closes\; classes resume\nin January`,
+		"LOCATION:Belize City",
+		`CATEGORIES:holiday,term\, break`,
+		// February 2024 has 29 days
+		"DTEND;VALUE=DATE:20240301",
+		"SUMMARY:Día del niño " + strings.Repeat("🎈", 20),
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(unfolded+"\r\n", want) {
+			t.Errorf("calendar is missing %q", want)
+		}
+	}
+	if strings.Count(unfolded, "BEGIN:VEVENT") != 2 || strings.Count(unfolded, "END:VEVENT") != 2 {
+		t.Error("calendar should hold two events")
+	}
+	// the second event has neither description, location nor categories
+	second := unfolded[strings.LastIndex(unfolded, "BEGIN:VEVENT"):]
+	for _, property := range []string{"DESCRIPTION", "LOCATION", "CATEGORIES"} {
+		if strings.Contains(second, property+":") {
+			t.Errorf("empty %s should be left out", property)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+// Filename : internal/imaging/exif_test.go
+
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// tiffHeader() builds an EXIF TIFF header whose first IFD holds the entries,
+// each one a tag and a SHORT value
+func tiffHeader(order binary.ByteOrder, entries ...[2]uint16) []byte {
+	var buf bytes.Buffer
+	if order == binary.LittleEndian {
+		buf.WriteString("II")
+	} else {
+		buf.WriteString("MM")
+	}
+	binary.Write(&buf, order, uint16(42))
+	binary.Write(&buf, order, uint32(8))
+	binary.Write(&buf, order, uint16(len(entries)))
+	for _, entry := range entries {
+		binary.Write(&buf, order, entry[0])
+		binary.Write(&buf, order, uint16(3)) // SHORT
+		binary.Write(&buf, order, uint32(1))
+		binary.Write(&buf, order, entry[1])
+		binary.Write(&buf, order, uint16(0))
+	}
+	// no next IFD
+	binary.Write(&buf, order, uint32(0))
+	return buf.Bytes()
+}
+
+// segment() builds a JPEG marker segment, length counts itself but not the marker
+func segment(marker byte, payload []byte) []byte {
+	s := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(s[2:], uint16(len(payload)+2))
+	return append(s, payload...)
+}
+
+// exifSegment() builds an APP1 segment holding tiff
+func exifSegment(tiff []byte) []byte {
+	return segment(0xE1, append([]byte("Exif\x00\x00"), tiff...))
+}
+
+// withSegments() inserts segments right after the SOI marker of a JPEG
+func withSegments(jpg []byte, segments ...[]byte) []byte {
+	out := append([]byte{}, jpg[:2]...)
+	for _, s := range segments {
+		out = append(out, s...)
+	}
+	return append(out, jpg[2:]...)
+}
+
+// labelled() returns a w x h image whose pixels encode their own position
+func labelled(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x), G: uint8(y), A: 255})
+		}
+	}
+	return img
+}
+
+func encodeJPEG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, labelled(w, h), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	jpg := encodeJPEG(t, 4, 2)
+	le, be := binary.LittleEndian, binary.BigEndian
+	orientation := func(v uint16) [2]uint16 { return [2]uint16{0x0112, v} }
+
+	truncated := exifSegment(tiffHeader(le, orientation(6)))
+	truncated = truncated[:len(truncated)-10]
+
+	badOffset := tiffHeader(le, orientation(6))
+	binary.LittleEndian.PutUint32(badOffset[4:], 4000)
+
+	// the entries that are there hold no orientation
+	tooManyEntries := tiffHeader(be, [2]uint16{0x010F, 1})
+	binary.BigEndian.PutUint16(tooManyEntries[8:], 50)
+
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"no exif", jpg, 1},
+		{"little endian", withSegments(jpg, exifSegment(tiffHeader(le, orientation(6)))), 6},
+		{"big endian", withSegments(jpg, exifSegment(tiffHeader(be, orientation(8)))), 8},
+		{"after other tags", withSegments(jpg, exifSegment(tiffHeader(le, [2]uint16{0x010F, 1}, orientation(3)))), 3},
+		{"after an APP0 segment", withSegments(jpg, segment(0xE0, []byte("JFIF\x00\x01\x01")), exifSegment(tiffHeader(be, orientation(5)))), 5},
+		{"no orientation tag", withSegments(jpg, exifSegment(tiffHeader(le, [2]uint16{0x010F, 1}))), 1},
+		{"orientation zero", withSegments(jpg, exifSegment(tiffHeader(le, orientation(0)))), 1},
+		{"orientation out of range", withSegments(jpg, exifSegment(tiffHeader(le, orientation(9)))), 1},
+		{"APP1 that is not exif", withSegments(jpg, segment(0xE1, []byte("http://ns.adobe.com/xap/1.0/\x00"))), 1},
+		{"unknown byte order", withSegments(jpg, exifSegment(append([]byte("XX"), tiffHeader(le, orientation(6))[2:]...))), 1},
+		{"short tiff header", withSegments(jpg, exifSegment([]byte("II*\x00"))), 1},
+		{"IFD offset past the end", withSegments(jpg, exifSegment(badOffset)), 1},
+		{"entry count past the end", withSegments(jpg, exifSegment(tooManyEntries)), 1},
+		{"truncated APP1", append(jpg[:2:2], truncated...), 1},
+		{"segment length below 2", append([]byte{0xFF, 0xD8, 0xFF, 0xE1, 0x00, 0x01}, exifSegment(tiffHeader(le, orientation(6)))...), 1},
+		{"garbage instead of a marker", []byte{0xFF, 0xD8, 0x00, 0x00, 0x00, 0x00}, 1},
+		{"exif after the image data", append(append([]byte{0xFF, 0xD8}, segment(0xDA, []byte{0, 0})...), exifSegment(tiffHeader(le, orientation(6)))...), 1},
+		{"not a JPEG", []byte("\x89PNG\r\n\x1a\n"), 1},
+		{"empty", nil, 1},
+	}
+
+	for _, tt := range tests {
+		if got := jpegOrientation(tt.data); got != tt.want {
+			t.Errorf("%s: jpegOrientation() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// the source is 4 x 2, dst(0,0) and dst(1,0) name the source pixels they come from
+	tests := []struct {
+		orientation int
+		w, h        int
+		first       image.Point
+		second      image.Point
+	}{
+		{1, 4, 2, image.Pt(0, 0), image.Pt(1, 0)},
+		{2, 4, 2, image.Pt(3, 0), image.Pt(2, 0)},
+		{3, 4, 2, image.Pt(3, 1), image.Pt(2, 1)},
+		{4, 4, 2, image.Pt(0, 1), image.Pt(1, 1)},
+		{5, 2, 4, image.Pt(0, 0), image.Pt(0, 1)},
+		{6, 2, 4, image.Pt(0, 1), image.Pt(0, 0)},
+		{7, 2, 4, image.Pt(3, 1), image.Pt(3, 0)},
+		{8, 2, 4, image.Pt(3, 0), image.Pt(3, 1)},
+		// unknown orientations leave the image alone
+		{0, 4, 2, image.Pt(0, 0), image.Pt(1, 0)},
+		{9, 4, 2, image.Pt(0, 0), image.Pt(1, 0)},
+	}
+
+	for _, tt := range tests {
+		dst := orient(labelled(4, 2), tt.orientation)
+		if dst.Bounds().Dx() != tt.w || dst.Bounds().Dy() != tt.h {
+			t.Errorf("orientation %d: size = %v, want %dx%d", tt.orientation, dst.Bounds().Size(), tt.w, tt.h)
+			continue
+		}
+		for i, want := range []image.Point{tt.first, tt.second} {
+			c := dst.NRGBAAt(i, 0)
+			if got := image.Pt(int(c.R), int(c.G)); got != want {
+				t.Errorf("orientation %d: dst(%d,0) comes from %v, want %v", tt.orientation, i, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Filename : internal/imaging/imaging.go
+
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("imaging: unsupported image format")
+	ErrTooLarge          = errors.New("imaging: image dimensions too large")
+)
+
+// ContentTypes are the sniffed types Decode() accepts
+var ContentTypes = []string{"image/jpeg", "image/png", "image/gif"}
+
+// Image is a decoded upload. Decoding drops every piece of metadata, such as
+// EXIF, so only the pixels are ever stored again
+type Image struct {
+	*image.NRGBA
+	// Format is jpeg for photos and png for everything else, it keeps transparency
+	Format string
+}
+
+// Sniff() returns the content type of an upload judged by its first bytes
+func Sniff(data []byte) string {
+	return http.DetectContentType(data)
+}
+
+// Decode() decodes a JPEG, PNG or GIF no larger than maxDimension on either
+// side. The dimensions are checked before the pixels are decoded, so a small
+// file claiming a huge image is refused cheaply. JPEGs are turned upright
+// according to their EXIF orientation
+func Decode(data []byte, maxDimension int) (*Image, error) {
+	contentType := Sniff(data)
+	var decode func(io.Reader) (image.Image, error)
+	var decodeConfig func(io.Reader) (image.Config, error)
+	format := "png"
+	switch contentType {
+	case "image/jpeg":
+		decode, decodeConfig, format = jpeg.Decode, jpeg.DecodeConfig, "jpeg"
+	case "image/png":
+		decode, decodeConfig = png.Decode, png.DecodeConfig
+	case "image/gif":
+		// only the first frame of an animation is kept
+		decode, decodeConfig = gif.Decode, gif.DecodeConfig
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+
+	cfg, err := decodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+	if cfg.Width > maxDimension || cfg.Height > maxDimension {
+		return nil, ErrTooLarge
+	}
+
+	src, err := decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+	img := toNRGBA(src)
+	if format == "jpeg" {
+		img = orient(img, jpegOrientation(data))
+	}
+	return &Image{NRGBA: img, Format: format}, nil
+}
+
+// Encode() writes the image in its Format
+func (img *Image) Encode(w io.Writer) error {
+	if img.Format == "jpeg" {
+		return jpeg.Encode(w, img.NRGBA, &jpeg.Options{Quality: 85})
+	}
+	return png.Encode(w, img.NRGBA)
+}
+
+// Ext() is the file extension of the Format
+func (img *Image) Ext() string {
+	if img.Format == "jpeg" {
+		return "jpg"
+	}
+	return "png"
+}
+
+// Width() and Height() are the size in pixels
+func (img *Image) Width() int  { return img.Bounds().Dx() }
+func (img *Image) Height() int { return img.Bounds().Dy() }
+
+// Thumbnail() scales the image down to fit a size x size square, keeping
+// its aspect ratio. Images that already fit are returned unchanged
+func (img *Image) Thumbnail(size int) *Image {
+	w, h := img.Width(), img.Height()
+	if w <= size && h <= size {
+		return img
+	}
+	tw, th := size, size
+	if w > h {
+		th = atLeast(1, h*size/w)
+	} else {
+		tw = atLeast(1, w*size/h)
+	}
+	return &Image{NRGBA: resize(img.NRGBA, tw, th), Format: img.Format}
+}
+
+// toNRGBA() copies any image into an NRGBA one with its origin at 0,0
+func toNRGBA(src image.Image) *image.NRGBA {
+	b := src.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+	return dst
+}
+
+// resize() shrinks src to w x h, every destination pixel is the average of the
+// source pixels it covers weighted by their alpha
+func resize(src *image.NRGBA, w, h int) *image.NRGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, atLeast((y+1)*sh/h, y*sh/h+1)
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, atLeast((x+1)*sw/w, x*sw/w+1)
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				i := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					pa := uint64(src.Pix[i+3])
+					r += uint64(src.Pix[i]) * pa
+					g += uint64(src.Pix[i+1]) * pa
+					b += uint64(src.Pix[i+2]) * pa
+					a += pa
+					n++
+					i += 4
+				}
+			}
+			o := dst.PixOffset(x, y)
+			if a > 0 {
+				dst.Pix[o] = uint8(r / a)
+				dst.Pix[o+1] = uint8(g / a)
+				dst.Pix[o+2] = uint8(b / a)
+			}
+			dst.Pix[o+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// atLeast() returns the larger of a and b
+func atLeast(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
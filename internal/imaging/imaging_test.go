@@ -0,0 +1,145 @@
+// Filename : internal/imaging/imaging_test.go
+
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, labelled(w, h)); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// pngHeader() is a PNG that only has an IHDR chunk claiming w x h pixels
+func pngHeader(w, h uint32) []byte {
+	ihdr := make([]byte, 17)
+	copy(ihdr, "IHDR")
+	binary.BigEndian.PutUint32(ihdr[4:], w)
+	binary.BigEndian.PutUint32(ihdr[8:], h)
+	ihdr[12], ihdr[13] = 8, 6 // 8 bit RGBA
+	data := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0d")
+	data = append(data, ihdr...)
+	return binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(ihdr))
+}
+
+func TestDecode(t *testing.T) {
+	var gifData bytes.Buffer
+	palette := color.Palette{color.Black, color.White}
+	if err := gif.Encode(&gifData, image.NewPaletted(image.Rect(0, 0, 5, 3), palette), nil); err != nil {
+		t.Fatal(err)
+	}
+	jpg := encodeJPEG(t, 40, 20)
+	// turned 90 degrees clockwise
+	sideways := withSegments(jpg, exifSegment(tiffHeader(binary.BigEndian, [2]uint16{0x0112, 6})))
+
+	tests := []struct {
+		name    string
+		data    []byte
+		max     int
+		w, h    int
+		format  string
+		wantErr error
+	}{
+		{"png", encodePNG(t, 30, 10), 100, 30, 10, "png", nil},
+		{"png at the limit", encodePNG(t, 100, 10), 100, 100, 10, "png", nil},
+		{"jpeg", jpg, 100, 40, 20, "jpeg", nil},
+		{"jpeg turned upright", sideways, 100, 20, 40, "jpeg", nil},
+		{"gif keeps transparency as png", gifData.Bytes(), 100, 5, 3, "png", nil},
+		{"too wide", encodePNG(t, 101, 10), 100, 0, 0, "", ErrTooLarge},
+		{"too tall", encodePNG(t, 10, 101), 100, 0, 0, "", ErrTooLarge},
+		// refused from the header alone, the pixels are never allocated
+		{"huge claimed dimensions", pngHeader(1<<20, 1<<20), 4096, 0, 0, "", ErrTooLarge},
+		{"header without pixels", pngHeader(10, 10), 4096, 0, 0, "", ErrUnsupportedFormat},
+		{"truncated png", encodePNG(t, 30, 10)[:40], 100, 0, 0, "", ErrUnsupportedFormat},
+		{"text", []byte("hello, this is not an image"), 100, 0, 0, "", ErrUnsupportedFormat},
+		{"svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), 100, 0, 0, "", ErrUnsupportedFormat},
+		{"empty", nil, 100, 0, 0, "", ErrUnsupportedFormat},
+	}
+
+	for _, tt := range tests {
+		img, err := Decode(tt.data, tt.max)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("%s: error = %v, want %v", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if img.Width() != tt.w || img.Height() != tt.h || img.Format != tt.format {
+			t.Errorf("%s: got %dx%d %s, want %dx%d %s", tt.name, img.Width(), img.Height(), img.Format, tt.w, tt.h, tt.format)
+		}
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	tests := []struct {
+		w, h   int
+		size   int
+		tw, th int
+	}{
+		{800, 400, 320, 320, 160},
+		{400, 800, 320, 160, 320},
+		{500, 500, 96, 96, 96},
+		{1000, 300, 96, 96, 28},
+		{1000, 1, 96, 96, 1},
+		{1, 1000, 96, 1, 96},
+		// images that already fit are not enlarged
+		{300, 200, 320, 300, 200},
+		{320, 320, 320, 320, 320},
+	}
+
+	for _, tt := range tests {
+		img := &Image{NRGBA: image.NewNRGBA(image.Rect(0, 0, tt.w, tt.h)), Format: "png"}
+		thumb := img.Thumbnail(tt.size)
+		if thumb.Width() != tt.tw || thumb.Height() != tt.th {
+			t.Errorf("Thumbnail(%d) of %dx%d = %dx%d, want %dx%d", tt.size, tt.w, tt.h, thumb.Width(), thumb.Height(), tt.tw, tt.th)
+		}
+		if thumb.Format != img.Format {
+			t.Errorf("Thumbnail(%d) of %dx%d changed the format to %s", tt.size, tt.w, tt.h, thumb.Format)
+		}
+	}
+}
+
+func TestResizeWeighsByAlpha(t *testing.T) {
+	red := color.NRGBA{R: 255, A: 255}
+	transparent := color.NRGBA{B: 255, A: 0}
+	halfBlue := color.NRGBA{B: 255, A: 128}
+
+	tests := []struct {
+		name   string
+		pixels []color.NRGBA
+		want   color.NRGBA
+	}{
+		{"opaque pixels average", []color.NRGBA{red, {G: 255, A: 255}}, color.NRGBA{R: 127, G: 127, A: 255}},
+		// the colour of a transparent pixel does not bleed into the result
+		{"transparent pixels add no colour", []color.NRGBA{red, transparent}, color.NRGBA{R: 255, A: 127}},
+		{"partly transparent pixels add less", []color.NRGBA{red, halfBlue}, color.NRGBA{R: 169, B: 85, A: 191}},
+		{"fully transparent", []color.NRGBA{transparent, transparent}, color.NRGBA{}},
+	}
+
+	for _, tt := range tests {
+		src := image.NewNRGBA(image.Rect(0, 0, len(tt.pixels), 1))
+		for x, c := range tt.pixels {
+			src.SetNRGBA(x, 0, c)
+		}
+		if got := resize(src, 1, 1).NRGBAAt(0, 0); got != tt.want {
+			t.Errorf("%s: resize() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
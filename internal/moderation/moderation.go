@@ -0,0 +1,86 @@
+// Filename : internal/moderation/moderation.go
+
+package moderation
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// Filter screens text written by users before a moderator reads it
+type Filter interface {
+	// Check() returns the objectionable terms found in text, none when it is clean
+	Check(text string) []string
+}
+
+// Noop lets every text through, the default when no word list is set up
+type Noop struct{}
+
+// Check() never finds anything
+func (Noop) Check(text string) []string {
+	return nil
+}
+
+// WordList flags the words of a list, ignoring case and punctuation
+type WordList struct {
+	words map[string]bool
+}
+
+// NewWordList() builds a filter for the given words
+func NewWordList(words []string) *WordList {
+	list := &WordList{words: make(map[string]bool, len(words))}
+	for _, word := range words {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+			list.words[word] = true
+		}
+	}
+	return list
+}
+
+// LoadWordList() reads a word list with one word per line, blank lines and
+// lines starting with # are skipped
+func LoadWordList(path string) (*WordList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	words := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewWordList(words), nil
+}
+
+// Len() returns the number of words in the list
+func (l *WordList) Len() int {
+	return len(l.words)
+}
+
+// Check() returns the listed words of text once each, in the order they appear
+func (l *WordList) Check(text string) []string {
+	terms := []string{}
+	seen := make(map[string]bool)
+	split := func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	}
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), split) {
+		word = strings.Trim(word, "'")
+		if l.words[word] && !seen[word] {
+			seen[word] = true
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
@@ -0,0 +1,77 @@
+// Filename : internal/moderation/moderation_test.go
+
+package moderation
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWordListCheck(t *testing.T) {
+	list := NewWordList([]string{"darn", " Heck ", "DUMMY", "can't", "estúpido", "b4d", ""})
+
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"clean", "Great teachers and a lovely campus.", []string{}},
+		{"empty", "", []string{}},
+		{"lower case", "what the heck", []string{"heck"}},
+		{"any case", "What the HECK, Darn it", []string{"heck", "darn"}},
+		{"punctuation around words", "darn! (heck) ...dummy?", []string{"darn", "heck", "dummy"}},
+		{"punctuation inside words", "heck-darn/dummy", []string{"heck", "darn", "dummy"}},
+		{"words are not matched inside others", "darned heckler dummyish", []string{}},
+		// apostrophes belong to the word but quotes around it do not
+		{"apostrophe in a listed word", "I can't stand it", []string{"can't"}},
+		{"quoted word", "they said 'darn' and \"heck\"", []string{"darn", "heck"}},
+		{"apostrophe makes another word", "the darn's fault", []string{}},
+		{"duplicates are reported once", "darn darn DARN, darn!", []string{"darn"}},
+		{"order of first appearance", "dummy heck darn heck dummy", []string{"dummy", "heck", "darn"}},
+		{"accented letters", "¡Qué ESTÚPIDO!", []string{"estúpido"}},
+		{"digits", "b4d service", []string{"b4d"}},
+		{"line breaks", "fine\nheck\tdarn", []string{"heck", "darn"}},
+	}
+
+	for _, tt := range tests {
+		if got := list.Check(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Check(%q) = %q, want %q", tt.name, tt.text, got, tt.want)
+		}
+	}
+	// blank entries are not words
+	if list.Len() != 6 {
+		t.Errorf("Len() = %d, want 6", list.Len())
+	}
+}
+
+func TestLoadWordList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "words.txt")
+	contents := "# words flagged for the moderators\n\ndarn\n  Heck  \n#dummy\n"
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := LoadWordList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", list.Len())
+	}
+	if got := list.Check("heck, dummy, darn"); !reflect.DeepEqual(got, []string{"heck", "darn"}) {
+		t.Errorf("Check() = %q, want the words that are not commented out", got)
+	}
+
+	if _, err := LoadWordList(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("LoadWordList() of a missing file should fail")
+	}
+}
+
+func TestNoop(t *testing.T) {
+	var filter Filter = Noop{}
+	if got := filter.Check("darn heck"); len(got) != 0 {
+		t.Errorf("Noop.Check() = %q, want nothing", got)
+	}
+}
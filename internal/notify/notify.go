@@ -0,0 +1,44 @@
+// Filename : internal/notify/notify.go
+
+package notify
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+)
+
+// Message is a notification about a record, Fields carries the details a
+// channel may format as it likes
+type Message struct {
+	Kind    string
+	Subject string
+	Fields  map[string]string
+}
+
+// Notifier delivers messages to whoever has to act on them
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// Log writes messages to a logger, the default when no other channel is set up
+type Log struct {
+	Logger *log.Logger
+}
+
+// Notify() logs the message on a single line, fields in name order
+func (n Log) Notify(ctx context.Context, msg Message) error {
+	names := make([]string, 0, len(msg.Fields))
+	for name := range msg.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(" " + name + "=" + msg.Fields[name])
+	}
+	n.Logger.Printf("notify %s: %s%s", msg.Kind, msg.Subject, b.String())
+	return nil
+}
@@ -0,0 +1,119 @@
+// Filename : internal/scan/scan.go
+
+package scan
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// Result is the verdict on a file, Signature names what was found
+type Result struct {
+	Clean     bool
+	Signature string
+}
+
+// Scanner checks uploaded files for malware before they are served
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (Result, error)
+}
+
+// Noop passes every file, for deployments without a virus scanner
+type Noop struct{}
+
+// Scan() reports the file as clean
+func (Noop) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	return Result{Clean: true}, nil
+}
+
+// chunkSize is the largest chunk sent to clamd at a time
+const chunkSize = 64 << 10
+
+// ClamAV streams files to a clamd daemon with the INSTREAM command
+type ClamAV struct {
+	// Network is unix or tcp, Address the socket path or host:port
+	Network string
+	Address string
+	Timeout time.Duration
+}
+
+// NewClamAV() picks the network from the address, a path is a unix socket
+func NewClamAV(address string) *ClamAV {
+	network := "tcp"
+	if strings.HasPrefix(address, "/") {
+		network = "unix"
+	}
+	return &ClamAV{Network: network, Address: address, Timeout: time.Minute}
+}
+
+// Scan() sends the file to clamd and reads its verdict
+func (c *ClamAV) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	dialer := net.Dialer{Timeout: 5 * time.Second}
+	conn, err := dialer.DialContext(ctx, c.Network, c.Address)
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(c.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	w := bufio.NewWriter(conn)
+	// the z prefix makes clamd expect and send null terminated lines
+	if _, err := w.WriteString("zINSTREAM\x00"); err != nil {
+		return Result{}, err
+	}
+	buf := make([]byte, chunkSize)
+	size := make([]byte, 4)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			w.Write(size)
+			w.Write(buf[:n])
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return Result{}, err
+		}
+	}
+	// a zero length chunk ends the stream
+	binary.BigEndian.PutUint32(size, 0)
+	w.Write(size)
+	if err := w.Flush(); err != nil {
+		return Result{}, err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return Result{}, err
+	}
+	return parseReply(reply)
+}
+
+// parseReply() reads "stream: OK" or "stream: <signature> FOUND"
+func parseReply(reply string) (Result, error) {
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	reply = strings.TrimPrefix(reply, "stream:")
+	reply = strings.TrimSpace(reply)
+	switch {
+	case reply == "OK":
+		return Result{Clean: true}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return Result{Signature: strings.TrimSuffix(reply, " FOUND")}, nil
+	default:
+		return Result{}, fmt.Errorf("clamd: %s", reply)
+	}
+}
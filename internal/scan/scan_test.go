@@ -0,0 +1,246 @@
+// Filename : internal/scan/scan_test.go
+
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseReply(t *testing.T) {
+	tests := []struct {
+		reply   string
+		want    Result
+		wantErr bool
+	}{
+		{"stream: OK\x00", Result{Clean: true}, false},
+		{"stream: OK", Result{Clean: true}, false},
+		{"stream: OK\n", Result{Clean: true}, false},
+		{"OK\x00", Result{Clean: true}, false},
+		{"stream: Eicar-Test-Signature FOUND\x00", Result{Signature: "Eicar-Test-Signature"}, false},
+		{"stream: Win.Test.EICAR_HDB-1 FOUND\n", Result{Signature: "Win.Test.EICAR_HDB-1"}, false},
+		{"stream: INSTREAM size limit exceeded. ERROR\x00", Result{}, true},
+		{"UNKNOWN COMMAND\x00", Result{}, true},
+		{"stream: FOUND", Result{}, true},
+		{"", Result{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseReply(tt.reply)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseReply(%q) error = %v, want error %v", tt.reply, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseReply(%q) = %+v, want %+v", tt.reply, got, tt.want)
+		}
+	}
+}
+
+// fakeClamd answers INSTREAM commands on a unix socket like clamd does. It
+// reports any stream containing "EICAR" and keeps what it received
+type fakeClamd struct {
+	listener net.Listener
+	received chan []byte
+	// reply overrides the verdict when it is set
+	reply string
+}
+
+func newFakeClamd(t *testing.T, reply string) *fakeClamd {
+	t.Helper()
+	listener, err := net.Listen("unix", filepath.Join(t.TempDir(), "clamd.sock"))
+	if err != nil {
+		t.Skipf("unix sockets are not available: %v", err)
+	}
+	f := &fakeClamd{listener: listener, received: make(chan []byte, 1), reply: reply}
+	t.Cleanup(func() { listener.Close() })
+	go f.serve(t)
+	return f
+}
+
+func (f *fakeClamd) serve(t *testing.T) {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		f.handle(t, conn)
+	}
+}
+
+func (f *fakeClamd) handle(t *testing.T, conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	command, err := r.ReadString(0)
+	if err != nil || command != "zINSTREAM\x00" {
+		t.Errorf("clamd received command %q, %v", command, err)
+		conn.Write([]byte("UNKNOWN COMMAND\x00"))
+		return
+	}
+
+	var stream bytes.Buffer
+	size := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, size); err != nil {
+			t.Errorf("clamd reading chunk size: %v", err)
+			return
+		}
+		n := binary.BigEndian.Uint32(size)
+		if n == 0 {
+			break
+		}
+		if n > chunkSize {
+			t.Errorf("clamd received a chunk of %d bytes, the limit is %d", n, chunkSize)
+		}
+		if _, err := io.CopyN(&stream, r, int64(n)); err != nil {
+			t.Errorf("clamd reading chunk: %v", err)
+			return
+		}
+	}
+	f.received <- stream.Bytes()
+
+	reply := f.reply
+	if reply == "" {
+		reply = "stream: OK\x00"
+		if bytes.Contains(stream.Bytes(), []byte("EICAR")) {
+			reply = "stream: Eicar-Test-Signature FOUND\x00"
+		}
+	}
+	conn.Write([]byte(reply))
+}
+
+// failingReader returns an error after some data
+type failingReader struct{ sent bool }
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.sent {
+		return 0, errors.New("disk on fire")
+	}
+	r.sent = true
+	return copy(p, "some data"), nil
+}
+
+func TestClamAVScan(t *testing.T) {
+	large := bytes.Repeat([]byte("0123456789abcdef"), 10_000)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		reply   string
+		want    Result
+		wantErr bool
+	}{
+		{"clean", []byte("a harmless document"), "", Result{Clean: true}, false},
+		{"empty", nil, "", Result{Clean: true}, false},
+		// larger than a chunk so it is framed in several
+		{"several chunks", large, "", Result{Clean: true}, false},
+		{"infected", []byte("X5O!P%@AP[4\\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*"), "", Result{Signature: "Eicar-Test-Signature"}, false},
+		{"clamd error", []byte("too big"), "INSTREAM size limit exceeded. ERROR\x00", Result{}, true},
+		// a reply without the null terminator is still read once clamd hangs up
+		{"no terminator", []byte("a harmless document"), "stream: OK", Result{Clean: true}, false},
+	}
+
+	for _, tt := range tests {
+		clamd := newFakeClamd(t, tt.reply)
+		scanner := NewClamAV(clamd.listener.Addr().String())
+		if scanner.Network != "unix" {
+			t.Fatalf("NewClamAV(%q) network = %q, want unix", clamd.listener.Addr(), scanner.Network)
+		}
+
+		got, err := scanner.Scan(context.Background(), bytes.NewReader(tt.data))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: Scan() = %+v, want %+v", tt.name, got, tt.want)
+		}
+		select {
+		case received := <-clamd.received:
+			if !bytes.Equal(received, tt.data) {
+				t.Errorf("%s: clamd received %d bytes, want %d", tt.name, len(received), len(tt.data))
+			}
+		case <-time.After(time.Second):
+			t.Errorf("%s: clamd received no stream", tt.name)
+		}
+	}
+}
+
+// silentClamd() accepts connections and reads them without ever answering
+func silentClamd(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("unix", filepath.Join(t.TempDir(), "silent.sock"))
+	if err != nil {
+		t.Skipf("unix sockets are not available: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestClamAVScanErrors(t *testing.T) {
+	// nothing listens on the socket
+	scanner := NewClamAV(filepath.Join(t.TempDir(), "missing.sock"))
+	if _, err := scanner.Scan(context.Background(), strings.NewReader("data")); err == nil {
+		t.Error("Scan() without clamd should fail")
+	}
+
+	// the upload cannot be read
+	scanner = NewClamAV(silentClamd(t))
+	if _, err := scanner.Scan(context.Background(), &failingReader{}); err == nil || !strings.Contains(err.Error(), "disk on fire") {
+		t.Errorf("Scan() error = %v, want the read error", err)
+	}
+
+	// clamd never answers
+	scanner = NewClamAV(silentClamd(t))
+	scanner.Timeout = 100 * time.Millisecond
+	if _, err := scanner.Scan(context.Background(), strings.NewReader("data")); err == nil {
+		t.Error("Scan() should time out when clamd does not answer")
+	}
+
+	// the deadline of the context wins over a longer timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	scanner = NewClamAV(silentClamd(t))
+	started := time.Now()
+	if _, err := scanner.Scan(ctx, strings.NewReader("data")); err == nil || time.Since(started) > 5*time.Second {
+		t.Errorf("Scan() error = %v after %v, want a timeout from the context", err, time.Since(started))
+	}
+}
+
+func TestNewClamAV(t *testing.T) {
+	tests := []struct {
+		address string
+		network string
+	}{
+		{"/var/run/clamav/clamd.ctl", "unix"},
+		{"localhost:3310", "tcp"},
+		{"10.0.0.5:3310", "tcp"},
+	}
+
+	for _, tt := range tests {
+		if got := NewClamAV(tt.address).Network; got != tt.network {
+			t.Errorf("NewClamAV(%q) network = %q, want %q", tt.address, got, tt.network)
+		}
+	}
+}
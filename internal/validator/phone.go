@@ -0,0 +1,187 @@
+// Filename : internal/validator/phone.go
+
+package validator
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultPhoneRegion is used for numbers written without a country code
+const DefaultPhoneRegion = "BZ"
+
+var (
+	ErrPhoneEmpty         = errors.New("phone number is empty")
+	ErrPhoneInvalidChars  = errors.New("phone number contains invalid characters")
+	ErrPhoneUnknownRegion = errors.New("phone number has an unknown country code")
+	ErrPhoneInvalid       = errors.New("phone number is not valid for its country")
+)
+
+// PhoneRegion describes the numbering plan of a country
+type PhoneRegion struct {
+	Region      string         // ISO 3166-1 alpha-2 code
+	CountryCode string         // calling code without the leading +
+	TrunkPrefix string         // dialled before national numbers inside the country, if any
+	National    *regexp.Regexp // valid national significant numbers
+	Groups      []int          // digit groups used for the display format
+}
+
+// phoneRegions holds the numbering metadata, Belize first as it is our home region
+var phoneRegions = []PhoneRegion{
+	{Region: "BZ", CountryCode: "501", National: regexp.MustCompile(`^[2-8][0-9]{6}$`), Groups: []int{3, 4}},
+	{Region: "GT", CountryCode: "502", National: regexp.MustCompile(`^[2-7][0-9]{7}$`), Groups: []int{4, 4}},
+	{Region: "SV", CountryCode: "503", National: regexp.MustCompile(`^[267][0-9]{7}$`), Groups: []int{4, 4}},
+	{Region: "HN", CountryCode: "504", National: regexp.MustCompile(`^[2389][0-9]{7}$`), Groups: []int{4, 4}},
+	{Region: "MX", CountryCode: "52", National: regexp.MustCompile(`^[1-9][0-9]{9}$`), Groups: []int{2, 4, 4}},
+	{Region: "US", CountryCode: "1", TrunkPrefix: "1", National: regexp.MustCompile(`^[2-9][0-9]{2}[2-9][0-9]{6}$`), Groups: []int{3, 3, 4}},
+}
+
+// PhoneNumber is a parsed phone number
+type PhoneNumber struct {
+	Region      string
+	CountryCode string
+	National    string
+}
+
+// E164() returns the canonical +<country code><national number> form
+func (p PhoneNumber) E164() string {
+	return "+" + p.CountryCode + p.National
+}
+
+// Display() returns the international form grouped for reading, e.g. +501 607-1123
+func (p PhoneNumber) Display() string {
+	region, ok := lookupPhoneRegion(p.Region)
+	if !ok {
+		return p.E164()
+	}
+	groups := make([]string, 0, len(region.Groups))
+	rest := p.National
+	for i, n := range region.Groups {
+		if i == len(region.Groups)-1 || n >= len(rest) {
+			groups = append(groups, rest)
+			rest = ""
+			break
+		}
+		groups = append(groups, rest[:n])
+		rest = rest[n:]
+	}
+	return "+" + p.CountryCode + " " + strings.Join(groups, "-")
+}
+
+func lookupPhoneRegion(code string) (PhoneRegion, bool) {
+	for _, region := range phoneRegions {
+		if region.Region == code {
+			return region, true
+		}
+	}
+	return PhoneRegion{}, false
+}
+
+// regionsByCountryCode() returns the regions sharing a calling code
+func regionsByCountryCode(cc string) []PhoneRegion {
+	var regions []PhoneRegion
+	for _, region := range phoneRegions {
+		if region.CountryCode == cc {
+			regions = append(regions, region)
+		}
+	}
+	return regions
+}
+
+// PhoneDigits() strips formatting characters, keeping a leading + if present
+func PhoneDigits(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", ErrPhoneEmpty
+	}
+	var b strings.Builder
+	for i, r := range raw {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '+' && i == 0:
+			b.WriteRune(r)
+		case strings.ContainsRune(" -.()/", r):
+		default:
+			return "", ErrPhoneInvalidChars
+		}
+	}
+	if b.Len() == 0 || b.String() == "+" {
+		return "", ErrPhoneEmpty
+	}
+	return b.String(), nil
+}
+
+// ParsePhone() parses a number written in international form (+501 …, 00501 …)
+// or in the national form of defaultRegion, and checks it against the numbering metadata
+func ParsePhone(raw, defaultRegion string) (PhoneNumber, error) {
+	digits, err := PhoneDigits(raw)
+	if err != nil {
+		return PhoneNumber{}, err
+	}
+
+	switch {
+	case strings.HasPrefix(digits, "+"):
+		return parseInternational(digits[1:])
+	case strings.HasPrefix(digits, "00"):
+		return parseInternational(digits[2:])
+	}
+
+	region, ok := lookupPhoneRegion(defaultRegion)
+	if !ok {
+		return PhoneNumber{}, ErrPhoneUnknownRegion
+	}
+	if region.National.MatchString(digits) {
+		return PhoneNumber{Region: region.Region, CountryCode: region.CountryCode, National: digits}, nil
+	}
+	// national numbers dialled with the trunk prefix
+	if region.TrunkPrefix != "" && strings.HasPrefix(digits, region.TrunkPrefix) {
+		national := strings.TrimPrefix(digits, region.TrunkPrefix)
+		if region.National.MatchString(national) {
+			return PhoneNumber{Region: region.Region, CountryCode: region.CountryCode, National: national}, nil
+		}
+	}
+	// the country code written without the +, e.g. 501-607-1123
+	if strings.HasPrefix(digits, region.CountryCode) {
+		if number, err := parseInternational(digits); err == nil {
+			return number, nil
+		}
+	}
+	return PhoneNumber{}, ErrPhoneInvalid
+}
+
+// parseInternational() splits digits that start with a calling code
+func parseInternational(digits string) (PhoneNumber, error) {
+	// calling codes are prefix-free, try the longest first
+	var codes []string
+	seen := map[string]bool{}
+	for _, region := range phoneRegions {
+		if !seen[region.CountryCode] {
+			seen[region.CountryCode] = true
+			codes = append(codes, region.CountryCode)
+		}
+	}
+	sort.Slice(codes, func(i, j int) bool { return len(codes[i]) > len(codes[j]) })
+
+	for _, cc := range codes {
+		if !strings.HasPrefix(digits, cc) {
+			continue
+		}
+		national := strings.TrimPrefix(digits, cc)
+		for _, region := range regionsByCountryCode(cc) {
+			if region.National.MatchString(national) {
+				return PhoneNumber{Region: region.Region, CountryCode: cc, National: national}, nil
+			}
+		}
+		return PhoneNumber{}, ErrPhoneInvalid
+	}
+	return PhoneNumber{}, ErrPhoneUnknownRegion
+}
+
+// ValidPhone() reports whether the number parses for the given default region
+func ValidPhone(raw, defaultRegion string) bool {
+	_, err := ParsePhone(raw, defaultRegion)
+	return err == nil
+}
@@ -0,0 +1,78 @@
+// Filename : internal/validator/phone_test.go
+
+package validator
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParsePhone(t *testing.T) {
+	tests := []struct {
+		raw     string
+		region  string
+		e164    string
+		display string
+		wantErr error
+	}{
+		{"607-1123", "BZ", "+5016071123", "+501 607-1123", nil},
+		{"(501) 607 1123", "BZ", "+5016071123", "+501 607-1123", nil},
+		{"501-607-1123", "BZ", "+5016071123", "+501 607-1123", nil},
+		{"+501 223.4567", "US", "+5012234567", "+501 223-4567", nil},
+		{"00501 223 4567", "BZ", "+5012234567", "+501 223-4567", nil},
+		{"2234-5678", "GT", "+50222345678", "+502 2234-5678", nil},
+		{"+503 7123 4567", "BZ", "+50371234567", "+503 7123-4567", nil},
+		{"+504 9123-4567", "BZ", "+50491234567", "+504 9123-4567", nil},
+		{"55 1234 5678", "MX", "+525512345678", "+52 55-1234-5678", nil},
+		{"(212) 555-0123", "US", "+12125550123", "+1 212-555-0123", nil},
+		{"1 212 555 0123", "US", "+12125550123", "+1 212-555-0123", nil},
+		{"+1 212 555 0123", "BZ", "+12125550123", "+1 212-555-0123", nil},
+		{"", "BZ", "", "", ErrPhoneEmpty},
+		{"+", "BZ", "", "", ErrPhoneEmpty},
+		{"607-11a3", "BZ", "", "", ErrPhoneInvalidChars},
+		{"6+071123", "BZ", "", "", ErrPhoneInvalidChars},
+		{"107-1123", "BZ", "", "", ErrPhoneInvalid},
+		{"607-11234", "BZ", "", "", ErrPhoneInvalid},
+		{"+501 107 1123", "BZ", "", "", ErrPhoneInvalid},
+		{"+999 123 4567", "BZ", "", "", ErrPhoneUnknownRegion},
+		{"607-1123", "XX", "", "", ErrPhoneUnknownRegion},
+		{"(112) 555-0123", "US", "", "", ErrPhoneInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.region+" "+tt.raw, func(t *testing.T) {
+			phone, err := ParsePhone(tt.raw, tt.region)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ParsePhone() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParsePhone() error = %v", err)
+			}
+			if got := phone.E164(); got != tt.e164 {
+				t.Errorf("E164() = %q, want %q", got, tt.e164)
+			}
+			if got := phone.Display(); got != tt.display {
+				t.Errorf("Display() = %q, want %q", got, tt.display)
+			}
+		})
+	}
+}
+
+func TestPhoneDigits(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{" +501 (607) 11-23 ", "+5016071123"},
+		{"607.1123", "6071123"},
+		{"607/1123", "6071123"},
+	}
+	for _, tt := range tests {
+		got, err := PhoneDigits(tt.raw)
+		if err != nil || got != tt.want {
+			t.Errorf("PhoneDigits(%q) = %q, %v, want %q", tt.raw, got, err, tt.want)
+		}
+	}
+}
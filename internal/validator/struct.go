@@ -0,0 +1,472 @@
+// Filename : internal/validator/struct.go
+
+package validator
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// FieldLevel gives a rule access to the field being validated, its
+// parameter and the struct holding it for cross-field checks
+type FieldLevel struct {
+	Value  reflect.Value
+	Parent reflect.Value
+	Param  string
+}
+
+// Sibling() returns another field of the parent struct by its Go name
+func (fl FieldLevel) Sibling(name string) reflect.Value {
+	if !fl.Parent.IsValid() {
+		return reflect.Value{}
+	}
+	return fl.Parent.FieldByName(name)
+}
+
+// Rule checks a single field. It returns nil when the value is acceptable,
+// otherwise a FieldError describing the failure; the field path is filled in by the engine
+type Rule func(fl FieldLevel) *FieldError
+
+// Failed() builds the FieldError a rule returns
+func Failed(code string, params Params, message string) *FieldError {
+	return &FieldError{Code: code, Params: params, Message: message}
+}
+
+var (
+	rulesMu sync.RWMutex
+	rules   = map[string]Rule{}
+
+	// compiled rule sets keyed by struct type
+	typeCache sync.Map
+	compileMu sync.Mutex
+)
+
+// RegisterRule() makes a rule available to validate tags under the given name.
+// Rules should be registered at start up, before any struct is validated
+func RegisterRule(name string, rule Rule) {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+	rules[name] = rule
+	// drop compiled rule sets so they pick up the new definition
+	typeCache.Range(func(key, _ interface{}) bool {
+		typeCache.Delete(key)
+		return true
+	})
+}
+
+func lookupRule(name string) (Rule, bool) {
+	rulesMu.RLock()
+	defer rulesMu.RUnlock()
+	rule, ok := rules[name]
+	return rule, ok
+}
+
+// boundRule is a rule together with the parameter written in the tag
+type boundRule struct {
+	name  string
+	param string
+	rule  Rule
+}
+
+// fieldRules holds the compiled tag of a single struct field
+type fieldRules struct {
+	index      int
+	name       string
+	omitEmpty  bool
+	rules      []boundRule
+	dive       bool
+	elemOmit   bool
+	elemRules  []boundRule
+	nested     *structRules
+	elemNested *structRules
+}
+
+// structRules holds the compiled tags of a struct type
+type structRules struct {
+	fields []fieldRules
+}
+
+// Struct() validates a struct, or a pointer to one, using its validate tags.
+// Every failed rule is recorded, so a field may report several failures
+func (v *Validator) Struct(s interface{}) {
+	value := reflect.ValueOf(s)
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validator: Struct() called with %s", value.Kind()))
+	}
+	v.validateStruct(value, compile(value.Type()), "")
+}
+
+func (v *Validator) validateStruct(value reflect.Value, sr *structRules, prefix string) {
+	for _, f := range sr.fields {
+		field := value.Field(f.index)
+		path := f.name
+		if prefix != "" {
+			path = Path(prefix, f.name)
+		}
+		v.validateValue(field, value, path, f.omitEmpty, f.rules, f.nested)
+
+		if f.dive && (field.Kind() == reflect.Slice || field.Kind() == reflect.Array) {
+			for i := 0; i < field.Len(); i++ {
+				v.validateValue(field.Index(i), value, Index(path, i), f.elemOmit, f.elemRules, f.elemNested)
+			}
+		}
+	}
+}
+
+func (v *Validator) validateValue(field, parent reflect.Value, path string, omitEmpty bool, bound []boundRule, nested *structRules) {
+	if omitEmpty && field.IsZero() {
+		return
+	}
+	for _, br := range bound {
+		failure := br.rule(FieldLevel{Value: field, Parent: parent, Param: br.param})
+		if failure != nil {
+			v.AddFailure(path, failure.Code, failure.Params, failure.Message)
+		}
+	}
+	if nested != nil {
+		for field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				return
+			}
+			field = field.Elem()
+		}
+		v.validateStruct(field, nested, path)
+	}
+}
+
+// compile() parses the validate tags of a struct type once and caches the result
+func compile(t reflect.Type) *structRules {
+	if cached, ok := typeCache.Load(t); ok {
+		return cached.(*structRules)
+	}
+	compileMu.Lock()
+	defer compileMu.Unlock()
+	return compileLocked(t, map[reflect.Type]*structRules{})
+}
+
+// compileLocked() does the work for compile(). The in-progress map lets
+// self-referencing types point at the rule set that is still being built
+func compileLocked(t reflect.Type, inProgress map[reflect.Type]*structRules) *structRules {
+	if cached, ok := typeCache.Load(t); ok {
+		return cached.(*structRules)
+	}
+	if sr, ok := inProgress[t]; ok {
+		return sr
+	}
+
+	sr := &structRules{}
+	inProgress[t] = sr
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		tag := sf.Tag.Get("validate")
+		if tag == "-" {
+			continue
+		}
+
+		f := fieldRules{index: i, name: fieldName(sf)}
+		f.nested = nestedRules(sf.Type, inProgress)
+
+		// rules after "dive" apply to each element of a slice
+		target := &f.rules
+		omit := &f.omitEmpty
+		for _, part := range splitTag(tag) {
+			name, param, _ := strings.Cut(part, "=")
+			switch name {
+			case "omitempty":
+				*omit = true
+			case "dive":
+				f.dive = true
+				target = &f.elemRules
+				omit = &f.elemOmit
+				if sf.Type.Kind() == reflect.Slice || sf.Type.Kind() == reflect.Array {
+					f.elemNested = nestedRules(sf.Type.Elem(), inProgress)
+				}
+			default:
+				rule, ok := lookupRule(name)
+				if !ok {
+					panic(fmt.Sprintf("validator: unknown rule %q on %s.%s", name, t.Name(), sf.Name))
+				}
+				*target = append(*target, boundRule{name: name, param: param, rule: rule})
+			}
+		}
+
+		if len(f.rules) > 0 || f.dive || f.nested != nil {
+			sr.fields = append(sr.fields, f)
+		}
+	}
+
+	delete(inProgress, t)
+	typeCache.Store(t, sr)
+	return sr
+}
+
+// nestedRules() returns the compiled rules of a nested struct type, if it has any
+func nestedRules(t reflect.Type, inProgress map[reflect.Type]*structRules) *structRules {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == reflect.TypeOf(time.Time{}) {
+		return nil
+	}
+	sr := compileLocked(t, inProgress)
+	if _, building := inProgress[t]; !building && len(sr.fields) == 0 {
+		return nil
+	}
+	return sr
+}
+
+// splitTag() splits a validate tag on commas, ignoring empty entries
+func splitTag(tag string) []string {
+	var parts []string
+	for _, part := range strings.Split(tag, ",") {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// fieldName() reports the field under its JSON name so errors match the request body
+func fieldName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return sf.Name
+	}
+	return name
+}
+
+// size() returns the length of strings and collections and the value of numbers
+func size(v reflect.Value) (float64, reflect.Kind, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), reflect.String, true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), reflect.Slice, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), reflect.Int, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), reflect.Int, true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), reflect.Int, true
+	case reflect.Ptr:
+		if v.IsNil() {
+			return 0, reflect.Invalid, false
+		}
+		return size(v.Elem())
+	}
+	return 0, reflect.Invalid, false
+}
+
+// compare() orders two values of the same kind, used by the cross-field rules
+func compare(a, b reflect.Value) (int, bool) {
+	for a.Kind() == reflect.Ptr {
+		if a.IsNil() {
+			return 0, false
+		}
+		a = a.Elem()
+	}
+	for b.Kind() == reflect.Ptr {
+		if b.IsNil() {
+			return 0, false
+		}
+		b = b.Elem()
+	}
+	if a.Type() == reflect.TypeOf(time.Time{}) && b.Type() == reflect.TypeOf(time.Time{}) {
+		ta, tb := a.Interface().(time.Time), b.Interface().(time.Time)
+		switch {
+		case ta.Before(tb):
+			return -1, true
+		case ta.After(tb):
+			return 1, true
+		}
+		return 0, true
+	}
+	if a.Kind() == reflect.String && b.Kind() == reflect.String {
+		return strings.Compare(a.String(), b.String()), true
+	}
+	x, kx, okx := size(a)
+	y, ky, oky := size(b)
+	if !okx || !oky || kx != ky {
+		return 0, false
+	}
+	switch {
+	case x < y:
+		return -1, true
+	case x > y:
+		return 1, true
+	}
+	return 0, true
+}
+
+func mustParam(param string) float64 {
+	n, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		panic(fmt.Sprintf("validator: invalid numeric parameter %q", param))
+	}
+	return n
+}
+
+// paramNumber() keeps integral limits as ints so they render without a decimal point
+func paramNumber(n float64) interface{} {
+	if n == float64(int64(n)) {
+		return int64(n)
+	}
+	return n
+}
+
+func init() {
+	// built-in rules
+	RegisterRule("required", func(fl FieldLevel) *FieldError {
+		if fl.Value.IsZero() {
+			return Failed(CodeRequired, nil, "must be provided")
+		}
+		return nil
+	})
+
+	RegisterRule("max", func(fl FieldLevel) *FieldError {
+		limit := mustParam(fl.Param)
+		n, kind, ok := size(fl.Value)
+		if !ok || n <= limit {
+			return nil
+		}
+		params := Params{"max": paramNumber(limit)}
+		switch kind {
+		case reflect.String:
+			return Failed(CodeMaxLength, params, fmt.Sprintf("must not be more than %s characters", fl.Param))
+		case reflect.Slice:
+			return Failed(CodeMaxItems, params, fmt.Sprintf("must contain at most %s entries", fl.Param))
+		}
+		return Failed(CodeMax, params, fmt.Sprintf("must be maximum of %s", fl.Param))
+	})
+
+	RegisterRule("min", func(fl FieldLevel) *FieldError {
+		limit := mustParam(fl.Param)
+		n, kind, ok := size(fl.Value)
+		if !ok || n >= limit {
+			return nil
+		}
+		params := Params{"min": paramNumber(limit)}
+		switch kind {
+		case reflect.String:
+			return Failed(CodeMinLength, params, fmt.Sprintf("must be at least %s characters", fl.Param))
+		case reflect.Slice:
+			return Failed(CodeMinItems, params, fmt.Sprintf("must contain at least %s entries", fl.Param))
+		}
+		return Failed(CodeMin, params, fmt.Sprintf("must be at least %s", fl.Param))
+	})
+
+	RegisterRule("email", func(fl FieldLevel) *FieldError {
+		if fl.Value.Kind() == reflect.String && Matches(fl.Value.String(), EmailRX) {
+			return nil
+		}
+		return Failed(CodePattern, Params{"format": "email"}, "must be a valid email")
+	})
+
+	// phone=US parses national numbers for another region than the default
+	RegisterRule("phone", func(fl FieldLevel) *FieldError {
+		region := fl.Param
+		if region == "" {
+			region = DefaultPhoneRegion
+		}
+		if fl.Value.Kind() == reflect.String && ValidPhone(fl.Value.String(), region) {
+			return nil
+		}
+		return Failed(CodePattern, Params{"format": "phone"}, "must be a valid phone number")
+	})
+
+	RegisterRule("website", func(fl FieldLevel) *FieldError {
+		if fl.Value.Kind() == reflect.String && ValidWebsite(fl.Value.String()) {
+			return nil
+		}
+		return Failed(CodePattern, Params{"format": "website"}, "must be a valid website")
+	})
+
+	RegisterRule("unique", func(fl FieldLevel) *FieldError {
+		if fl.Value.Kind() != reflect.Slice {
+			return nil
+		}
+		// elements that cannot be map keys, such as slices, are compared by
+		// their Go syntax representation instead
+		elem := fl.Value.Type().Elem()
+		hashable := elem.Comparable() && elem.Kind() != reflect.Interface
+		seen := make(map[interface{}]bool, fl.Value.Len())
+		for i := 0; i < fl.Value.Len(); i++ {
+			item := fl.Value.Index(i).Interface()
+			if !hashable {
+				item = fmt.Sprintf("%#v", item)
+			}
+			if seen[item] {
+				return Failed(CodeUnique, nil, "must not contain duplicates")
+			}
+			seen[item] = true
+		}
+		return nil
+	})
+
+	// oneof=a b c limits the value to a space-separated list
+	RegisterRule("oneof", func(fl FieldLevel) *FieldError {
+		values := strings.Fields(fl.Param)
+		if In(fmt.Sprint(fl.Value.Interface()), values...) {
+			return nil
+		}
+		return Failed(CodeOneOf, Params{"values": values}, "must be one of "+strings.Join(values, ", "))
+	})
+
+	// conditional rules: required_if=Field value, required_with=Field
+	RegisterRule("required_if", func(fl FieldLevel) *FieldError {
+		name, want, _ := strings.Cut(fl.Param, " ")
+		sibling := fl.Sibling(name)
+		if !sibling.IsValid() || fmt.Sprint(reflect.Indirect(sibling).Interface()) != want {
+			return nil
+		}
+		if fl.Value.IsZero() {
+			return Failed(CodeRequired, Params{"field": name, "value": want}, "must be provided")
+		}
+		return nil
+	})
+
+	RegisterRule("required_with", func(fl FieldLevel) *FieldError {
+		sibling := fl.Sibling(fl.Param)
+		if !sibling.IsValid() || sibling.IsZero() {
+			return nil
+		}
+		if fl.Value.IsZero() {
+			return Failed(CodeRequired, Params{"field": fl.Param}, "must be provided")
+		}
+		return nil
+	})
+
+	// cross-field rules comparing against another field of the same struct
+	crossField := func(name, code, message string, ok func(c int) bool) {
+		RegisterRule(name, func(fl FieldLevel) *FieldError {
+			sibling := fl.Sibling(fl.Param)
+			if !sibling.IsValid() {
+				panic(fmt.Sprintf("validator: %s refers to unknown field %q", name, fl.Param))
+			}
+			c, comparable := compare(fl.Value, sibling)
+			if !comparable || ok(c) {
+				return nil
+			}
+			return Failed(code, Params{"field": fl.Param}, fmt.Sprintf(message, fl.Param))
+		})
+	}
+	crossField("eqfield", CodeEqField, "must be equal to %s", func(c int) bool { return c == 0 })
+	crossField("nefield", CodeNeField, "must not be equal to %s", func(c int) bool { return c != 0 })
+	crossField("ltefield", CodeLteField, "must not be greater than %s", func(c int) bool { return c <= 0 })
+	crossField("gtefield", CodeGteField, "must not be less than %s", func(c int) bool { return c >= 0 })
+}
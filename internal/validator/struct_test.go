@@ -0,0 +1,155 @@
+// Filename : internal/validator/struct_test.go
+
+package validator
+
+import (
+	"reflect"
+	"testing"
+)
+
+// failures() returns the field and code of every failure, in order
+func failures(v *Validator) [][2]string {
+	got := [][2]string{}
+	for _, failure := range v.Failures {
+		got = append(got, [2]string{failure.Field, failure.Code})
+	}
+	return got
+}
+
+func TestStructRules(t *testing.T) {
+	type address struct {
+		Town string `json:"town" validate:"required,max=5"`
+	}
+	type item struct {
+		Name string `json:"name" validate:"required"`
+	}
+	type sample struct {
+		Name     string   `json:"name" validate:"required,max=5"`
+		Nick     string   `json:"nick" validate:"omitempty,min=3"`
+		Age      int      `json:"age" validate:"min=1,max=120"`
+		Email    string   `json:"email" validate:"omitempty,email"`
+		Phone    string   `json:"phone" validate:"omitempty,phone"`
+		Website  string   `json:"website" validate:"omitempty,website"`
+		Status   string   `json:"status" validate:"omitempty,oneof=open closed"`
+		Tags     []string `json:"tags" validate:"max=2,unique,dive,required,max=4"`
+		Kind     string   `json:"kind"`
+		Reason   string   `json:"reason" validate:"required_if=Kind other"`
+		Lat      *float64 `json:"lat" validate:"required_with=Lng"`
+		Lng      *float64 `json:"lng"`
+		Low      int      `json:"low"`
+		High     int      `json:"high" validate:"gtefield=Low"`
+		Address  address  `json:"address"`
+		Items    []item   `json:"items" validate:"dive"`
+		Internal string   `json:"-" validate:"required"`
+	}
+	valid := func() sample {
+		lat, lng := 17.25, -88.76
+		return sample{
+			Name: "Ann", Age: 30, Email: "ann@school.edu.bz", Phone: "223-4567",
+			Website: "https://school.edu.bz", Status: "open", Tags: []string{"a", "b"},
+			Lat: &lat, Lng: &lng, Low: 1, High: 2, Address: address{Town: "Punta"},
+			Items: []item{{Name: "x"}}, Internal: "set",
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func(s *sample)
+		want   [][2]string
+	}{
+		{"valid", func(s *sample) {}, [][2]string{}},
+		{"required", func(s *sample) { s.Name = "" }, [][2]string{{"name", CodeRequired}}},
+		{"max length", func(s *sample) { s.Name = "Annabel" }, [][2]string{{"name", CodeMaxLength}}},
+		{"min length counts runes", func(s *sample) { s.Nick = "ñá" }, [][2]string{{"nick", CodeMinLength}}},
+		{"omitempty skips zero", func(s *sample) { s.Nick, s.Email, s.Status = "", "", "" }, [][2]string{}},
+		{"min and max numbers", func(s *sample) { s.Age = 0 }, [][2]string{{"age", CodeMin}}},
+		{"max number", func(s *sample) { s.Age = 121 }, [][2]string{{"age", CodeMax}}},
+		{"email", func(s *sample) { s.Email = "ann@" }, [][2]string{{"email", CodePattern}}},
+		{"phone", func(s *sample) { s.Phone = "12" }, [][2]string{{"phone", CodePattern}}},
+		{"website", func(s *sample) { s.Website = "hello" }, [][2]string{{"website", CodePattern}}},
+		{"oneof", func(s *sample) { s.Status = "shut" }, [][2]string{{"status", CodeOneOf}}},
+		{"max items", func(s *sample) { s.Tags = []string{"a", "b", "c"} }, [][2]string{{"tags", CodeMaxItems}}},
+		{"unique", func(s *sample) { s.Tags = []string{"a", "a"} }, [][2]string{{"tags", CodeUnique}}},
+		{"dive", func(s *sample) { s.Tags = []string{"a", ""} }, [][2]string{{"tags[1]", CodeRequired}}},
+		{"dive max", func(s *sample) { s.Tags = []string{"abcde"} }, [][2]string{{"tags[0]", CodeMaxLength}}},
+		{"required_if met", func(s *sample) { s.Kind = "other" }, [][2]string{{"reason", CodeRequired}}},
+		{"required_if not met", func(s *sample) { s.Kind = "usual" }, [][2]string{}},
+		{"required_with", func(s *sample) { s.Lat = nil }, [][2]string{{"lat", CodeRequired}}},
+		{"gtefield", func(s *sample) { s.High = 0 }, [][2]string{{"high", CodeGteField}}},
+		{"nested struct", func(s *sample) { s.Address.Town = "" }, [][2]string{{"address.town", CodeRequired}}},
+		{"dive into structs", func(s *sample) { s.Items = []item{{Name: "x"}, {}} }, [][2]string{{"items[1].name", CodeRequired}}},
+		{"several failures", func(s *sample) { s.Name, s.Age = "", 0 }, [][2]string{{"name", CodeRequired}, {"age", CodeMin}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := valid()
+			tt.change(&s)
+			v := New()
+			v.Struct(&s)
+			if got := failures(v); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("failures = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxLengthMessage(t *testing.T) {
+	v := New()
+	v.Struct(struct {
+		Name string `json:"name" validate:"max=3"`
+	}{Name: "four"})
+	if got, want := v.Errors["name"], "must not be more than 3 characters"; got != want {
+		t.Errorf("message = %q, want %q", got, want)
+	}
+	if got := v.Failures[0].Params["max"]; got != int64(3) {
+		t.Errorf("params max = %#v, want 3", got)
+	}
+}
+
+func TestUniqueUnhashableElements(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  bool
+	}{
+		{"strings", []string{"a", "b"}, true},
+		{"repeated strings", []string{"a", "a"}, false},
+		{"slices", [][]string{{"a"}, {"b"}}, true},
+		{"repeated slices", [][]string{{"a"}, {"a"}}, false},
+		{"maps", []map[string]int{{"a": 1}, {"a": 2}}, true},
+		{"repeated maps", []map[string]int{{"a": 1}, {"a": 1}}, false},
+		{"interfaces holding slices", []interface{}{[]int{1}, []int{1}}, false},
+		{"interfaces of different types", []interface{}{1, "1"}, true},
+	}
+	unique, _ := lookupRule("unique")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failure := unique(FieldLevel{Value: reflect.ValueOf(tt.value)})
+			if got := failure == nil; got != tt.want {
+				t.Errorf("unique(%v) passed = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidatorHelpers(t *testing.T) {
+	v := New()
+	v.CheckCode(true, "a", CodeRequired, nil, "never recorded")
+	v.CheckCode(false, "b", CodeRequired, nil, "first")
+	v.AddFailure("b", CodeMax, Params{"max": 1}, "second")
+	if v.Valid() {
+		t.Fatal("Valid() = true with failures recorded")
+	}
+	if got := v.Errors["b"]; got != "first" {
+		t.Errorf("Errors keeps %q, want the first message", got)
+	}
+	if got := len(v.FieldErrors("b")); got != 2 {
+		t.Errorf("FieldErrors(b) has %d failures, want 2", got)
+	}
+	if got := Path("address", Index("contacts", 2), "phone"); got != "address.contacts[2].phone" {
+		t.Errorf("Path() = %q", got)
+	}
+	if !Unique([]string{"a", "b"}) || Unique([]string{"a", "a"}) {
+		t.Error("Unique() gave the wrong answer")
+	}
+}
@@ -3,8 +3,9 @@
 package validator
 
 import (
-	"net/url"
+	"fmt"
 	"regexp"
+	"strings"
 )
 
 var (
@@ -13,10 +14,52 @@ var (
 	PhoneRX = regexp.MustCompile(`^\+?\(?[0-9]{3}\)?\s?-\s?[0-9]{3}\s?-\s?[0-9]{4}$`)
 )
 
+// Stable error codes attached to every validation failure so clients
+// can branch on them and localize the message
+const (
+	CodeInvalid     = "invalid"
+	CodeRequired    = "required"
+	CodeMinLength   = "min_length"
+	CodeMaxLength   = "max_length"
+	CodeMinItems    = "min_items"
+	CodeMaxItems    = "max_items"
+	CodeMin         = "min"
+	CodeMax         = "max"
+	CodePattern     = "pattern"
+	CodeUnique      = "unique"
+	CodeOneOf       = "one_of"
+	CodeInteger     = "integer"
+	CodeBoolean     = "boolean"
+	CodeNumber      = "number"
+	CodeEqField     = "eq_field"
+	CodeNeField     = "ne_field"
+	CodeLteField    = "lte_field"
+	CodeGteField    = "gte_field"
+	CodeUnreachable = "unreachable"
+	CodeNotFound    = "not_found"
+	CodeInUse       = "in_use"
+	CodePrimary     = "primary"
+	CodeOverlap     = "overlap"
+)
+
+// Params holds the parameters of a failed rule, such as the limit that was exceeded
+type Params map[string]interface{}
+
+// FieldError records a single failed rule for a field
+type FieldError struct {
+	Field   string
+	Code    string
+	Params  Params
+	Message string
+}
+
 // create a type that wraps the validation errors map
 
 type Validator struct {
+	// Errors keeps the first message per field for callers that only need one
 	Errors map[string]string
+	// Failures keeps every failure in the order they were recorded
+	Failures []FieldError
 }
 
 // Create a new instance of Validator
@@ -32,10 +75,10 @@ func (v *Validator) Valid() bool {
 }
 
 // In() checks if elements can be found in a provided list of elements
-func In(elements string, list ...string) bool {
-	for i := range elements {
+func In(element string, list ...string) bool {
+	for i := range list {
 
-		if elements == list[i] {
+		if element == list[i] {
 			return true
 		}
 
@@ -48,14 +91,20 @@ func Matches(value string, rx *regexp.Regexp) bool {
 	return rx.MatchString(value)
 }
 
-// ValidWebsite checks if the provided string is a valid website URL
-func ValidWebsite(website string) bool {
-	_, err := url.Parse(website)
-	return err == nil
-}
-
 // AddError() adds an error entry to the Error map
 func (v *Validator) AddError(key, message string) {
+	v.AddFailure(key, CodeInvalid, nil, message)
+}
+
+// AddFailure() records a failed rule with its code and parameters.
+// A field may collect several failures, Errors only keeps the first message
+func (v *Validator) AddFailure(key, code string, params Params, message string) {
+	v.Failures = append(v.Failures, FieldError{
+		Field:   key,
+		Code:    code,
+		Params:  params,
+		Message: message,
+	})
 	if _, exists := v.Errors[key]; !exists {
 		v.Errors[key] = message
 	}
@@ -68,6 +117,34 @@ func (v *Validator) Check(ok bool, key, message string) {
 	}
 }
 
+// CheckCode() is like Check() but records the failure under a specific code
+func (v *Validator) CheckCode(ok bool, key, code string, params Params, message string) {
+	if !ok {
+		v.AddFailure(key, code, params, message)
+	}
+}
+
+// FieldErrors() returns every failure recorded for the given field
+func (v *Validator) FieldErrors(key string) []FieldError {
+	var failures []FieldError
+	for _, failure := range v.Failures {
+		if failure.Field == key {
+			failures = append(failures, failure)
+		}
+	}
+	return failures
+}
+
+// Index() builds the path of an element in a list field, e.g. mode[2]
+func Index(field string, i int) string {
+	return fmt.Sprintf("%s[%d]", field, i)
+}
+
+// Path() joins nested field names, e.g. address.district
+func Path(fields ...string) string {
+	return strings.Join(fields, ".")
+}
+
 // Unique() checks that there are no repeating values in the slice
 func Unique(values []string) bool {
 	uniqueValues := make(map[string]bool)
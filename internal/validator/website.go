@@ -0,0 +1,227 @@
+// Filename : internal/validator/website.go
+
+package validator
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	ErrWebsiteScheme      = errors.New("website must use http or https")
+	ErrWebsiteHost        = errors.New("website must have a host name")
+	ErrWebsiteCredentials = errors.New("website must not contain credentials")
+	ErrWebsiteSuffix      = errors.New("website host does not end in a known public suffix")
+	ErrWebsiteUnreachable = errors.New("website could not be reached")
+	ErrWebsiteForbidden   = errors.New("website resolves to an address that is not public")
+)
+
+//go:embed suffixes.txt
+var suffixesFile string
+
+// publicSuffixes is the set of suffixes loaded from suffixes.txt
+var publicSuffixes = loadSuffixes(suffixesFile)
+
+func loadSuffixes(contents string) map[string]bool {
+	suffixes := make(map[string]bool)
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+		suffixes[strings.ToLower(line)] = true
+	}
+	return suffixes
+}
+
+// hasPublicSuffix() checks that the host is a registrable name under a known suffix
+func hasPublicSuffix(host string) bool {
+	labels := strings.Split(host, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+				return false
+			}
+		}
+	}
+	// the longest suffix must leave at least one label in front of it,
+	// so a suffix such as edu.bz is not a website on its own
+	if publicSuffixes[host] {
+		return false
+	}
+	for i := 1; i < len(labels); i++ {
+		if publicSuffixes[strings.Join(labels[i:], ".")] {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseWebsite() parses a website URL and applies the rules for school websites:
+// http or https only, no credentials and a host under a known public suffix
+func ParseWebsite(raw string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, err
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return nil, ErrWebsiteScheme
+	}
+	if u.User != nil {
+		return nil, ErrWebsiteCredentials
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return nil, ErrWebsiteHost
+	}
+	if net.ParseIP(host) != nil || !hasPublicSuffix(strings.TrimSuffix(host, ".")) {
+		return nil, ErrWebsiteSuffix
+	}
+	return u, nil
+}
+
+// CanonicalWebsite() returns the form stored for a website: lower case scheme
+// and host, no default port and no trailing slashes
+func CanonicalWebsite(raw string) (string, error) {
+	u, err := ParseWebsite(raw)
+	if err != nil {
+		return "", err
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	u.Host = host
+	if port != "" {
+		u.Host = net.JoinHostPort(host, port)
+	}
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+	return u.String(), nil
+}
+
+// ValidWebsite checks if the provided string is a valid website URL
+func ValidWebsite(website string) bool {
+	_, err := ParseWebsite(website)
+	return err == nil
+}
+
+// WebsiteChecker probes whether a website answers. The client is injectable
+// so tests can point it at a local stand-in
+type WebsiteChecker struct {
+	Client  *http.Client
+	Timeout time.Duration
+}
+
+// maxWebsiteRedirects is how many redirects a reachability probe follows
+const maxWebsiteRedirects = 5
+
+// NewWebsiteChecker() returns a checker using a client with a short timeout.
+// The client only connects to public addresses, whatever a host name resolves
+// to, and only follows redirects to websites that pass ParseWebsite(), so a
+// probe cannot be turned against the network the server runs in
+func NewWebsiteChecker() *WebsiteChecker {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: publicAddressOnly,
+	}
+	transport := &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+	}
+	return &WebsiteChecker{
+		Client: &http.Client{
+			Timeout:       5 * time.Second,
+			Transport:     transport,
+			CheckRedirect: checkWebsiteRedirect,
+		},
+		Timeout: 5 * time.Second,
+	}
+}
+
+// publicAddressOnly() is a net.Dialer Control function, it runs after the
+// host name was resolved and refuses loopback, private, link-local and
+// unspecified addresses
+func publicAddressOnly(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !publicIP(ip) {
+		return fmt.Errorf("%w: %s", ErrWebsiteForbidden, host)
+	}
+	return nil
+}
+
+// publicIP() reports whether an address may be probed
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+}
+
+// checkWebsiteRedirect() holds the target of a redirect to the rules of a
+// school website, so a redirect cannot lead to an IP literal or internal name
+func checkWebsiteRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxWebsiteRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxWebsiteRedirects)
+	}
+	if _, err := ParseWebsite(req.URL.String()); err != nil {
+		return fmt.Errorf("%w: redirect to %s", ErrWebsiteForbidden, req.URL.Host)
+	}
+	return nil
+}
+
+// Reachable() sends a HEAD request, retrying with GET for servers that do not
+// support HEAD. Any response below 500 counts as reachable
+func (c *WebsiteChecker) Reachable(ctx context.Context, website string) error {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	var lastErr error
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequestWithContext(ctx, method, website, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := c.Client.Do(req)
+		if err != nil {
+			// retrying with GET would only be refused again
+			if errors.Is(err, ErrWebsiteForbidden) {
+				return err
+			}
+			lastErr = err
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented {
+			lastErr = fmt.Errorf("%s returned %d", method, resp.StatusCode)
+			continue
+		}
+		if resp.StatusCode >= 500 {
+			return fmt.Errorf("%w: status %d", ErrWebsiteUnreachable, resp.StatusCode)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: %v", ErrWebsiteUnreachable, lastErr)
+}
@@ -0,0 +1,4 @@
+-- Filename new_migrations/000004_add_schools_phone_e164.down.sql
+
+DROP INDEX IF EXISTS school_phone_e164_idx;
+ALTER TABLE schools DROP COLUMN IF EXISTS phone_e164;
@@ -0,0 +1,13 @@
+-- Filename new_migrations/000004_add_schools_phone_e164.up.sql
+
+ALTER TABLE schools ADD COLUMN IF NOT EXISTS phone_e164 text NOT NULL DEFAULT '';
+
+-- best effort backfill for Belize numbers, the API normalizes rows as they are updated
+UPDATE schools
+SET phone_e164 = CASE
+    WHEN regexp_replace(phone, '\D', '', 'g') ~ '^[2-8][0-9]{6}$' THEN '+501' || regexp_replace(phone, '\D', '', 'g')
+    WHEN regexp_replace(phone, '\D', '', 'g') ~ '^501[2-8][0-9]{6}$' THEN '+' || regexp_replace(phone, '\D', '', 'g')
+    ELSE ''
+END;
+
+CREATE INDEX IF NOT EXISTS school_phone_e164_idx ON schools (phone_e164 text_pattern_ops);
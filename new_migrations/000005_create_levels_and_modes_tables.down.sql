@@ -0,0 +1,10 @@
+-- Filename new_migrations/000005_create_levels_and_modes_tables.down.sql
+
+DROP TRIGGER IF EXISTS modes_restrict_cascade ON modes;
+DROP FUNCTION IF EXISTS modes_restrict_cascade();
+DROP TRIGGER IF EXISTS schools_mode_fk ON schools;
+DROP FUNCTION IF EXISTS schools_mode_fk();
+DROP INDEX IF EXISTS school_level_code_idx;
+ALTER TABLE schools DROP CONSTRAINT IF EXISTS schools_level_fk;
+DROP TABLE IF EXISTS modes;
+DROP TABLE IF EXISTS levels;
@@ -0,0 +1,99 @@
+-- Filename new_migrations/000005_create_levels_and_modes_tables.up.sql
+
+CREATE TABLE IF NOT EXISTS levels (
+    id bigserial PRIMARY KEY,
+    create_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    code text NOT NULL UNIQUE,
+    name text NOT NULL,
+    aliases text[] NOT NULL DEFAULT '{}',
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS modes (
+    id bigserial PRIMARY KEY,
+    create_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    code text NOT NULL UNIQUE,
+    name text NOT NULL,
+    aliases text[] NOT NULL DEFAULT '{}',
+    version integer NOT NULL DEFAULT 1
+);
+
+INSERT INTO levels (code, name, aliases) VALUES
+    ('preschool', 'Preschool', '{pre-school,"pre school",nursery,kindergarten}'),
+    ('primary', 'Primary', '{"primary school",elementary,"elementary school"}'),
+    ('secondary', 'Secondary', '{"secondary school","high school",highschool}'),
+    ('tertiary', 'Tertiary', '{"junior college","sixth form"}'),
+    ('university', 'University', '{uni}'),
+    ('vocational', 'Vocational', '{tvet,technical,"technical vocational"}')
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO modes (code, name, aliases) VALUES
+    ('face-to-face', 'Face to face', '{f2f,"face to face",in-person,"in person",onsite,on-site}'),
+    ('online', 'Online', '{virtual,remote,distance}'),
+    ('hybrid', 'Hybrid', '{blended}')
+ON CONFLICT (code) DO NOTHING;
+
+-- map the existing free text onto the canonical codes
+UPDATE schools s
+SET level = l.code
+FROM levels l
+WHERE lower(trim(s.level)) = l.code
+OR lower(trim(s.level)) = ANY (l.aliases);
+
+UPDATE schools s
+SET mode = (
+    SELECT array_agg(DISTINCT COALESCE(
+        (SELECT m.code FROM modes m WHERE lower(trim(v.value)) = m.code OR lower(trim(v.value)) = ANY (m.aliases)),
+        lower(trim(v.value))
+    ))
+    FROM unnest(s.mode) AS v(value)
+);
+
+-- keep values we could not map so the constraints below hold
+INSERT INTO levels (code, name)
+SELECT DISTINCT level, level FROM schools
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO modes (code, name)
+SELECT DISTINCT unnest(mode), unnest(mode) FROM schools
+ON CONFLICT (code) DO NOTHING;
+
+ALTER TABLE schools DROP CONSTRAINT IF EXISTS schools_level_fk;
+ALTER TABLE schools ADD CONSTRAINT schools_level_fk FOREIGN KEY (level) REFERENCES levels (code) ON UPDATE CASCADE;
+CREATE INDEX IF NOT EXISTS school_level_code_idx ON schools (level);
+
+-- PostgreSQL cannot put a foreign key on an array column, these triggers give mode the same guarantees
+CREATE OR REPLACE FUNCTION schools_mode_fk() RETURNS trigger AS $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM unnest(NEW.mode) AS m(code)
+        WHERE NOT EXISTS (SELECT 1 FROM modes WHERE modes.code = m.code)
+    ) THEN
+        RAISE foreign_key_violation USING MESSAGE = 'schools.mode references an unknown mode';
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS schools_mode_fk ON schools;
+CREATE TRIGGER schools_mode_fk BEFORE INSERT OR UPDATE OF mode ON schools
+    FOR EACH ROW EXECUTE FUNCTION schools_mode_fk();
+
+CREATE OR REPLACE FUNCTION modes_restrict_cascade() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        IF EXISTS (SELECT 1 FROM schools WHERE mode @> ARRAY[OLD.code]) THEN
+            RAISE foreign_key_violation USING MESSAGE = 'mode is still used by schools';
+        END IF;
+        RETURN OLD;
+    END IF;
+    IF NEW.code <> OLD.code THEN
+        UPDATE schools SET mode = array_replace(mode, OLD.code, NEW.code) WHERE mode @> ARRAY[OLD.code];
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS modes_restrict_cascade ON modes;
+CREATE TRIGGER modes_restrict_cascade AFTER UPDATE OR DELETE ON modes
+    FOR EACH ROW EXECUTE FUNCTION modes_restrict_cascade();
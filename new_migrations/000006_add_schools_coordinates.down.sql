@@ -0,0 +1,6 @@
+-- Filename new_migrations/000006_add_schools_coordinates.down.sql
+
+DROP INDEX IF EXISTS school_coordinates_idx;
+ALTER TABLE schools DROP CONSTRAINT IF EXISTS coordinates_range_check;
+ALTER TABLE schools DROP COLUMN IF EXISTS longitude;
+ALTER TABLE schools DROP COLUMN IF EXISTS latitude;
@@ -0,0 +1,13 @@
+-- Filename new_migrations/000006_add_schools_coordinates.up.sql
+
+ALTER TABLE schools ADD COLUMN IF NOT EXISTS latitude double precision;
+ALTER TABLE schools ADD COLUMN IF NOT EXISTS longitude double precision;
+
+ALTER TABLE schools DROP CONSTRAINT IF EXISTS coordinates_range_check;
+ALTER TABLE schools ADD CONSTRAINT coordinates_range_check CHECK (
+    (latitude IS NULL AND longitude IS NULL)
+    OR (latitude BETWEEN -90 AND 90 AND longitude BETWEEN -180 AND 180)
+);
+
+-- supports the bounding box prefilter of the nearby search
+CREATE INDEX IF NOT EXISTS school_coordinates_idx ON schools (latitude, longitude);
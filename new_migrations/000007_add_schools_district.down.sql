@@ -0,0 +1,3 @@
+-- Filename new_migrations/000007_add_schools_district.down.sql
+
+ALTER TABLE schools DROP COLUMN IF EXISTS district;
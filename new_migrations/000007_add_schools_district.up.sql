@@ -0,0 +1,3 @@
+-- Filename new_migrations/000007_add_schools_district.up.sql
+
+ALTER TABLE schools ADD COLUMN IF NOT EXISTS district text NOT NULL DEFAULT '';
@@ -0,0 +1,20 @@
+-- Filename new_migrations/000008_create_districts_and_address_components.down.sql
+
+DROP TRIGGER IF EXISTS districts_rename_address ON districts;
+DROP FUNCTION IF EXISTS districts_rename_address();
+DROP TRIGGER IF EXISTS schools_address_derive ON schools;
+DROP FUNCTION IF EXISTS schools_address_derive();
+DROP INDEX IF EXISTS school_district_idx;
+ALTER TABLE schools DROP CONSTRAINT IF EXISTS schools_district_fk;
+
+-- the district column goes back to holding the district name
+UPDATE schools s SET district = d.name FROM districts d WHERE s.district = d.code;
+UPDATE schools SET district = '' WHERE district IS NULL;
+ALTER TABLE schools ALTER COLUMN district SET DEFAULT '';
+ALTER TABLE schools ALTER COLUMN district SET NOT NULL;
+
+ALTER TABLE schools DROP COLUMN IF EXISTS country;
+ALTER TABLE schools DROP COLUMN IF EXISTS postal_code;
+ALTER TABLE schools DROP COLUMN IF EXISTS town;
+ALTER TABLE schools DROP COLUMN IF EXISTS street;
+DROP TABLE IF EXISTS districts;
@@ -0,0 +1,77 @@
+-- Filename new_migrations/000008_create_districts_and_address_components.up.sql
+
+CREATE TABLE IF NOT EXISTS districts (
+    id bigserial PRIMARY KEY,
+    create_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    code text NOT NULL UNIQUE,
+    name text NOT NULL,
+    aliases text[] NOT NULL DEFAULT '{}',
+    version integer NOT NULL DEFAULT 1
+);
+
+INSERT INTO districts (code, name, aliases) VALUES
+    ('belize', 'Belize', '{"belize district"}'),
+    ('cayo', 'Cayo', '{"cayo district"}'),
+    ('corozal', 'Corozal', '{"corozal district"}'),
+    ('orange-walk', 'Orange Walk', '{"orange walk","orange walk district"}'),
+    ('stann-creek', 'Stann Creek', '{"stann creek","stann creek district"}'),
+    ('toledo', 'Toledo', '{"toledo district"}')
+ON CONFLICT (code) DO NOTHING;
+
+ALTER TABLE schools ADD COLUMN IF NOT EXISTS street text NOT NULL DEFAULT '';
+ALTER TABLE schools ADD COLUMN IF NOT EXISTS town text NOT NULL DEFAULT '';
+ALTER TABLE schools ADD COLUMN IF NOT EXISTS postal_code text NOT NULL DEFAULT '';
+ALTER TABLE schools ADD COLUMN IF NOT EXISTS country text NOT NULL DEFAULT 'Belize';
+
+-- district becomes a reference to districts, a school without one is NULL
+ALTER TABLE schools ALTER COLUMN district DROP NOT NULL;
+ALTER TABLE schools ALTER COLUMN district DROP DEFAULT;
+
+UPDATE schools s
+SET district = d.code
+FROM districts d
+WHERE lower(trim(s.district)) = d.code
+OR lower(trim(s.district)) = ANY (d.aliases)
+OR lower(trim(s.district)) = lower(d.name);
+
+UPDATE schools
+SET district = NULL
+WHERE district NOT IN (SELECT code FROM districts);
+
+ALTER TABLE schools DROP CONSTRAINT IF EXISTS schools_district_fk;
+ALTER TABLE schools ADD CONSTRAINT schools_district_fk FOREIGN KEY (district) REFERENCES districts (code) ON UPDATE CASCADE;
+CREATE INDEX IF NOT EXISTS school_district_idx ON schools (district);
+
+-- the legacy address is kept as the readable form of the components
+CREATE OR REPLACE FUNCTION schools_address_derive() RETURNS trigger AS $$
+BEGIN
+    NEW.address := concat_ws(', ',
+        NULLIF(NEW.street, ''),
+        NULLIF(NEW.town, ''),
+        (SELECT name FROM districts WHERE code = NEW.district),
+        NULLIF(NEW.postal_code, ''),
+        NULLIF(NEW.country, '')
+    );
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS schools_address_derive ON schools;
+CREATE TRIGGER schools_address_derive BEFORE INSERT OR UPDATE ON schools
+    FOR EACH ROW EXECUTE FUNCTION schools_address_derive();
+
+-- existing addresses become the street line, the trigger rebuilds address
+UPDATE schools SET street = address WHERE street = '';
+
+CREATE OR REPLACE FUNCTION districts_rename_address() RETURNS trigger AS $$
+BEGIN
+    IF NEW.name <> OLD.name THEN
+        UPDATE schools SET district = district WHERE district = NEW.code;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS districts_rename_address ON districts;
+CREATE TRIGGER districts_rename_address AFTER UPDATE ON districts
+    FOR EACH ROW EXECUTE FUNCTION districts_rename_address();
@@ -0,0 +1,4 @@
+-- Filename new_migrations/000009_add_schools_search_vector.down.sql
+
+DROP INDEX IF EXISTS school_search_idx;
+ALTER TABLE schools DROP COLUMN IF EXISTS search;
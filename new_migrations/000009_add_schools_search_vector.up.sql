@@ -0,0 +1,11 @@
+-- Filename new_migrations/000009_add_schools_search_vector.up.sql
+
+-- name matches weigh the most, then level, address and contact
+ALTER TABLE schools ADD COLUMN IF NOT EXISTS search tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', coalesce(name, '')), 'A') ||
+    setweight(to_tsvector('simple', coalesce(level, '')), 'B') ||
+    setweight(to_tsvector('simple', coalesce(address, '')), 'C') ||
+    setweight(to_tsvector('simple', coalesce(contact, '')), 'D')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS school_search_idx ON schools USING GIN(search);
@@ -0,0 +1,4 @@
+-- Filename new_migrations/000010_add_schools_name_trigram.down.sql
+
+DROP INDEX IF EXISTS school_name_trgm_idx;
+DROP EXTENSION IF EXISTS pg_trgm;
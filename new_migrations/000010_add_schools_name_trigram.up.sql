@@ -0,0 +1,6 @@
+-- Filename new_migrations/000010_add_schools_name_trigram.up.sql
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- serves both the prefix LIKE and the similarity operators of the suggestions
+CREATE INDEX IF NOT EXISTS school_name_trgm_idx ON schools USING GIN(lower(name) gin_trgm_ops);
@@ -0,0 +1,6 @@
+-- Filename new_migrations/000011_create_school_redirects_and_history.down.sql
+
+DROP INDEX IF EXISTS school_email_domain_idx;
+DROP INDEX IF EXISTS school_address_trgm_idx;
+DROP TABLE IF EXISTS school_history;
+DROP TABLE IF EXISTS school_redirects;
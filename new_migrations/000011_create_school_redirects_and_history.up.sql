@@ -0,0 +1,23 @@
+-- Filename new_migrations/000011_create_school_redirects_and_history.up.sql
+
+-- ids of schools merged into another one, the old URLs redirect to school_id
+CREATE TABLE IF NOT EXISTS school_redirects (
+    old_id bigint PRIMARY KEY,
+    create_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    school_id bigint NOT NULL REFERENCES schools (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS school_redirects_school_idx ON school_redirects (school_id);
+
+-- history outlives the schools it describes, so there is no foreign key
+CREATE TABLE IF NOT EXISTS school_history (
+    id bigserial PRIMARY KEY,
+    create_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    school_id bigint NOT NULL,
+    action text NOT NULL,
+    details jsonb NOT NULL DEFAULT '{}'
+);
+CREATE INDEX IF NOT EXISTS school_history_school_idx ON school_history (school_id);
+
+-- candidates for the duplicate detector
+CREATE INDEX IF NOT EXISTS school_address_trgm_idx ON schools USING GIN(lower(address) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS school_email_domain_idx ON schools (split_part(lower(email), '@', 2));
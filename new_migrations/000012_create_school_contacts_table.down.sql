@@ -0,0 +1,3 @@
+-- Filename new_migrations/000012_create_school_contacts_table.down.sql
+
+DROP TABLE IF EXISTS school_contacts;
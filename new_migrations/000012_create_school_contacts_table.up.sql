@@ -0,0 +1,24 @@
+-- Filename new_migrations/000012_create_school_contacts_table.up.sql
+
+CREATE TABLE IF NOT EXISTS school_contacts (
+    id bigserial PRIMARY KEY,
+    create_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    school_id bigint NOT NULL REFERENCES schools (id) ON DELETE CASCADE,
+    role text NOT NULL,
+    name text NOT NULL,
+    phone text NOT NULL DEFAULT '',
+    phone_e164 text NOT NULL DEFAULT '',
+    email text NOT NULL DEFAULT '',
+    is_primary boolean NOT NULL DEFAULT false,
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS school_contacts_school_idx ON school_contacts (school_id);
+-- the primary contact is mirrored in the contact, phone and email of schools
+CREATE UNIQUE INDEX IF NOT EXISTS school_contacts_primary_idx ON school_contacts (school_id) WHERE is_primary;
+
+-- the single contact every school had becomes its primary contact
+INSERT INTO school_contacts (school_id, role, name, phone, phone_e164, email, is_primary)
+SELECT id, 'general', contact, phone, phone_e164, email, true
+FROM schools
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,18 @@
+-- Filename new_migrations/000013_create_programs_table.down.sql
+
+CREATE OR REPLACE FUNCTION modes_restrict_cascade() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        IF EXISTS (SELECT 1 FROM schools WHERE mode @> ARRAY[OLD.code]) THEN
+            RAISE foreign_key_violation USING MESSAGE = 'mode is still used by schools';
+        END IF;
+        RETURN OLD;
+    END IF;
+    IF NEW.code <> OLD.code THEN
+        UPDATE schools SET mode = array_replace(mode, OLD.code, NEW.code) WHERE mode @> ARRAY[OLD.code];
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TABLE IF EXISTS programs;
@@ -0,0 +1,42 @@
+-- Filename new_migrations/000013_create_programs_table.up.sql
+
+CREATE TABLE IF NOT EXISTS programs (
+    id bigserial PRIMARY KEY,
+    create_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    school_id bigint NOT NULL REFERENCES schools (id) ON DELETE CASCADE,
+    name text NOT NULL,
+    description text NOT NULL DEFAULT '',
+    mode text[] NOT NULL,
+    capacity integer,
+    version integer NOT NULL DEFAULT 1
+);
+
+ALTER TABLE programs DROP CONSTRAINT IF EXISTS programs_capacity_check;
+ALTER TABLE programs ADD CONSTRAINT programs_capacity_check CHECK (capacity IS NULL OR capacity >= 0);
+
+CREATE INDEX IF NOT EXISTS programs_school_idx ON programs (school_id);
+CREATE INDEX IF NOT EXISTS programs_mode_idx ON programs USING GIN(mode);
+CREATE UNIQUE INDEX IF NOT EXISTS programs_school_name_idx ON programs (school_id, lower(name));
+
+-- program modes come from the same vocabulary as school modes
+DROP TRIGGER IF EXISTS programs_mode_fk ON programs;
+CREATE TRIGGER programs_mode_fk BEFORE INSERT OR UPDATE OF mode ON programs
+    FOR EACH ROW EXECUTE FUNCTION schools_mode_fk();
+
+-- renaming or deleting a mode now has to consider programs as well
+CREATE OR REPLACE FUNCTION modes_restrict_cascade() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        IF EXISTS (SELECT 1 FROM schools WHERE mode @> ARRAY[OLD.code])
+        OR EXISTS (SELECT 1 FROM programs WHERE mode @> ARRAY[OLD.code]) THEN
+            RAISE foreign_key_violation USING MESSAGE = 'mode is still used by schools or programs';
+        END IF;
+        RETURN OLD;
+    END IF;
+    IF NEW.code <> OLD.code THEN
+        UPDATE schools SET mode = array_replace(mode, OLD.code, NEW.code) WHERE mode @> ARRAY[OLD.code];
+        UPDATE programs SET mode = array_replace(mode, OLD.code, NEW.code) WHERE mode @> ARRAY[OLD.code];
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,3 @@
+-- Filename new_migrations/000014_create_school_enrollments_table.down.sql
+
+DROP TABLE IF EXISTS school_enrollments;
@@ -0,0 +1,30 @@
+-- Filename new_migrations/000014_create_school_enrollments_table.up.sql
+
+CREATE TABLE IF NOT EXISTS school_enrollments (
+    school_id bigint NOT NULL REFERENCES schools (id) ON DELETE CASCADE,
+    academic_year text NOT NULL,
+    create_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    update_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    enrollment integer NOT NULL,
+    capacity integer NOT NULL,
+    teachers integer NOT NULL,
+    over_capacity boolean NOT NULL DEFAULT false,
+    version integer NOT NULL DEFAULT 1,
+    PRIMARY KEY (school_id, academic_year)
+);
+
+ALTER TABLE school_enrollments DROP CONSTRAINT IF EXISTS school_enrollments_year_check;
+ALTER TABLE school_enrollments ADD CONSTRAINT school_enrollments_year_check
+    CHECK (academic_year ~ '^[0-9]{4}-[0-9]{4}$'
+        AND split_part(academic_year, '-', 2)::int = split_part(academic_year, '-', 1)::int + 1);
+
+ALTER TABLE school_enrollments DROP CONSTRAINT IF EXISTS school_enrollments_counts_check;
+ALTER TABLE school_enrollments ADD CONSTRAINT school_enrollments_counts_check
+    CHECK (enrollment >= 0 AND capacity >= 0 AND teachers >= 0);
+
+-- an over capacity year has to be flagged on purpose
+ALTER TABLE school_enrollments DROP CONSTRAINT IF EXISTS school_enrollments_capacity_check;
+ALTER TABLE school_enrollments ADD CONSTRAINT school_enrollments_capacity_check
+    CHECK (over_capacity OR enrollment <= capacity);
+
+CREATE INDEX IF NOT EXISTS school_enrollments_year_idx ON school_enrollments (academic_year);
@@ -0,0 +1,4 @@
+-- Filename new_migrations/000015_create_school_calendar_tables.down.sql
+
+DROP TABLE IF EXISTS school_events;
+DROP TABLE IF EXISTS school_hours;
@@ -0,0 +1,34 @@
+-- Filename new_migrations/000015_create_school_calendar_tables.up.sql
+
+-- weekday follows ISO 8601, 1 is Monday and 7 is Sunday
+CREATE TABLE IF NOT EXISTS school_hours (
+    school_id bigint NOT NULL REFERENCES schools (id) ON DELETE CASCADE,
+    weekday smallint NOT NULL CHECK (weekday BETWEEN 1 AND 7),
+    opens time(0) NOT NULL,
+    closes time(0) NOT NULL,
+    PRIMARY KEY (school_id, weekday, opens),
+    CHECK (closes > opens)
+);
+
+CREATE TABLE IF NOT EXISTS school_events (
+    id bigserial PRIMARY KEY,
+    create_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    update_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    school_id bigint NOT NULL REFERENCES schools (id) ON DELETE CASCADE,
+    kind text NOT NULL,
+    title text NOT NULL,
+    description text NOT NULL DEFAULT '',
+    starts_on date NOT NULL,
+    ends_on date NOT NULL,
+    version integer NOT NULL DEFAULT 1
+);
+
+ALTER TABLE school_events DROP CONSTRAINT IF EXISTS school_events_kind_check;
+ALTER TABLE school_events ADD CONSTRAINT school_events_kind_check
+    CHECK (kind IN ('term_start', 'term_end', 'holiday', 'open_day', 'event'));
+
+ALTER TABLE school_events DROP CONSTRAINT IF EXISTS school_events_dates_check;
+ALTER TABLE school_events ADD CONSTRAINT school_events_dates_check CHECK (ends_on >= starts_on);
+
+CREATE INDEX IF NOT EXISTS school_events_school_idx ON school_events (school_id, starts_on);
+CREATE INDEX IF NOT EXISTS school_events_ends_on_idx ON school_events (ends_on);
@@ -0,0 +1,3 @@
+-- Filename new_migrations/000016_create_school_images_table.down.sql
+
+DROP TABLE IF EXISTS school_images;
@@ -0,0 +1,21 @@
+-- Filename new_migrations/000016_create_school_images_table.up.sql
+
+-- blob_key is the prefix of the stored original and its thumbnails
+CREATE TABLE IF NOT EXISTS school_images (
+    id bigserial PRIMARY KEY,
+    create_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    school_id bigint NOT NULL REFERENCES schools (id) ON DELETE CASCADE,
+    kind text NOT NULL,
+    blob_key text NOT NULL UNIQUE,
+    ext text NOT NULL,
+    width integer NOT NULL,
+    height integer NOT NULL,
+    size bigint NOT NULL
+);
+
+ALTER TABLE school_images DROP CONSTRAINT IF EXISTS school_images_kind_check;
+ALTER TABLE school_images ADD CONSTRAINT school_images_kind_check CHECK (kind IN ('logo', 'photo'));
+
+CREATE INDEX IF NOT EXISTS school_images_school_idx ON school_images (school_id);
+-- a school has at most one logo
+CREATE UNIQUE INDEX IF NOT EXISTS school_images_logo_idx ON school_images (school_id) WHERE kind = 'logo';
@@ -0,0 +1,3 @@
+-- Filename new_migrations/000017_create_school_documents_table.down.sql
+
+DROP TABLE IF EXISTS school_documents;
@@ -0,0 +1,36 @@
+-- Filename new_migrations/000017_create_school_documents_table.up.sql
+
+-- a document is only served once its scan_status is clean
+CREATE TABLE IF NOT EXISTS school_documents (
+    id bigserial PRIMARY KEY,
+    create_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    school_id bigint NOT NULL REFERENCES schools (id) ON DELETE CASCADE,
+    type text NOT NULL,
+    title text NOT NULL,
+    valid_from date,
+    valid_until date,
+    filename text NOT NULL,
+    content_type text NOT NULL,
+    size bigint NOT NULL,
+    sha256 text NOT NULL,
+    blob_key text NOT NULL UNIQUE,
+    scan_status text NOT NULL DEFAULT 'pending',
+    scan_signature text NOT NULL DEFAULT '',
+    scanned_at timestamp(0) with time zone,
+    version integer NOT NULL DEFAULT 1
+);
+
+ALTER TABLE school_documents DROP CONSTRAINT IF EXISTS school_documents_type_check;
+ALTER TABLE school_documents ADD CONSTRAINT school_documents_type_check
+    CHECK (type IN ('accreditation', 'fee_schedule', 'license', 'policy', 'other'));
+
+ALTER TABLE school_documents DROP CONSTRAINT IF EXISTS school_documents_status_check;
+ALTER TABLE school_documents ADD CONSTRAINT school_documents_status_check
+    CHECK (scan_status IN ('pending', 'clean', 'infected'));
+
+ALTER TABLE school_documents DROP CONSTRAINT IF EXISTS school_documents_validity_check;
+ALTER TABLE school_documents ADD CONSTRAINT school_documents_validity_check
+    CHECK (valid_until IS NULL OR valid_from IS NULL OR valid_until >= valid_from);
+
+CREATE INDEX IF NOT EXISTS school_documents_school_idx ON school_documents (school_id);
+CREATE INDEX IF NOT EXISTS school_documents_pending_idx ON school_documents (id) WHERE scan_status = 'pending';
@@ -0,0 +1,4 @@
+-- Filename new_migrations/000018_create_school_licenses_table.down.sql
+
+DROP FUNCTION IF EXISTS school_license_status(bigint, integer);
+DROP TABLE IF EXISTS school_licenses;
@@ -0,0 +1,40 @@
+-- Filename new_migrations/000018_create_school_licenses_table.up.sql
+
+CREATE TABLE IF NOT EXISTS school_licenses (
+    id bigserial PRIMARY KEY,
+    create_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    school_id bigint NOT NULL REFERENCES schools (id) ON DELETE CASCADE,
+    issuing_body text NOT NULL,
+    number text NOT NULL,
+    status text NOT NULL DEFAULT 'active',
+    issued_on date NOT NULL,
+    expires_on date,
+    -- set once the expiry alert went out, cleared when the expiry date changes
+    expiry_notified_at timestamp(0) with time zone,
+    version integer NOT NULL DEFAULT 1
+);
+
+ALTER TABLE school_licenses DROP CONSTRAINT IF EXISTS school_licenses_status_check;
+ALTER TABLE school_licenses ADD CONSTRAINT school_licenses_status_check
+    CHECK (status IN ('active', 'suspended', 'revoked'));
+
+ALTER TABLE school_licenses DROP CONSTRAINT IF EXISTS school_licenses_dates_check;
+ALTER TABLE school_licenses ADD CONSTRAINT school_licenses_dates_check
+    CHECK (expires_on IS NULL OR expires_on >= issued_on);
+
+CREATE INDEX IF NOT EXISTS school_licenses_school_idx ON school_licenses (school_id);
+CREATE INDEX IF NOT EXISTS school_licenses_expires_on_idx ON school_licenses (expires_on) WHERE status = 'active';
+CREATE UNIQUE INDEX IF NOT EXISTS school_licenses_number_idx ON school_licenses (lower(issuing_body), lower(number));
+
+-- the license status of a school follows its longest running active license:
+-- valid, expiring within expiring_days, expired, or NULL without one
+CREATE OR REPLACE FUNCTION school_license_status(school bigint, expiring_days integer) RETURNS text AS $$
+    SELECT CASE
+        WHEN bool_or(expires_on IS NULL OR expires_on > current_date + expiring_days) THEN 'valid'
+        WHEN bool_or(expires_on >= current_date) THEN 'expiring'
+        WHEN count(*) > 0 THEN 'expired'
+    END
+    FROM school_licenses
+    WHERE school_id = school
+    AND status = 'active'
+$$ LANGUAGE sql STABLE;
@@ -0,0 +1,9 @@
+-- Filename new_migrations/000019_create_users_and_reviews_tables.down.sql
+
+DROP TABLE IF EXISTS reviews;
+DROP FUNCTION IF EXISTS reviews_rating_refresh();
+DROP FUNCTION IF EXISTS schools_rating_refresh(bigint);
+DROP INDEX IF EXISTS schools_rating_avg_idx;
+ALTER TABLE schools DROP COLUMN IF EXISTS rating_count;
+ALTER TABLE schools DROP COLUMN IF EXISTS rating_avg;
+DROP TABLE IF EXISTS users;
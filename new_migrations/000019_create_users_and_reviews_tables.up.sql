@@ -0,0 +1,74 @@
+-- Filename new_migrations/000019_create_users_and_reviews_tables.up.sql
+
+-- users identify themselves with a bearer token, only its SHA-256 hash is kept
+CREATE TABLE IF NOT EXISTS users (
+    id bigserial PRIMARY KEY,
+    create_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL,
+    email text NOT NULL,
+    token_hash bytea NOT NULL UNIQUE,
+    moderator boolean NOT NULL DEFAULT false,
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_idx ON users (lower(email));
+
+CREATE TABLE IF NOT EXISTS reviews (
+    id bigserial PRIMARY KEY,
+    create_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    update_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    school_id bigint NOT NULL REFERENCES schools (id) ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    rating smallint NOT NULL,
+    body text NOT NULL DEFAULT '',
+    status text NOT NULL DEFAULT 'pending',
+    flagged_terms text[] NOT NULL DEFAULT '{}',
+    moderation_note text NOT NULL DEFAULT '',
+    moderated_at timestamp(0) with time zone,
+    moderated_by bigint REFERENCES users (id) ON DELETE SET NULL,
+    version integer NOT NULL DEFAULT 1,
+    UNIQUE (school_id, user_id)
+);
+
+ALTER TABLE reviews DROP CONSTRAINT IF EXISTS reviews_rating_check;
+ALTER TABLE reviews ADD CONSTRAINT reviews_rating_check CHECK (rating BETWEEN 1 AND 5);
+
+ALTER TABLE reviews DROP CONSTRAINT IF EXISTS reviews_status_check;
+ALTER TABLE reviews ADD CONSTRAINT reviews_status_check CHECK (status IN ('pending', 'approved', 'rejected'));
+
+CREATE INDEX IF NOT EXISTS reviews_user_idx ON reviews (user_id);
+CREATE INDEX IF NOT EXISTS reviews_pending_idx ON reviews (id) WHERE status = 'pending';
+
+-- the aggregate of the approved reviews, kept on schools so listings can sort on it
+ALTER TABLE schools ADD COLUMN IF NOT EXISTS rating_avg double precision NOT NULL DEFAULT 0;
+ALTER TABLE schools ADD COLUMN IF NOT EXISTS rating_count integer NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS schools_rating_avg_idx ON schools (rating_avg);
+
+CREATE OR REPLACE FUNCTION schools_rating_refresh(school bigint) RETURNS void AS $$
+    UPDATE schools
+    SET rating_avg = COALESCE(r.average, 0), rating_count = r.total
+    FROM (
+        SELECT round(avg(rating), 2)::double precision AS average, COUNT(*) AS total
+        FROM reviews
+        WHERE school_id = school
+        AND status = 'approved'
+    ) AS r
+    WHERE id = school;
+$$ LANGUAGE sql;
+
+CREATE OR REPLACE FUNCTION reviews_rating_refresh() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP <> 'INSERT' THEN
+        PERFORM schools_rating_refresh(OLD.school_id);
+    END IF;
+    IF TG_OP <> 'DELETE' AND (TG_OP = 'INSERT' OR NEW.school_id <> OLD.school_id) THEN
+        PERFORM schools_rating_refresh(NEW.school_id);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS reviews_rating_refresh ON reviews;
+CREATE TRIGGER reviews_rating_refresh AFTER INSERT OR UPDATE OR DELETE ON reviews
+    FOR EACH ROW EXECUTE FUNCTION reviews_rating_refresh();
@@ -0,0 +1,3 @@
+-- Filename new_migrations/000020_create_user_favorites_table.down.sql
+
+DROP TABLE IF EXISTS user_favorites;
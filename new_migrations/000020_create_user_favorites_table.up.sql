@@ -0,0 +1,10 @@
+-- Filename new_migrations/000020_create_user_favorites_table.up.sql
+
+CREATE TABLE IF NOT EXISTS user_favorites (
+    user_id bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    school_id bigint NOT NULL REFERENCES schools (id) ON DELETE CASCADE,
+    create_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, school_id)
+);
+
+CREATE INDEX IF NOT EXISTS user_favorites_school_idx ON user_favorites (school_id);